@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tankadesign/caddy-site-manager/internal/site"
+)
+
+var aliasCmd = &cobra.Command{
+	Use:   "alias",
+	Short: "Manage additional hostnames of a site",
+	Long: `Manage additional hostnames (aliases) of a site.
+
+An alias either serves the site directly or, with --redirect, answers with a
+permanent redirect to the primary domain. A hostname can only belong to one site.`,
+}
+
+var aliasAddCmd = &cobra.Command{
+	Use:   "add [domain] [hostname]",
+	Short: "Add an alias to a site",
+	Long: `Add an additional hostname to a site.
+
+Examples:
+  caddy-site-manager alias add example.com example.net
+  caddy-site-manager alias add example.com old-name.com --redirect`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		domain := args[0]
+		hostname := args[1]
+
+		redirect, _ := cmd.Flags().GetBool("redirect")
+
+		// Create config
+		cfg := newConfig()
+
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		// Create SQLite site manager
+		sm, err := site.NewManager(cfg)
+		if err != nil {
+			return err
+		}
+
+		if err := sm.AddAlias(domain, hostname, redirect); err != nil {
+			return err
+		}
+
+		if !cfg.DryRun {
+			if redirect {
+				fmt.Printf("Alias %s added to %s (redirect)\n", hostname, domain)
+			} else {
+				fmt.Printf("Alias %s added to %s\n", hostname, domain)
+			}
+		}
+		return nil
+	},
+}
+
+var aliasRemoveCmd = &cobra.Command{
+	Use:   "remove [domain] [hostname]",
+	Short: "Remove an alias from a site",
+	Long: `Remove an additional hostname from a site.
+
+Examples:
+  caddy-site-manager alias remove example.com example.net`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		domain := args[0]
+		hostname := args[1]
+
+		// Create config
+		cfg := newConfig()
+
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		// Create SQLite site manager
+		sm, err := site.NewManager(cfg)
+		if err != nil {
+			return err
+		}
+
+		if err := sm.RemoveAlias(domain, hostname); err != nil {
+			return err
+		}
+
+		if !cfg.DryRun {
+			fmt.Printf("Alias %s removed from %s\n", hostname, domain)
+		}
+		return nil
+	},
+}
+
+var aliasListCmd = &cobra.Command{
+	Use:   "list [domain]",
+	Short: "List the aliases of a site",
+	Long: `List all additional hostnames of a site.
+
+Examples:
+  caddy-site-manager alias list example.com
+  caddy-site-manager alias list example.com -o json`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		domain := args[0]
+
+		// Create config
+		cfg := newConfig()
+
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		// Create SQLite site manager
+		sm, err := site.NewManager(cfg)
+		if err != nil {
+			return err
+		}
+
+		aliases, err := sm.ListAliases(domain)
+		if err != nil {
+			return err
+		}
+
+		return renderAliases(domain, aliases)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(aliasCmd)
+	aliasCmd.AddCommand(aliasAddCmd)
+	aliasCmd.AddCommand(aliasRemoveCmd)
+	aliasCmd.AddCommand(aliasListCmd)
+
+	aliasAddCmd.Flags().Bool("redirect", false, "Redirect the alias permanently to the primary domain instead of serving the site")
+}
@@ -1,43 +1,89 @@
 package cmd
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
-	"github.com/tankadesign/caddy-site-manager/internal/config"
 	"github.com/tankadesign/caddy-site-manager/internal/site"
 )
 
 var createCmd = &cobra.Command{
 	Use:   "create [domain]",
-	Short: "Create a new PHP or WordPress site",
-	Long: `Create a new PHP or WordPress site with Caddy configuration and custom PHP-FPM pool.
+	Short: "Create a new site",
+	Long: `Create a new PHP, WordPress, Laravel, Symfony, static or reverse proxy site with
+Caddy configuration. PHP based sites get their own PHP-FPM pool.
 
 Examples:
   caddy-site-manager create mysite.com --wordpress --db=mysite_db --pwd=secure_password
   caddy-site-manager create mysite.com --wordpress
+  caddy-site-manager create mysite.com --type=wordpress
   caddy-site-manager create phpsite.com --max-upload=512M
-  caddy-site-manager create basicsite.com`,
+  caddy-site-manager create shop.com --pm=ondemand --max-children=30
+  caddy-site-manager create client.com --wordpress --isolate
+  caddy-site-manager create basicsite.com
+  caddy-site-manager create example.com --canonical=www
+  caddy-site-manager create example.com --caddy-template=caddy/php-cached
+  caddy-site-manager create shop.example.com --type=laravel
+  caddy-site-manager create docs.example.com --static
+  caddy-site-manager create app.example.com --static --spa
+  caddy-site-manager create app.example.com --proxy=127.0.0.1:3000
+  caddy-site-manager create app.example.com --proxy=10.0.0.1:3000,10.0.0.2:3000 --lb-policy=round_robin --health-uri=/health`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		domain := args[0]
 
 		// Get flags
+		typeName, _ := cmd.Flags().GetString("type")
 		wordpress, _ := cmd.Flags().GetBool("wordpress")
+		static, _ := cmd.Flags().GetBool("static")
+		spa, _ := cmd.Flags().GetBool("spa")
 		dbName, _ := cmd.Flags().GetString("db")
 		dbPassword, _ := cmd.Flags().GetString("pwd")
 		maxUpload, _ := cmd.Flags().GetString("max-upload")
 		phpVersion, _ := cmd.Flags().GetString("php")
+		canonical, _ := cmd.Flags().GetString("canonical")
+		headerProfile, _ := cmd.Flags().GetString("header-profile")
+		upstreams, _ := cmd.Flags().GetStringSlice("proxy")
+		lbPolicy, _ := cmd.Flags().GetString("lb-policy")
+		healthURI, _ := cmd.Flags().GetString("health-uri")
+		caddyTemplate, _ := cmd.Flags().GetString("caddy-template")
+		poolTemplate, _ := cmd.Flags().GetString("pool-template")
+		pm, _ := cmd.Flags().GetString("pm")
+		maxChildren, _ := cmd.Flags().GetInt("max-children")
+		isolate, _ := cmd.Flags().GetBool("isolate")
+
+		// --wordpress is a shorthand for --type=wordpress
+		if wordpress {
+			if typeName != "" && typeName != site.TypeWordPress {
+				return fmt.Errorf("--wordpress cannot be combined with --type=%s", typeName)
+			}
+			typeName = site.TypeWordPress
+		}
+
+		// --static is a shorthand for --type=static
+		if static {
+			if typeName != "" && typeName != site.TypeStatic {
+				return fmt.Errorf("--static cannot be combined with --type=%s", typeName)
+			}
+			typeName = site.TypeStatic
+		}
+
+		// --proxy implies --type=proxy
+		if len(upstreams) > 0 {
+			if typeName != "" && typeName != site.TypeProxy {
+				return fmt.Errorf("--proxy cannot be combined with --type=%s", typeName)
+			}
+			typeName = site.TypeProxy
+		}
+
+		if spa && typeName != site.TypeStatic {
+			return fmt.Errorf("--spa is only supported for static sites")
+		}
 
 		// Create config
-		cfg := config.NewCaddyConfig(viper.GetString("caddy-config"))
-		cfg.DryRun = viper.GetBool("dry-run")
-		cfg.Verbose = viper.GetBool("verbose")
+		cfg := newConfig()
 		cfg.PHPVersion = phpVersion
-		
-		// Set database path if provided
-		if dbPath := viper.GetString("database"); dbPath != "" {
-			cfg.DatabasePath = dbPath
-		}
 
 		if err := cfg.Validate(); err != nil {
 			return err
@@ -56,24 +102,59 @@ Examples:
 		// Create site options
 		opts := &site.SiteCreateOptions{
 			Domain:     domain,
-			WordPress:  wordpress,
+			Type:       typeName,
 			DBName:     dbName,
 			DBPassword: dbPassword,
 			MaxUpload:  maxUpload,
 			PHPVersion: phpVersion,
+			Canonical:  canonical,
+
+			HeaderProfile: headerProfile,
+			CaddyTemplate: caddyTemplate,
+			PoolTemplate:  poolTemplate,
+
+			Upstreams: upstreams,
+			LBPolicy:  lbPolicy,
+			HealthURI: healthURI,
+
+			SPAFallback: spa,
+
+			PM:          pm,
+			MaxChildren: maxChildren,
+
+			Isolate: isolate,
 		}
 
 		// Create site
-		return sm.CreateSite(opts)
+		result, err := sm.CreateSite(opts)
+		if err != nil {
+			return err
+		}
+
+		printCreateResult(result)
+		return nil
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(createCmd)
 
-	createCmd.Flags().Bool("wordpress", false, "Setup WordPress (requires database)")
+	createCmd.Flags().String("type", "", fmt.Sprintf("Site type: %s (default %s)", strings.Join(site.SiteTypeNames(), ", "), site.DefaultSiteType))
+	createCmd.Flags().Bool("wordpress", false, "Setup WordPress (shorthand for --type=wordpress)")
 	createCmd.Flags().String("db", "", "Database name (auto-generated if not provided with --wordpress)")
 	createCmd.Flags().String("pwd", "", "Database password (auto-generated if not provided with --wordpress)")
 	createCmd.Flags().String("max-upload", "256M", "Maximum upload size")
 	createCmd.Flags().String("php", "8.3", "PHP version to use")
+	createCmd.Flags().Bool("static", false, "Setup a static site without PHP (shorthand for --type=static)")
+	createCmd.Flags().Bool("spa", false, "Serve index.html for unknown paths (single page applications, static sites only)")
+	createCmd.Flags().StringSlice("proxy", nil, "Create a reverse proxy to these upstreams (host:port, comma separated)")
+	createCmd.Flags().String("lb-policy", "", "Load balancing policy for multiple upstreams, e.g. round_robin or least_conn")
+	createCmd.Flags().String("health-uri", "", "Path the upstreams are health checked on, e.g. /health")
+	createCmd.Flags().String("caddy-template", "", "Caddy template to use instead of the default of the site type (see templates list)")
+	createCmd.Flags().String("pool-template", "", "PHP-FPM pool template to use instead of the default of the site type (see templates list)")
+	createCmd.Flags().String("pm", "", "PHP-FPM process manager: static, dynamic or ondemand (default dynamic)")
+	createCmd.Flags().Int("max-children", 0, "Maximum number of PHP-FPM worker processes (default 10)")
+	createCmd.Flags().Bool("isolate", false, "Run the PHP-FPM pool as a dedicated system user that owns the site files")
+	createCmd.Flags().String("header-profile", "", "Response header profile, e.g. basic or strict (default basic)")
+	createCmd.Flags().String("canonical", "", "Canonical host: apex (www. redirects to the domain), www (the domain redirects to www.) or none (default: apex for bare domains, none for subdomains)")
 }
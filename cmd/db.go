@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+	"github.com/tankadesign/caddy-site-manager/internal/secrets"
+	"github.com/tankadesign/caddy-site-manager/internal/site"
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage the site registry database",
+	Long:  `Commands for maintaining the SQLite database that stores site configurations.`,
+}
+
+var dbMigrateSchemaCmd = &cobra.Command{
+	Use:   "migrate-schema",
+	Short: "Apply pending schema migrations to the site database",
+	Long: `Apply all pending schema migrations to the SQLite site database.
+
+Migrations are also applied automatically whenever the database is opened, so this
+command is mainly useful to upgrade a database explicitly or to inspect its state.
+A database that was migrated by a newer version of this tool is never modified.
+
+Examples:
+  caddy-site-manager db migrate-schema
+  caddy-site-manager db migrate-schema --status
+  caddy-site-manager db migrate-schema --dry-run`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		status, _ := cmd.Flags().GetBool("status")
+
+		// Create config
+		cfg := newConfig()
+
+		// Open without migrating so the current state can be reported
+		db, err := database.OpenDB(cfg.Path(cfg.DatabasePath))
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		statuses, err := db.MigrationStatus()
+		if err != nil {
+			return err
+		}
+
+		var pending []database.MigrationStatus
+		for _, s := range statuses {
+			if !s.Applied() {
+				pending = append(pending, s)
+			}
+		}
+
+		if status {
+			version, err := db.SchemaVersion()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Database: %s\n", cfg.Path(cfg.DatabasePath))
+			fmt.Printf("Schema version: %d (latest: %d)\n\n", version, database.LatestSchemaVersion())
+			for _, s := range statuses {
+				state := "pending"
+				if s.Applied() {
+					state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+				}
+				fmt.Printf("  %3d  %-28s  %s\n", s.Version, state, s.Description)
+			}
+			return nil
+		}
+
+		if len(pending) == 0 {
+			fmt.Printf("Database schema is up to date (version %d).\n", database.LatestSchemaVersion())
+			return nil
+		}
+
+		if cfg.DryRun {
+			fmt.Println("Would apply migrations:")
+			for _, s := range pending {
+				fmt.Printf("  %3d  %s\n", s.Version, s.Description)
+			}
+			return nil
+		}
+
+		// The key is needed to encrypt credentials stored in plaintext
+		cipher, err := site.LoadCipher(cfg, os.Stdout)
+		if err != nil {
+			return err
+		}
+		db.SetCipher(cipher)
+
+		applied, err := db.Migrate()
+		for _, s := range applied {
+			fmt.Printf("Applied migration %d: %s\n", s.Version, s.Description)
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Database schema is now at version %d.\n", database.LatestSchemaVersion())
+		return nil
+	},
+}
+
+var dbRekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "Rotate the key used to encrypt stored database credentials",
+	Long: `Generate a new encryption key and re-encrypt all stored MySQL credentials with it.
+
+The credentials are re-encrypted in a single transaction. The new key is written next to
+the current key file first and only replaces it once the database has been updated.
+When the key is provided through $CADDY_SITE_MANAGER_KEY the new key is printed instead
+and the environment variable must be updated by hand.
+
+Examples:
+  caddy-site-manager db rekey
+  caddy-site-manager db rekey --key-file=/etc/caddy/site-manager.key`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Create config
+		cfg := newConfig()
+		keyFile := cfg.Path(cfg.KeyFile)
+
+		// Open with the current key
+		db, err := site.OpenDatabase(cfg, os.Stdout)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		if cfg.DryRun {
+			fmt.Println("Would generate a new encryption key and re-encrypt all stored credentials")
+			return nil
+		}
+
+		newKey, err := secrets.GenerateKey()
+		if err != nil {
+			return err
+		}
+		newCipher, err := secrets.NewCipher(newKey)
+		if err != nil {
+			return err
+		}
+
+		fromEnv := secrets.KeyFromEnv()
+		pendingKeyFile := keyFile + ".new"
+		if !fromEnv {
+			if err := secrets.WriteKeyFile(pendingKeyFile, newKey); err != nil {
+				return err
+			}
+		}
+
+		count, err := db.Rekey(newCipher)
+		if err != nil {
+			os.Remove(pendingKeyFile)
+			return fmt.Errorf("failed to re-encrypt credentials: %v", err)
+		}
+
+		fmt.Printf("Re-encrypted credentials of %d site(s).\n", count)
+
+		if fromEnv {
+			fmt.Printf("The key is provided by $%s; set it to the new key:\n", secrets.KeyEnvVar)
+			fmt.Println(secrets.EncodeKey(newKey))
+			return nil
+		}
+
+		if err := os.Rename(pendingKeyFile, keyFile); err != nil {
+			return fmt.Errorf("credentials were re-encrypted but the new key could not be installed; move %s to %s manually: %v",
+				pendingKeyFile, keyFile, err)
+		}
+
+		fmt.Printf("New encryption key installed: %s\n", keyFile)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbMigrateSchemaCmd)
+	dbCmd.AddCommand(dbRekeyCmd)
+
+	dbMigrateSchemaCmd.Flags().Bool("status", false, "Show applied and pending migrations without changing anything")
+}
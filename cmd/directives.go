@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tankadesign/caddy-site-manager/internal/site"
+)
+
+var directivesCmd = &cobra.Command{
+	Use:   "directives",
+	Short: "Manage custom Caddy directives of a site",
+	Long: `Manage extra Caddy directives of a site.
+
+Caddy configs are regenerated from templates whenever a site changes, which
+overwrites manual edits of available-sites/<domain>. Extra directives are stored
+with the site and added to the end of its site block on every render.`,
+}
+
+var directivesEditCmd = &cobra.Command{
+	Use:   "edit [domain]",
+	Short: "Edit the extra directives of a site in $EDITOR",
+	Long: `Open the extra Caddy directives of a site in $EDITOR (or vi) and apply them.
+If Caddy rejects the resulting configuration, the previous directives are restored.
+
+Examples:
+  caddy-site-manager directives edit example.com
+  EDITOR=nano caddy-site-manager directives edit example.com`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		domain := args[0]
+
+		// Create config
+		cfg := newConfig()
+
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		// Create SQLite site manager
+		sm, err := site.NewManager(cfg)
+		if err != nil {
+			return err
+		}
+
+		current, err := sm.ExtraDirectives(domain)
+		if err != nil {
+			return err
+		}
+
+		edited, err := editText(current,
+			"Extra Caddy directives for "+domain,
+			"Lines starting with "+strings.TrimSpace(editHeaderPrefix)+" are removed, other # comments are kept.")
+		if err != nil {
+			return err
+		}
+
+		if edited == strings.TrimRight(current, " \t\r\n") {
+			fmt.Println("Extra directives unchanged")
+			return nil
+		}
+
+		if err := sm.SetExtraDirectives(domain, edited); err != nil {
+			return err
+		}
+
+		if !cfg.DryRun {
+			fmt.Printf("Extra directives updated for %s\n", domain)
+		}
+		return nil
+	},
+}
+
+var directivesShowCmd = &cobra.Command{
+	Use:   "show [domain]",
+	Short: "Show the extra directives of a site",
+	Long: `Print the extra Caddy directives of a site.
+
+Examples:
+  caddy-site-manager directives show example.com`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		domain := args[0]
+
+		// Create config
+		cfg := newConfig()
+
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		// Create SQLite site manager
+		sm, err := site.NewManager(cfg)
+		if err != nil {
+			return err
+		}
+
+		directives, err := sm.ExtraDirectives(domain)
+		if err != nil {
+			return err
+		}
+
+		if directives == "" {
+			fmt.Printf("No extra directives configured for %s\n", domain)
+			return nil
+		}
+		fmt.Println(directives)
+		return nil
+	},
+}
+
+// editHeaderPrefix marks the header lines editText adds, so comments of the
+// user survive the edit
+const editHeaderPrefix = "#csm: "
+
+// editText lets the user edit text in $EDITOR below a comment header and
+// returns the result without the header and trailing whitespace
+func editText(text string, header ...string) (string, error) {
+	file, err := os.CreateTemp("", "caddy-site-manager-*.caddy")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	var content strings.Builder
+	for _, line := range header {
+		content.WriteString(editHeaderPrefix + line + "\n")
+	}
+	content.WriteString(text)
+	if _, err := file.WriteString(content.String()); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write temporary file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write temporary file: %v", err)
+	}
+
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+
+	command := exec.Command(editor[0], append(editor[1:], file.Name())...)
+	command.Stdin = os.Stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+	if err := command.Run(); err != nil {
+		return "", fmt.Errorf("editor failed: %v", err)
+	}
+
+	edited, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to read temporary file: %v", err)
+	}
+
+	return stripEditHeader(string(edited)), nil
+}
+
+// stripEditHeader removes the header lines of editText and trailing
+// whitespace from edited text
+func stripEditHeader(text string) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, editHeaderPrefix) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), " \t\r\n")
+}
+
+func init() {
+	rootCmd.AddCommand(directivesCmd)
+	directivesCmd.AddCommand(directivesEditCmd)
+	directivesCmd.AddCommand(directivesShowCmd)
+}
@@ -0,0 +1,20 @@
+package cmd
+
+import "testing"
+
+func TestStripEditHeader(t *testing.T) {
+	edited := editHeaderPrefix + "Extra Caddy directives for example.com\n" +
+		editHeaderPrefix + "Lines starting with #csm: are removed.\n" +
+		"# cache static assets\n" +
+		"header /assets/* Cache-Control \"max-age=3600\"\n" +
+		"\t# keep the legacy path\n" +
+		"redir /old /new\n\n"
+
+	want := "# cache static assets\n" +
+		"header /assets/* Cache-Control \"max-age=3600\"\n" +
+		"\t# keep the legacy path\n" +
+		"redir /old /new"
+	if got := stripEditHeader(edited); got != want {
+		t.Errorf("stripEditHeader() =\n%s\nwant\n%s", got, want)
+	}
+}
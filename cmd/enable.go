@@ -1,9 +1,10 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
-	"github.com/tankadesign/caddy-site-manager/internal/config"
 	"github.com/tankadesign/caddy-site-manager/internal/site"
 )
 
@@ -16,14 +17,7 @@ var enableCmd = &cobra.Command{
 		domain := args[0]
 
 		// Create config
-		cfg := config.NewCaddyConfig(viper.GetString("caddy-config"))
-		cfg.DryRun = viper.GetBool("dry-run")
-		cfg.Verbose = viper.GetBool("verbose")
-		
-		// Set database path if provided
-		if dbPath := viper.GetString("database"); dbPath != "" {
-			cfg.DatabasePath = dbPath
-		}
+		cfg := newConfig()
 
 		if err := cfg.Validate(); err != nil {
 			return err
@@ -49,14 +43,7 @@ var disableCmd = &cobra.Command{
 		domain := args[0]
 
 		// Create config
-		cfg := config.NewCaddyConfig(viper.GetString("caddy-config"))
-		cfg.DryRun = viper.GetBool("dry-run")
-		cfg.Verbose = viper.GetBool("verbose")
-		
-		// Set database path if provided
-		if dbPath := viper.GetString("database"); dbPath != "" {
-			cfg.DatabasePath = dbPath
-		}
+		cfg := newConfig()
 
 		if err := cfg.Validate(); err != nil {
 			return err
@@ -89,14 +76,7 @@ With --hard: Removes symlink, deletes config file, removes database (if WordPres
 		force, _ := cmd.Flags().GetBool("force")
 
 		// Create config
-		cfg := config.NewCaddyConfig(viper.GetString("caddy-config"))
-		cfg.DryRun = viper.GetBool("dry-run")
-		cfg.Verbose = viper.GetBool("verbose")
-		
-		// Set database path if provided
-		if dbPath := viper.GetString("database"); dbPath != "" {
-			cfg.DatabasePath = dbPath
-		}
+		cfg := newConfig()
 
 		if err := cfg.Validate(); err != nil {
 			return err
@@ -116,7 +96,21 @@ With --hard: Removes symlink, deletes config file, removes database (if WordPres
 		}
 
 		// Delete site
-		return sm.DeleteSite(opts)
+		if err := sm.DeleteSite(opts); err != nil {
+			if errors.Is(err, site.ErrDeletionCancelled) {
+				fmt.Println("Deletion cancelled.")
+				return nil
+			}
+			return err
+		}
+
+		if hard {
+			fmt.Printf("Site '%s' has been completely deleted.\n", domain)
+		} else {
+			fmt.Printf("Site '%s' has been disabled (symlink removed).\n", domain)
+			fmt.Printf("To completely delete the site, run with --hard flag\n")
+		}
+		return nil
 	},
 }
 
@@ -126,14 +120,7 @@ var listCmd = &cobra.Command{
 	Long:  `List all available and enabled sites.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Create config
-		cfg := config.NewCaddyConfig(viper.GetString("caddy-config"))
-		cfg.DryRun = viper.GetBool("dry-run")
-		cfg.Verbose = viper.GetBool("verbose")
-		
-		// Set database path if provided
-		if dbPath := viper.GetString("database"); dbPath != "" {
-			cfg.DatabasePath = dbPath
-		}
+		cfg := newConfig()
 
 		if err := cfg.Validate(); err != nil {
 			return err
@@ -146,7 +133,12 @@ var listCmd = &cobra.Command{
 		}
 
 		// List sites
-		return sm.ListSites()
+		sites, err := sm.ListSites()
+		if err != nil {
+			return err
+		}
+
+		return renderSites(sites)
 	},
 }
 
@@ -9,9 +9,9 @@ import (
 	"strings"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 	"github.com/tankadesign/caddy-site-manager/internal/config"
 	"github.com/tankadesign/caddy-site-manager/internal/database"
+	"github.com/tankadesign/caddy-site-manager/internal/site"
 )
 
 var migrateCmd = &cobra.Command{
@@ -49,14 +49,7 @@ func init() {
 
 func runMigrate(cmd *cobra.Command, args []string) error {
 	// Load configuration
-	cfg := config.NewCaddyConfig(viper.GetString("caddy-config"))
-	cfg.Verbose = viper.GetBool("verbose")
-	cfg.DryRun = viper.GetBool("dry-run")
-	
-	// Override database path if specified
-	if dbPath := viper.GetString("database"); dbPath != "" {
-		cfg.DatabasePath = dbPath
-	}
+	cfg := newConfig()
 
 	if cfg.Verbose {
 		fmt.Printf("Starting migration from Caddy configs to SQLite database...\n")
@@ -66,7 +59,7 @@ func runMigrate(cmd *cobra.Command, args []string) error {
 	}
 
 	// Initialize database connection
-	db, err := database.NewDB(cfg.DatabasePath)
+	db, err := site.OpenDatabase(cfg, os.Stdout)
 	if err != nil {
 		return fmt.Errorf("failed to initialize database: %v", err)
 	}
@@ -93,7 +86,7 @@ func runMigrate(cmd *cobra.Command, args []string) error {
 
 	// Create backup if not skipping and not dry run
 	if !skipBackup && !cfg.DryRun && len(existingSites) > 0 {
-		if err := createDatabaseBackup(cfg.DatabasePath); err != nil {
+		if err := createDatabaseBackup(cfg.Path(cfg.DatabasePath)); err != nil {
 			return fmt.Errorf("failed to create database backup: %v", err)
 		}
 	}
@@ -115,11 +108,7 @@ func runMigrate(cmd *cobra.Command, args []string) error {
 		if s.IsEnabled {
 			status = "enabled"
 		}
-		siteType := "PHP"
-		if s.IsWordPress {
-			siteType = "WordPress"
-		}
-		fmt.Printf("  - %s (%s, %s, PHP %s)\n", s.Domain, status, siteType, s.PHPVersion)
+		fmt.Printf("  - %s (%s, %s, PHP %s)\n", s.Domain, status, siteType(&s), s.PHPVersion)
 	}
 
 	if cfg.DryRun {
@@ -188,7 +177,7 @@ func createDatabaseBackup(dbPath string) error {
 	}
 	defer sourceFile.Close()
 
-	destFile, err := os.Create(backupPath)
+	destFile, err := os.OpenFile(backupPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
 	}
@@ -204,8 +193,8 @@ func createDatabaseBackup(dbPath string) error {
 }
 
 func scanCaddyConfigs(cfg *config.CaddyConfig) ([]database.Site, map[string]string, error) {
-	sitesDir := filepath.Join(cfg.ConfigDir, "available-sites")
-	enabledDir := filepath.Join(cfg.ConfigDir, "enabled-sites")
+	sitesDir := cfg.Path(cfg.AvailableSites)
+	enabledDir := cfg.Path(cfg.EnabledSites)
 
 	if cfg.Verbose {
 		fmt.Printf("Scanning available-sites: %s\n", sitesDir)
@@ -235,6 +224,7 @@ func scanCaddyConfigs(cfg *config.CaddyConfig) ([]database.Site, map[string]stri
 			   fileName == "README" || fileName == "README.md" ||
 			   strings.HasSuffix(fileName, ".txt") ||
 			   strings.HasSuffix(fileName, ".log") ||
+			   strings.HasSuffix(fileName, ".modified") || // Backups of hand-edited configs
 			   strings.HasSuffix(fileName, ".conf") { // Skip .conf files if any exist
 				continue
 			}
@@ -296,7 +286,8 @@ func parseCaddyConfig(configFile, enabledDir string, cfg *config.CaddyConfig) (*
 			// Convert relative path to absolute for comparison
 			var targetPath string
 			if filepath.IsAbs(linkTarget) {
-				targetPath = linkTarget
+				// Absolute targets are host paths; map them below the root prefix
+				targetPath = cfg.Path(linkTarget)
 			} else {
 				targetPath = filepath.Join(filepath.Dir(enabledFile), linkTarget)
 			}
@@ -326,7 +317,11 @@ func parseCaddyConfig(configFile, enabledDir string, cfg *config.CaddyConfig) (*
 	}
 
 	// Detect if it's WordPress
-	isWordPress := detectWordPress(documentRoot, configStr)
+	isWordPress := detectWordPress(cfg.Path(documentRoot), configStr)
+	siteType := site.TypePHP
+	if isWordPress {
+		siteType = site.TypeWordPress
+	}
 
 	// Extract max upload size
 	maxUpload := extractMaxUpload(configStr)
@@ -340,25 +335,35 @@ func parseCaddyConfig(configFile, enabledDir string, cfg *config.CaddyConfig) (*
 	// Extract database info for WordPress sites
 	var dbName, dbUser, dbPassword string
 	if isWordPress {
-		dbName, dbUser, dbPassword = extractWordPressDBInfo(documentRoot)
+		dbName, dbUser, dbPassword = extractWordPressDBInfo(cfg.Path(documentRoot))
 	}
 
 	site := &database.Site{
 		Domain:       domain,
 		DocumentRoot: documentRoot,
 		PHPVersion:   phpVersion,
-		IsWordPress:  isWordPress,
+		Type:         siteType,
 		IsEnabled:    isEnabled,
 		MaxUpload:    maxUpload,
 		DBName:       dbName,
 		DBUser:       dbUser,
 		DBPassword:   dbPassword,
 		PoolName:     poolName,
+		Canonical:    extractCanonical(configStr, domain),
 	}
 
 	return site, nil
 }
 
+// extractCanonical detects whether the config redirects the www. host to the domain
+func extractCanonical(content, domain string) string {
+	re := regexp.MustCompile(`(?m)^\s*www\.` + regexp.QuoteMeta(domain) + `\s*\{`)
+	if re.MatchString(content) {
+		return database.CanonicalApex
+	}
+	return database.CanonicalNone
+}
+
 func extractDomain(configFile, content string) string {
 	// First try to extract from filename (standard Caddy approach)
 	filename := filepath.Base(configFile)
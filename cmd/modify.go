@@ -4,8 +4,6 @@ import (
 	"fmt"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
-	"github.com/tankadesign/caddy-site-manager/internal/config"
 	"github.com/tankadesign/caddy-site-manager/internal/site"
 )
 
@@ -31,14 +29,7 @@ Examples:
 		}
 
 		// Create config
-		cfg := config.NewCaddyConfig(viper.GetString("caddy-config"))
-		cfg.DryRun = viper.GetBool("dry-run")
-		cfg.Verbose = viper.GetBool("verbose")
-		
-		// Set database path if provided
-		if dbPath := viper.GetString("database"); dbPath != "" {
-			cfg.DatabasePath = dbPath
-		}
+		cfg := newConfig()
 
 		if err := cfg.Validate(); err != nil {
 			return err
@@ -50,7 +41,14 @@ Examples:
 			return err
 		}
 
-		return sm.AddBasicAuth(domain, path, username, password)
+		if err := sm.AddBasicAuth(domain, path, username, password); err != nil {
+			return err
+		}
+
+		if !cfg.DryRun {
+			fmt.Printf("Basic auth added for %s at path %s\n", domain, path)
+		}
+		return nil
 	},
 }
 
@@ -68,14 +66,7 @@ Examples:
 		path := args[1]
 
 		// Create config
-		cfg := config.NewCaddyConfig(viper.GetString("caddy-config"))
-		cfg.DryRun = viper.GetBool("dry-run")
-		cfg.Verbose = viper.GetBool("verbose")
-		
-		// Set database path if provided
-		if dbPath := viper.GetString("database"); dbPath != "" {
-			cfg.DatabasePath = dbPath
-		}
+		cfg := newConfig()
 
 		if err := cfg.Validate(); err != nil {
 			return err
@@ -87,7 +78,14 @@ Examples:
 			return err
 		}
 
-		return sm.RemoveBasicAuth(domain, path)
+		if err := sm.RemoveBasicAuth(domain, path); err != nil {
+			return err
+		}
+
+		if !cfg.DryRun {
+			fmt.Printf("Basic auth removed for %s from path %s\n", domain, path)
+		}
+		return nil
 	},
 }
 
@@ -104,14 +102,105 @@ Examples:
 		domain := args[0]
 
 		// Create config
-		cfg := config.NewCaddyConfig(viper.GetString("caddy-config"))
-		cfg.DryRun = viper.GetBool("dry-run")
-		cfg.Verbose = viper.GetBool("verbose")
-		
-		// Set database path if provided
-		if dbPath := viper.GetString("database"); dbPath != "" {
-			cfg.DatabasePath = dbPath
+		cfg := newConfig()
+
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		// Create SQLite site manager
+		sm, err := site.NewManager(cfg)
+		if err != nil {
+			return err
+		}
+
+		siteWithAuth, err := sm.ListBasicAuth(domain)
+		if err != nil {
+			return err
+		}
+
+		return renderBasicAuth(siteWithAuth)
+	},
+}
+
+var modifyCmd = &cobra.Command{
+	Use:   "modify",
+	Short: "Change settings of an existing site",
+	Long:  `Commands for changing the settings of an existing site.`,
+}
+
+var modifyCanonicalCmd = &cobra.Command{
+	Use:   "canonical [domain] [apex|www|none]",
+	Short: "Change which host of a site is canonical",
+	Long: `Change which of a site's domain and www. host is canonical.
+
+  apex  serve the domain, redirect www. to it
+  www   serve the www. host, redirect the domain to it
+  none  serve only the domain, no www. host
+
+Examples:
+  caddy-site-manager modify canonical example.com www
+  caddy-site-manager modify canonical blog.example.com none`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		domain := args[0]
+		policy := args[1]
+
+		// Create config
+		cfg := newConfig()
+
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		// Create SQLite site manager
+		sm, err := site.NewManager(cfg)
+		if err != nil {
+			return err
+		}
+
+		if err := sm.SetCanonical(domain, policy); err != nil {
+			return err
+		}
+
+		if !cfg.DryRun {
+			fmt.Printf("Canonical host policy of %s set to %s\n", domain, policy)
 		}
+		return nil
+	},
+}
+
+var modifyHeadersCmd = &cobra.Command{
+	Use:   "headers [domain]",
+	Short: "Change the response headers of a site",
+	Long: `Change the header profile of a site and override single headers.
+
+A header profile is a named list of response headers. The built-in profiles are
+basic (nosniff, referrer policy) and strict (adds HSTS, a content security policy,
+a permissions policy and frame-ancestors); more can be defined under
+header_profiles in the config file. Overrides are stored with the site and
+applied on top of its profile.
+
+Examples:
+  caddy-site-manager modify headers example.com --profile strict
+  caddy-site-manager modify headers example.com --set "X-Frame-Options: DENY"
+  caddy-site-manager modify headers example.com --remove X-Powered-By
+  caddy-site-manager modify headers example.com --reset X-Frame-Options`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		domain := args[0]
+
+		profile, _ := cmd.Flags().GetString("profile")
+		set, _ := cmd.Flags().GetStringArray("set")
+		remove, _ := cmd.Flags().GetStringSlice("remove")
+		reset, _ := cmd.Flags().GetStringSlice("reset")
+
+		if profile == "" && len(set) == 0 && len(remove) == 0 && len(reset) == 0 {
+			return fmt.Errorf("nothing to change: use --profile, --set, --remove or --reset")
+		}
+
+		// Create config
+		cfg := newConfig()
 
 		if err := cfg.Validate(); err != nil {
 			return err
@@ -123,7 +212,20 @@ Examples:
 			return err
 		}
 
-		return sm.ListBasicAuth(domain)
+		opts := &site.HeaderOptions{
+			Profile: profile,
+			Set:     set,
+			Remove:  remove,
+			Reset:   reset,
+		}
+		if err := sm.SetHeaders(domain, opts); err != nil {
+			return err
+		}
+
+		if !cfg.DryRun {
+			fmt.Printf("Headers updated for %s\n", domain)
+		}
+		return nil
 	},
 }
 
@@ -132,6 +234,10 @@ var maxUploadCmd = &cobra.Command{
 	Short: "Change maximum upload size for a site",
 	Long: `Change the maximum upload size for both PHP-FPM and Caddy configurations.
 
+The PHP-FPM pool is re-rendered and tested with php-fpm<version> -t before
+PHP-FPM is reloaded; if the test, the reload or Caddy fails, the previous pool
+and size are restored.
+
 The size can be specified in various formats:
 - 100M (megabytes)
 - 2G or 2GB (gigabytes)
@@ -146,14 +252,7 @@ Examples:
 		newSize := args[1]
 
 		// Create config
-		cfg := config.NewCaddyConfig(viper.GetString("caddy-config"))
-		cfg.DryRun = viper.GetBool("dry-run")
-		cfg.Verbose = viper.GetBool("verbose")
-		
-		// Set database path if provided
-		if dbPath := viper.GetString("database"); dbPath != "" {
-			cfg.DatabasePath = dbPath
-		}
+		cfg := newConfig()
 
 		if err := cfg.Validate(); err != nil {
 			return err
@@ -165,7 +264,14 @@ Examples:
 			return err
 		}
 
-		return sm.ModifyMaxUpload(domain, newSize)
+		if err := sm.ModifyMaxUpload(domain, newSize); err != nil {
+			return err
+		}
+
+		if !cfg.DryRun {
+			fmt.Printf("Max upload size updated to %s for %s\n", newSize, domain)
+		}
+		return nil
 	},
 }
 
@@ -174,6 +280,15 @@ func init() {
 	rootCmd.AddCommand(authRemoveCmd)
 	rootCmd.AddCommand(authListCmd)
 	rootCmd.AddCommand(maxUploadCmd)
+	rootCmd.AddCommand(modifyCmd)
+	modifyCmd.AddCommand(modifyCanonicalCmd)
+	modifyCmd.AddCommand(modifyHeadersCmd)
+
+	// Add flags for modify headers command
+	modifyHeadersCmd.Flags().String("profile", "", "Header profile to use, e.g. basic or strict")
+	modifyHeadersCmd.Flags().StringArray("set", nil, "Set a header, \"Name: value\" (repeatable)")
+	modifyHeadersCmd.Flags().StringSlice("remove", nil, "Remove a header from responses (repeatable)")
+	modifyHeadersCmd.Flags().StringSlice("reset", nil, "Drop the override of a header so the profile applies again (repeatable)")
 
 	// Add flags for auth-add command
 	authAddCmd.Flags().StringP("username", "u", "", "Username for basic auth")
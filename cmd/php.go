@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tankadesign/caddy-site-manager/internal/site"
+)
+
+var phpCmd = &cobra.Command{
+	Use:   "php",
+	Short: "Manage php.ini settings of a site and list PHP versions",
+	Long: `Manage php.ini settings of a site's PHP-FPM pool and list the installed PHP
+versions.
+
+Settings are stored with the site and written into its pool, so they survive when
+the pool is rendered again from its template. By default they are written as
+php_admin_value or php_admin_flag, which scripts cannot change with ini_set.`,
+}
+
+var phpSetCmd = &cobra.Command{
+	Use:   "set [domain] [name=value...]",
+	Short: "Set php.ini settings of a site",
+	Long: fmt.Sprintf(`Set php.ini settings of a site, re-render its pool and reload PHP-FPM. The
+configuration is tested with php-fpm<version> -t first; if the test or the reload
+fails, the previous pool and settings are restored.
+
+With --user settings are written as php_value or php_flag, so scripts can change
+them with ini_set. Flags accept on/off, 1/0, true/false and yes/no. Directives that
+are not known are rejected unless --force is given. upload_max_filesize and
+post_max_size follow the max upload size of the site (see modify max-upload).
+
+Known directives: %s
+
+Examples:
+  caddy-site-manager php set example.com memory_limit=1G
+  caddy-site-manager php set example.com max_execution_time=60 display_errors=on
+  caddy-site-manager php set example.com date.timezone=Europe/Berlin --user`,
+		strings.Join(site.PHPSettingNames(), ", ")),
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		domain := args[0]
+
+		user, _ := cmd.Flags().GetBool("user")
+		force, _ := cmd.Flags().GetBool("force")
+
+		// Create config
+		cfg := newConfig()
+
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		// Create SQLite site manager
+		sm, err := site.NewManager(cfg)
+		if err != nil {
+			return err
+		}
+
+		if err := sm.SetPHPSettings(domain, args[1:], &site.PHPSettingOptions{User: user, Force: force}); err != nil {
+			return err
+		}
+
+		if !cfg.DryRun {
+			fmt.Printf("PHP settings updated for %s\n", domain)
+		}
+		return nil
+	},
+}
+
+var phpUnsetCmd = &cobra.Command{
+	Use:   "unset [domain] [name...]",
+	Short: "Remove php.ini settings of a site",
+	Long: `Remove php.ini settings of a site so the defaults of the pool apply again,
+re-render its pool and reload PHP-FPM.
+
+Examples:
+  caddy-site-manager php unset example.com memory_limit
+  caddy-site-manager php unset example.com max_execution_time display_errors`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		domain := args[0]
+
+		// Create config
+		cfg := newConfig()
+
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		// Create SQLite site manager
+		sm, err := site.NewManager(cfg)
+		if err != nil {
+			return err
+		}
+
+		if err := sm.UnsetPHPSettings(domain, args[1:]); err != nil {
+			return err
+		}
+
+		if !cfg.DryRun {
+			fmt.Printf("PHP settings removed from %s\n", domain)
+		}
+		return nil
+	},
+}
+
+var phpListCmd = &cobra.Command{
+	Use:   "list [domain]",
+	Short: "List the effective php.ini settings of a site",
+	Long: `List the php.ini settings of a site's pool with the directive they are written
+with and where they come from: the pool defaults, the site (php set), or other
+site settings (managed).
+
+Examples:
+  caddy-site-manager php list example.com
+  caddy-site-manager php list example.com -o json`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		domain := args[0]
+
+		// Create config
+		cfg := newConfig()
+
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		// Create SQLite site manager
+		sm, err := site.NewManager(cfg)
+		if err != nil {
+			return err
+		}
+
+		settings, err := sm.PHPSettings(domain)
+		if err != nil {
+			return err
+		}
+
+		return renderPHPSettings(settings)
+	},
+}
+
+var phpVersionsCmd = &cobra.Command{
+	Use:   "versions",
+	Short: "List installed PHP versions",
+	Long: `List the PHP versions with PHP-FPM installed in /etc/php and the versions sites
+use, with the number of sites on each and the end of security support. Sites on
+versions past their end of life or on versions that are not installed are warned
+about.
+
+Examples:
+  caddy-site-manager php versions
+  caddy-site-manager php versions -o json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Create config
+		cfg := newConfig()
+
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		// Create SQLite site manager
+		sm, err := site.NewManager(cfg)
+		if err != nil {
+			return err
+		}
+
+		runtimes, err := sm.PHPVersions()
+		if err != nil {
+			return err
+		}
+
+		return renderPHPVersions(runtimes)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(phpCmd)
+	phpCmd.AddCommand(phpSetCmd)
+	phpCmd.AddCommand(phpUnsetCmd)
+	phpCmd.AddCommand(phpListCmd)
+	phpCmd.AddCommand(phpVersionsCmd)
+
+	phpSetCmd.Flags().Bool("user", false, "Write php_value/php_flag so scripts can change the settings with ini_set")
+	phpSetCmd.Flags().Bool("force", false, "Accept directives that are not known")
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tankadesign/caddy-site-manager/internal/site"
+)
+
+var phpVersionCmd = &cobra.Command{
+	Use:   "php-version [domain] [version]",
+	Short: "Switch a site to another PHP version",
+	Long: `Switch a site to another PHP version in place.
+
+The PHP-FPM pool is written for the new version, tested with php-fpm<version> -t
+and PHP-FPM of that version reloaded. Once the new pool runs, the Caddy config
+is regenerated with the new socket and Caddy reloaded; then the old pool is
+removed and PHP-FPM of the old version reloaded. If the new pool fails the test
+or to load, or Caddy rejects the config, the site is left on its previous
+version. A failure to clean up the old pool is only reported as a warning.
+
+Examples:
+  caddy-site-manager php-version example.com 8.3`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		domain := args[0]
+		version := args[1]
+
+		// Create config
+		cfg := newConfig()
+
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		// Create SQLite site manager
+		sm, err := site.NewManager(cfg)
+		if err != nil {
+			return err
+		}
+
+		if err := sm.SwitchPHPVersion(domain, version); err != nil {
+			return err
+		}
+
+		if !cfg.DryRun {
+			fmt.Printf("%s now uses PHP %s\n", domain, version)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(phpVersionCmd)
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/tankadesign/caddy-site-manager/internal/site"
+)
+
+var poolCmd = &cobra.Command{
+	Use:   "pool",
+	Short: "Manage the PHP-FPM pool of a site",
+	Long: `Manage the PHP-FPM pool of a site.
+
+Process manager settings are stored with the site, so they survive when the pool
+is rendered again from its template.`,
+}
+
+var poolSetCmd = &cobra.Command{
+	Use:   "set [domain] [name=value...]",
+	Short: "Change process manager settings of a site",
+	Long: fmt.Sprintf(`Change PHP-FPM process manager settings of a site, re-render its pool and
+reload PHP-FPM. The configuration is tested with php-fpm<version> -t first; if the
+test or the reload fails, the previous pool is restored.
+
+Settings: %s
+
+With pm = dynamic, pm.min_spare_servers <= pm.start_servers <= pm.max_spare_servers
+<= pm.max_children must hold. pm.process_idle_timeout only applies to pm = ondemand.
+
+Examples:
+  caddy-site-manager pool set example.com pm.max_children=40
+  caddy-site-manager pool set example.com pm=ondemand pm.process_idle_timeout=30s
+  caddy-site-manager pool set shop.com pm.start_servers=8 pm.min_spare_servers=4 pm.max_spare_servers=12`,
+		strings.Join(site.PoolSettingNames(), ", ")),
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		domain := args[0]
+
+		// Create config
+		cfg := newConfig()
+
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		// Create SQLite site manager
+		sm, err := site.NewManager(cfg)
+		if err != nil {
+			return err
+		}
+
+		if err := sm.SetPoolSettings(domain, args[1:]); err != nil {
+			return err
+		}
+
+		if !cfg.DryRun {
+			fmt.Printf("PHP-FPM pool settings updated for %s\n", domain)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(poolCmd)
+	poolCmd.AddCommand(poolSetCmd)
+}
@@ -0,0 +1,388 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+	"github.com/tankadesign/caddy-site-manager/internal/output"
+	"github.com/tankadesign/caddy-site-manager/internal/site"
+)
+
+// outputFormat returns the output format selected with --output
+func outputFormat() (output.Format, error) {
+	return output.ParseFormat(viper.GetString("output"))
+}
+
+// showSecrets reports whether --show-secrets was given
+func showSecrets() bool {
+	return viper.GetBool("show-secrets")
+}
+
+// siteType returns the display name of a site's type
+func siteType(s *database.Site) string {
+	return site.DisplayName(s.Type)
+}
+
+// siteStatus returns the display name of a site's status
+func siteStatus(s *database.Site) string {
+	if s.IsEnabled {
+		return "enabled"
+	}
+	return "disabled"
+}
+
+// printCreateResult prints the summary after site creation
+func printCreateResult(result *site.CreateResult) {
+	s := &result.Site
+
+	fmt.Println("")
+	fmt.Println("============================================")
+	fmt.Printf("%s site setup complete!\n", siteType(s))
+	fmt.Println("============================================")
+	fmt.Printf("Domain: %s\n", s.Domain)
+	if s.DocumentRoot != "" {
+		fmt.Printf("Site directory: %s\n", s.DocumentRoot)
+	}
+	if len(s.Upstreams) > 0 {
+		fmt.Printf("Upstreams: %s\n", strings.Join(s.Upstreams, ", "))
+	}
+	if result.PoolConfigFile != "" {
+		fmt.Printf("PHP-FPM Pool: %s\n", s.PoolName)
+		fmt.Printf("PHP-FPM Socket: %s\n", result.PoolSocket)
+	}
+	if s.SystemUser != "" {
+		fmt.Printf("System user: %s\n", s.SystemUser)
+	}
+	fmt.Printf("Configuration: %s\n", result.ConfigFile)
+	fmt.Printf("Enabled via: %s\n", result.Symlink)
+
+	if s.DBName != "" {
+		fmt.Printf("Database: %s\n", s.DBName)
+		fmt.Printf("Database user: %s\n", s.DBUser)
+		fmt.Printf("Database password: %s\n", s.DBPassword)
+	}
+
+	if result.PoolConfigFile != "" {
+		fmt.Println("")
+		fmt.Println("PHP settings:")
+		for _, setting := range result.PHPSettings {
+			fmt.Printf("  %s: %s\n", setting.Name, setting.Value)
+		}
+	}
+	fmt.Println("")
+	fmt.Println("Caddy has been configured and reloaded.")
+
+	for _, step := range result.NextSteps {
+		fmt.Println(step)
+	}
+
+	if s.DBName != "" {
+		fmt.Println("")
+		fmt.Println("Database credentials:")
+		fmt.Printf("  Database Name: %s\n", s.DBName)
+		fmt.Printf("  Username: %s\n", s.DBUser)
+		fmt.Printf("  Password: %s\n", s.DBPassword)
+		fmt.Println("  Database Host: localhost")
+	}
+}
+
+// renderSites writes a site listing in the selected output format
+func renderSites(allSites []database.Site) error {
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+
+	sites := make([]database.Site, 0, len(allSites))
+	rows := output.Rows{Headers: []string{"DOMAIN", "TYPE", "STATUS", "PHP", "MAX UPLOAD", "DOCUMENT ROOT"}}
+	for _, s := range allSites {
+		if !showSecrets() {
+			s = s.Redacted()
+		}
+		sites = append(sites, s)
+		rows.Rows = append(rows.Rows, []string{s.Domain, siteType(&s), siteStatus(&s), s.PHPVersion, s.MaxUpload, s.DocumentRoot})
+	}
+
+	return output.Write(os.Stdout, format, sites, rows)
+}
+
+// renderSiteDetail writes the details of a site in the selected output format
+func renderSiteDetail(detail *site.SiteDetail) error {
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+
+	if !showSecrets() {
+		detail.Site = detail.Site.Redacted()
+	}
+
+	present := map[bool]string{true: "present", false: "missing"}
+	yesNo := map[bool]string{true: "yes", false: "no"}
+
+	symlink := present[false]
+	if detail.SymlinkExists {
+		symlink = "-> " + detail.SymlinkTarget
+		if !detail.SymlinkMatches {
+			symlink += " (does not point to config file)"
+		}
+	}
+
+	documentRoot := detail.DocumentRoot + " (missing)"
+	if detail.DocumentRootExists {
+		documentRoot = fmt.Sprintf("%s (%s)", detail.DocumentRoot, formatSize(detail.DocumentRootSize))
+	}
+
+	rows := output.Rows{Headers: []string{"FIELD", "VALUE"}}
+	add := func(field, value string) {
+		rows.Rows = append(rows.Rows, []string{field, value})
+	}
+	add("Domain", detail.Domain)
+	add("Type", siteType(&detail.Site))
+	add("Status", siteStatus(&detail.Site))
+	add("Status matches enabled-sites", yesNo[detail.EnabledMatches])
+	aliases := "none"
+	if len(detail.Aliases) > 0 {
+		var hostnames []string
+		for _, alias := range detail.Aliases {
+			hostname := alias.Hostname
+			if alias.Redirect {
+				hostname += " (redirect)"
+			}
+			hostnames = append(hostnames, hostname)
+		}
+		aliases = strings.Join(hostnames, ", ")
+	}
+	add("Canonical host", detail.Canonical)
+	add("Header profile", detail.HeaderProfile)
+	if len(detail.HeaderOverrides) > 0 {
+		add("Header overrides", strings.Join(detail.HeaderOverrides, "; "))
+	}
+	add("Aliases", aliases)
+	if detail.DocumentRoot != "" {
+		add("Document root", documentRoot)
+	}
+	if detail.Type == site.TypeStatic {
+		add("SPA fallback", yesNo[detail.SPAFallback])
+	}
+	if len(detail.Upstreams) > 0 {
+		add("Upstreams", strings.Join(detail.Upstreams, ", "))
+		add("LB policy", valueOr(detail.LBPolicy, "default"))
+		add("Health URI", valueOr(detail.HealthURI, "none"))
+	}
+	if detail.Type == site.TypeWordPress {
+		version := detail.WordPressVersion
+		if version == "" {
+			version = "unknown"
+		}
+		add("WordPress version", version)
+	}
+	if detail.PHPVersion != "" {
+		add("PHP version", detail.PHPVersion)
+	}
+	add("Max upload", detail.MaxUpload)
+	if detail.PoolName != "" {
+		add("PHP-FPM pool", detail.PoolName)
+		add("Process manager", processManager(&detail.Site))
+		add("System user", valueOr(detail.SystemUser, "none (shared)"))
+		add("Pool config", fmt.Sprintf("%s (%s)", detail.PoolConfigFile, present[detail.PoolConfigExists]))
+		add("Pool socket", fmt.Sprintf("%s (%s)", detail.PoolSocket, present[detail.PoolSocketExists]))
+	}
+	if detail.CaddyTemplate != "" {
+		add("Caddy template", detail.CaddyTemplate)
+	}
+	if detail.PoolTemplate != "" {
+		add("Pool template", detail.PoolTemplate)
+	}
+	configFile := present[detail.ConfigFileExists]
+	if detail.ConfigFileModified {
+		configFile += ", edited by hand"
+	}
+	add("Config file", fmt.Sprintf("%s (%s)", detail.ConfigFile, configFile))
+	if detail.ExtraDirectives != "" {
+		add("Extra directives", fmt.Sprintf("%d line(s)", strings.Count(detail.ExtraDirectives, "\n")+1))
+	}
+	add("Symlink", fmt.Sprintf("%s %s", detail.Symlink, symlink))
+	if detail.DBName != "" {
+		add("Database", detail.DBName)
+		add("Database user", detail.DBUser)
+		add("Database password", detail.DBPassword)
+	}
+	basicAuth := "none"
+	if len(detail.BasicAuthPaths) > 0 {
+		basicAuth = strings.Join(detail.BasicAuthPaths, ", ")
+	}
+	add("Basic auth paths", basicAuth)
+	add("Created", detail.CreatedAt.Format("2006-01-02 15:04:05"))
+	add("Updated", detail.UpdatedAt.Format("2006-01-02 15:04:05"))
+
+	return output.Write(os.Stdout, format, detail, rows)
+}
+
+// valueOr returns value, or fallback when value is empty
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// processManager summarizes the PHP-FPM process manager settings of a site
+func processManager(s *database.Site) string {
+	switch s.PM {
+	case site.PMDynamic:
+		return fmt.Sprintf("%s (max %d children, start %d, %d-%d spare, %d requests per child)",
+			s.PM, s.PMMaxChildren, s.PMStartServers, s.PMMinSpareServers, s.PMMaxSpareServers, s.PMMaxRequests)
+	case site.PMOndemand:
+		return fmt.Sprintf("%s (max %d children, idle timeout %s, %d requests per child)",
+			s.PM, s.PMMaxChildren, s.PMProcessIdleTimeout, s.PMMaxRequests)
+	}
+	return fmt.Sprintf("%s (%d children, %d requests per child)", s.PM, s.PMMaxChildren, s.PMMaxRequests)
+}
+
+// renderBasicAuth writes the basic auth entries of a site in the selected
+// output format
+func renderBasicAuth(siteWithAuth *database.SiteWithAuth) error {
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+
+	if !showSecrets() {
+		*siteWithAuth = siteWithAuth.Redacted()
+	} else if siteWithAuth.BasicAuths == nil {
+		siteWithAuth.BasicAuths = []database.BasicAuth{}
+	}
+
+	if format == output.Table && len(siteWithAuth.BasicAuths) == 0 {
+		fmt.Printf("No basic authentication configured for %s\n", siteWithAuth.Domain)
+		return nil
+	}
+
+	rows := output.Rows{Headers: []string{"DOMAIN", "PATH", "USERNAME"}}
+	if showSecrets() {
+		rows.Headers = append(rows.Headers, "PASSWORD HASH")
+	}
+	for _, auth := range siteWithAuth.BasicAuths {
+		row := []string{siteWithAuth.Domain, auth.Path, auth.Username}
+		if showSecrets() {
+			row = append(row, auth.Password)
+		}
+		rows.Rows = append(rows.Rows, row)
+	}
+
+	return output.Write(os.Stdout, format, siteWithAuth, rows)
+}
+
+// renderAliases writes the aliases of a site in the selected output format
+func renderAliases(domain string, aliases []database.SiteAlias) error {
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+
+	if format == output.Table && len(aliases) == 0 {
+		fmt.Printf("No aliases configured for %s\n", domain)
+		return nil
+	}
+
+	rows := output.Rows{Headers: []string{"DOMAIN", "ALIAS", "MODE"}}
+	for _, alias := range aliases {
+		mode := "serve"
+		if alias.Redirect {
+			mode = "redirect"
+		}
+		rows.Rows = append(rows.Rows, []string{domain, alias.Hostname, mode})
+	}
+
+	return output.Write(os.Stdout, format, aliases, rows)
+}
+
+// renderPHPSettings writes the effective PHP settings of a site in the
+// selected output format
+func renderPHPSettings(settings []site.PHPSetting) error {
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+
+	rows := output.Rows{Headers: []string{"NAME", "VALUE", "DIRECTIVE", "SOURCE"}}
+	for _, setting := range settings {
+		rows.Rows = append(rows.Rows, []string{setting.Name, setting.Value, setting.Directive, setting.Source})
+	}
+
+	return output.Write(os.Stdout, format, settings, rows)
+}
+
+// renderPHPVersions writes the PHP versions in the selected output format and
+// warns about sites on versions past their end of life
+func renderPHPVersions(runtimes []site.PHPRuntime) error {
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+
+	rows := output.Rows{Headers: []string{"VERSION", "INSTALLED", "REPORTED", "SITES", "END OF LIFE"}}
+	for _, r := range runtimes {
+		installed := "no"
+		if r.Installed {
+			installed = "yes"
+		}
+		eol := valueOr(r.EndOfLife, "unknown")
+		if r.Unsupported {
+			eol += " (reached)"
+		}
+		rows.Rows = append(rows.Rows, []string{r.Version, installed, valueOr(r.Reported, "-"), strconv.Itoa(r.Sites), eol})
+	}
+
+	if err := output.Write(os.Stdout, format, runtimes, rows); err != nil {
+		return err
+	}
+
+	for _, r := range runtimes {
+		if r.Unsupported && r.Sites > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %d site(s) run on PHP %s, which reached end of life on %s.\n", r.Sites, r.Version, r.EndOfLife)
+		}
+		if !r.Installed && r.Sites > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %d site(s) use PHP %s, which is not installed.\n", r.Sites, r.Version)
+		}
+	}
+	return nil
+}
+
+// renderTemplates writes the available templates in the selected output format
+func renderTemplates(templates []site.TemplateInfo) error {
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+
+	rows := output.Rows{Headers: []string{"NAME", "SOURCE", "PATH"}}
+	for _, t := range templates {
+		path := t.Path
+		if path == "" {
+			path = "-"
+		}
+		rows.Rows = append(rows.Rows, []string{t.Name, t.Source, path})
+	}
+
+	return output.Write(os.Stdout, format, templates, rows)
+}
+
+// formatSize formats a byte count for humans
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/tankadesign/caddy-site-manager/internal/config"
 )
 
 var (
@@ -32,12 +33,26 @@ func init() {
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Enable verbose output")
 	rootCmd.PersistentFlags().BoolP("dry-run", "n", false, "Show what would be done without executing")
 	rootCmd.PersistentFlags().String("database", "", "Path to SQLite database file (default: caddy-config-dir/caddy-sites.db)")
+	rootCmd.PersistentFlags().String("key-file", "", "Path to the credential encryption key (default: caddy-config-dir/site-manager.key, or $CADDY_SITE_MANAGER_KEY)")
+	rootCmd.PersistentFlags().String("template-dir", "", "Directory with user templates overriding the built-in ones (default: caddy-config-dir/site-manager/templates)")
+	rootCmd.PersistentFlags().StringP("output", "o", "table", "Output format for listings: table, json, yaml or csv")
+	rootCmd.PersistentFlags().Bool("show-secrets", false, "Include passwords and password hashes in listings")
+	rootCmd.PersistentFlags().String("reload-method", "systemctl", "How to reload Caddy: systemctl, or api to load the Caddyfile through the admin API")
+	rootCmd.PersistentFlags().String("admin-address", "localhost:2019", "Address of the Caddy admin API used by --reload-method=api")
+	rootCmd.PersistentFlags().String("root", "", "Prefix all managed paths with this directory (stage a server layout without touching the host)")
 
 	// Bind flags to viper
 	viper.BindPFlag("caddy-config", rootCmd.PersistentFlags().Lookup("caddy-config"))
 	viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose"))
 	viper.BindPFlag("dry-run", rootCmd.PersistentFlags().Lookup("dry-run"))
 	viper.BindPFlag("database", rootCmd.PersistentFlags().Lookup("database"))
+	viper.BindPFlag("key-file", rootCmd.PersistentFlags().Lookup("key-file"))
+	viper.BindPFlag("template-dir", rootCmd.PersistentFlags().Lookup("template-dir"))
+	viper.BindPFlag("output", rootCmd.PersistentFlags().Lookup("output"))
+	viper.BindPFlag("show-secrets", rootCmd.PersistentFlags().Lookup("show-secrets"))
+	viper.BindPFlag("reload-method", rootCmd.PersistentFlags().Lookup("reload-method"))
+	viper.BindPFlag("admin-address", rootCmd.PersistentFlags().Lookup("admin-address"))
+	viper.BindPFlag("root", rootCmd.PersistentFlags().Lookup("root"))
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -61,3 +76,52 @@ func initConfig() {
 		}
 	}
 }
+
+// newConfig builds the Caddy configuration from the global flags and config file
+func newConfig() *config.CaddyConfig {
+	cfg := config.NewCaddyConfig(viper.GetString("caddy-config"))
+	cfg.Root = viper.GetString("root")
+	cfg.DryRun = viper.GetBool("dry-run")
+	cfg.Verbose = viper.GetBool("verbose")
+	cfg.ReloadMethod = viper.GetString("reload-method")
+	cfg.AdminAddress = viper.GetString("admin-address")
+
+	// Set database path if provided
+	if dbPath := viper.GetString("database"); dbPath != "" {
+		cfg.DatabasePath = dbPath
+	}
+
+	// Set encryption key file if provided
+	if keyFile := viper.GetString("key-file"); keyFile != "" {
+		cfg.KeyFile = keyFile
+	}
+
+	// Header profiles can only be defined in the config file
+	if err := viper.UnmarshalKey("header_profiles", &cfg.HeaderProfiles); err != nil {
+		cobra.CheckErr(fmt.Errorf("invalid header_profiles in config file: %v", err))
+	}
+
+	// File ownership can only be set in the config file
+	if owner := viper.GetString("site_owner"); owner != "" {
+		cfg.SiteOwner = owner
+	}
+	if group := viper.GetString("site_group"); group != "" {
+		cfg.SiteGroup = group
+	}
+	if group := viper.GetString("caddy_group"); group != "" {
+		cfg.CaddyGroup = group
+	}
+
+	// MySQL connection settings can only be set in the config file
+	cfg.MySQLSocket = viper.GetString("mysql_socket")
+	cfg.MySQLHost = viper.GetString("mysql_host")
+	cfg.MySQLUser = viper.GetString("mysql_user")
+	cfg.MySQLCredentialsFile = viper.GetString("mysql_credentials_file")
+
+	// Set template directory if provided
+	if templateDir := viper.GetString("template-dir"); templateDir != "" {
+		cfg.TemplateDir = templateDir
+	}
+
+	return cfg
+}
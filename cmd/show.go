@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/tankadesign/caddy-site-manager/internal/site"
+)
+
+var showCmd = &cobra.Command{
+	Use:   "show [domain]",
+	Short: "Show all details and the live status of a site",
+	Long: `Show everything stored for a site together with its live status on the host:
+the PHP-FPM pool config and socket, whether the config file in available-sites and the
+symlink in enabled-sites exist and match the database, the document root size, the
+installed WordPress version and the paths protected by basic auth.
+
+Examples:
+  caddy-site-manager show example.com
+  caddy-site-manager show blog.com --output json`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		domain := args[0]
+
+		// Create config
+		cfg := newConfig()
+
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		// Create SQLite site manager
+		sm, err := site.NewManager(cfg)
+		if err != nil {
+			return err
+		}
+
+		detail, err := sm.ShowSite(domain)
+		if err != nil {
+			return err
+		}
+
+		return renderSiteDetail(detail)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(showCmd)
+}
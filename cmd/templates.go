@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tankadesign/caddy-site-manager/internal/site"
+)
+
+var templatesCmd = &cobra.Command{
+	Use:   "templates",
+	Short: "Manage the Caddy and PHP-FPM templates",
+	Long: `Manage the templates Caddy configs and PHP-FPM pools are generated from.
+
+Built-in templates are embedded in the binary. A file <name>.tmpl in the template
+directory (default /etc/caddy/site-manager/templates) overrides the built-in
+template of the same name, e.g. caddy/php.tmpl or php-fpm/pool.tmpl. Any other
+template in caddy/ or php-fpm/ can be selected per site with create --caddy-template
+or --pool-template.`,
+}
+
+var templatesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the available templates",
+	Long: `List all built-in and user templates and where they are read from.
+
+Examples:
+  caddy-site-manager templates list
+  caddy-site-manager templates list -o json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := newConfig()
+
+		templates, err := site.NewTemplateStore(cfg.Path(cfg.TemplateDir)).List()
+		if err != nil {
+			return err
+		}
+
+		return renderTemplates(templates)
+	},
+}
+
+var templatesShowCmd = &cobra.Command{
+	Use:   "show [name]",
+	Short: "Show the text of a template",
+	Long: `Print the text of the template that is used for a name, which is the user
+template if there is one and the built-in template otherwise. The output of a
+built-in template is a good starting point for an override.
+
+Examples:
+  caddy-site-manager templates show caddy/php
+  caddy-site-manager templates show php-fpm/pool > /etc/caddy/site-manager/templates/php-fpm/pool.tmpl`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := newConfig()
+
+		_, text, err := site.NewTemplateStore(cfg.Path(cfg.TemplateDir)).Source(args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Print(text)
+		return nil
+	},
+}
+
+var templatesValidateCmd = &cobra.Command{
+	Use:   "validate [name...]",
+	Short: "Check templates for errors",
+	Long: `Parse templates and render them with sample data, which reports syntax errors
+and references to fields that do not exist. Without names all templates are checked.
+
+Examples:
+  caddy-site-manager templates validate
+  caddy-site-manager templates validate caddy/php`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg := newConfig()
+		store := site.NewTemplateStore(cfg.Path(cfg.TemplateDir))
+
+		names := args
+		if len(names) == 0 {
+			templates, err := store.List()
+			if err != nil {
+				return err
+			}
+			for _, t := range templates {
+				names = append(names, t.Name)
+			}
+		}
+
+		failed := 0
+		for _, name := range names {
+			if _, err := store.Load(name); err != nil {
+				fmt.Printf("FAIL  %v\n", err)
+				failed++
+				continue
+			}
+			fmt.Printf("OK    %s\n", name)
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d templates are invalid", failed, len(names))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(templatesCmd)
+	templatesCmd.AddCommand(templatesListCmd)
+	templatesCmd.AddCommand(templatesShowCmd)
+	templatesCmd.AddCommand(templatesValidateCmd)
+}
@@ -6,8 +6,19 @@ import (
 	"path/filepath"
 )
 
+// Ways of reloading Caddy after its configuration changed
+const (
+	// ReloadSystemd reloads the caddy service with systemctl
+	ReloadSystemd = "systemctl"
+	// ReloadAdminAPI loads the Caddyfile through the Caddy admin API
+	ReloadAdminAPI = "api"
+)
+
 // CaddyConfig represents the configuration for Caddy management
+// All paths are host paths; when Root is set every file operation is
+// performed below Root instead (see Path).
 type CaddyConfig struct {
+	Root           string
 	ConfigDir      string
 	AvailableSites string
 	EnabledSites   string
@@ -15,6 +26,27 @@ type CaddyConfig struct {
 	WebRoot        string
 	PHPVersion     string
 	DatabasePath   string
+	KeyFile        string
+	TemplateDir    string
+	ReloadMethod   string
+	AdminAddress   string
+	// SiteOwner and SiteGroup own the files of sites without their own
+	// system user
+	SiteOwner string
+	SiteGroup string
+	// CaddyGroup is the group Caddy runs as, through which it reads the
+	// files of isolated sites
+	CaddyGroup string
+	// MySQL connection of the database provisioner. Empty settings are
+	// read from MySQLCredentialsFile, a my.cnf style file with a [client]
+	// section, or else default to root over the local socket.
+	MySQLSocket          string
+	MySQLHost            string
+	MySQLUser            string
+	MySQLCredentialsFile string
+	// HeaderProfiles are named lists of response headers ("Name: value")
+	// from the config file, in addition to the built-in profiles
+	HeaderProfiles map[string][]string
 	DryRun         bool
 	Verbose        bool
 }
@@ -29,20 +61,48 @@ func NewCaddyConfig(configDir string) *CaddyConfig {
 		WebRoot:        "/var/www",
 		PHPVersion:     "8.2",
 		DatabasePath:   filepath.Join(configDir, "caddy-sites.db"),
+		KeyFile:        filepath.Join(configDir, "site-manager.key"),
+		TemplateDir:    filepath.Join(configDir, "site-manager", "templates"),
+		ReloadMethod:   ReloadSystemd,
+		AdminAddress:   "localhost:2019",
+		SiteOwner:      "ubuntu",
+		SiteGroup:      "www-data",
+		CaddyGroup:     "caddy",
 		DryRun:         false,
 		Verbose:        false,
 	}
 }
 
+// Path maps a host path to the path actually used for file operations.
+// Without a root prefix this is the path itself; with one it is the same
+// path below Root, so a complete server layout can be staged elsewhere.
+func (c *CaddyConfig) Path(hostPath string) string {
+	if c.Root == "" {
+		return hostPath
+	}
+	return filepath.Join(c.Root, hostPath)
+}
+
 // Validate checks if the configuration is valid
 func (c *CaddyConfig) Validate() error {
+	if c.ReloadMethod != ReloadSystemd && c.ReloadMethod != ReloadAdminAPI {
+		return fmt.Errorf("invalid reload method %q (use %s or %s)", c.ReloadMethod, ReloadSystemd, ReloadAdminAPI)
+	}
+
+	// A staged layout starts out empty, so create the config directory there
+	if c.Root != "" {
+		if err := os.MkdirAll(c.Path(c.ConfigDir), 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %v", c.Path(c.ConfigDir), err)
+		}
+	}
+
 	// Check if Caddy config directory exists
-	if _, err := os.Stat(c.ConfigDir); os.IsNotExist(err) {
-		return fmt.Errorf("caddy config directory does not exist: %s", c.ConfigDir)
+	if _, err := os.Stat(c.Path(c.ConfigDir)); os.IsNotExist(err) {
+		return fmt.Errorf("caddy config directory does not exist: %s", c.Path(c.ConfigDir))
 	}
 
 	// Create directories if they don't exist
-	dirs := []string{c.AvailableSites, c.EnabledSites}
+	dirs := []string{c.Path(c.AvailableSites), c.Path(c.EnabledSites)}
 	for _, dir := range dirs {
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return fmt.Errorf("failed to create directory %s: %v", dir, err)
@@ -55,6 +115,9 @@ func (c *CaddyConfig) Validate() error {
 // PrintConfig prints the current configuration if verbose mode is enabled
 func (c *CaddyConfig) PrintConfig() {
 	if c.Verbose {
+		if c.Root != "" {
+			fmt.Printf("Root Prefix: %s\n", c.Root)
+		}
 		fmt.Printf("Caddy Config Directory: %s\n", c.ConfigDir)
 		fmt.Printf("Available Sites: %s\n", c.AvailableSites)
 		fmt.Printf("Enabled Sites: %s\n", c.EnabledSites)
@@ -62,6 +125,26 @@ func (c *CaddyConfig) PrintConfig() {
 		fmt.Printf("Web Root: %s\n", c.WebRoot)
 		fmt.Printf("PHP Version: %s\n", c.PHPVersion)
 		fmt.Printf("Database Path: %s\n", c.DatabasePath)
+		fmt.Printf("Key File: %s\n", c.KeyFile)
+		fmt.Printf("Template Directory: %s\n", c.TemplateDir)
+		fmt.Printf("Site Owner: %s:%s\n", c.SiteOwner, c.SiteGroup)
+		fmt.Printf("Caddy Group: %s\n", c.CaddyGroup)
+		if c.MySQLHost != "" {
+			fmt.Printf("MySQL Host: %s\n", c.MySQLHost)
+		}
+		if c.MySQLSocket != "" {
+			fmt.Printf("MySQL Socket: %s\n", c.MySQLSocket)
+		}
+		if c.MySQLUser != "" {
+			fmt.Printf("MySQL User: %s\n", c.MySQLUser)
+		}
+		if c.MySQLCredentialsFile != "" {
+			fmt.Printf("MySQL Credentials File: %s\n", c.MySQLCredentialsFile)
+		}
+		fmt.Printf("Reload Method: %s\n", c.ReloadMethod)
+		if c.ReloadMethod == ReloadAdminAPI {
+			fmt.Printf("Admin API: %s\n", c.AdminAddress)
+		}
 		fmt.Printf("Dry Run: %t\n", c.DryRun)
 		fmt.Printf("Verbose: %t\n", c.Verbose)
 	}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPath(t *testing.T) {
+	cfg := NewCaddyConfig("/etc/caddy")
+	if got := cfg.Path("/etc/php/8.3/fpm/pool.d"); got != "/etc/php/8.3/fpm/pool.d" {
+		t.Errorf("Path() without root = %s", got)
+	}
+
+	cfg.Root = "/tmp/stage"
+	for hostPath, want := range map[string]string{
+		"/etc/php/8.3/fpm/pool.d": "/tmp/stage/etc/php/8.3/fpm/pool.d",
+		"/var/www/sites/a.com":    "/tmp/stage/var/www/sites/a.com",
+		"/etc/caddy/../../x":      "/tmp/stage/x",
+	} {
+		if got := cfg.Path(hostPath); got != want {
+			t.Errorf("Path(%s) = %s, want %s", hostPath, got, want)
+		}
+	}
+}
+
+func TestValidateCreatesLayoutBelowRoot(t *testing.T) {
+	cfg := NewCaddyConfig("/etc/caddy")
+	cfg.Root = t.TempDir()
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{"/etc/caddy", "/etc/caddy/available-sites", "/etc/caddy/enabled-sites"} {
+		if info, err := os.Stat(filepath.Join(cfg.Root, dir)); err != nil || !info.IsDir() {
+			t.Errorf("Validate() did not create %s below the root: %v", dir, err)
+		}
+	}
+}
+
+func TestValidateReloadMethod(t *testing.T) {
+	cfg := NewCaddyConfig("/etc/caddy")
+	cfg.Root = t.TempDir()
+	cfg.ReloadMethod = "restart"
+	if err := cfg.Validate(); err == nil {
+		t.Error("invalid reload method was accepted")
+	}
+}
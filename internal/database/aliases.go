@@ -0,0 +1,87 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CreateAlias stores an additional hostname for a site
+func (db *DB) CreateAlias(alias *SiteAlias) error {
+	alias.CreatedAt = time.Now()
+
+	query := `INSERT INTO site_aliases (site_id, hostname, redirect, created_at) VALUES (?, ?, ?, ?)`
+	result, err := db.conn.Exec(query, alias.SiteID, alias.Hostname, alias.Redirect, alias.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create alias: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get alias ID: %v", err)
+	}
+
+	alias.ID = int(id)
+	return nil
+}
+
+// GetAliases retrieves all aliases of a site
+func (db *DB) GetAliases(siteID int) ([]SiteAlias, error) {
+	query := `SELECT id, site_id, hostname, redirect, created_at
+		FROM site_aliases WHERE site_id = ? ORDER BY hostname`
+
+	rows, err := db.conn.Query(query, siteID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get aliases: %v", err)
+	}
+	defer rows.Close()
+
+	var aliases []SiteAlias
+	for rows.Next() {
+		var alias SiteAlias
+		if err := rows.Scan(&alias.ID, &alias.SiteID, &alias.Hostname, &alias.Redirect, &alias.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan alias: %v", err)
+		}
+		aliases = append(aliases, alias)
+	}
+
+	return aliases, nil
+}
+
+// DeleteAlias removes an alias from a site
+func (db *DB) DeleteAlias(siteID int, hostname string) error {
+	result, err := db.conn.Exec(`DELETE FROM site_aliases WHERE site_id = ? AND hostname = ?`, siteID, hostname)
+	if err != nil {
+		return fmt.Errorf("failed to delete alias: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("alias %s not found", hostname)
+	}
+
+	return nil
+}
+
+// HostnameOwner returns the domain of the site a hostname belongs to, either
+// as its primary domain or as an alias. It returns an empty string if the
+// hostname is not in use.
+func (db *DB) HostnameOwner(hostname string) (string, error) {
+	query := `SELECT domain FROM sites WHERE domain = ?
+		UNION
+		SELECT s.domain FROM site_aliases a JOIN sites s ON s.id = a.site_id WHERE a.hostname = ?`
+
+	var domain string
+	err := db.conn.QueryRow(query, hostname, hostname).Scan(&domain)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up hostname: %v", err)
+	}
+	return domain, nil
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/tankadesign/caddy-site-manager/internal/secrets"
+)
+
+// SetCipher enables encryption of stored credentials. Credentials stored in
+// plaintext by older versions are encrypted by a schema migration, which is
+// only applied once a cipher is set.
+func (db *DB) SetCipher(cipher *secrets.Cipher) {
+	db.cipher = cipher
+}
+
+// sealCredential encrypts a credential for storage when a cipher is configured
+func (db *DB) sealCredential(value string) (string, error) {
+	if db.cipher == nil || value == "" || secrets.IsEncrypted(value) {
+		return value, nil
+	}
+	sealed, err := db.cipher.Encrypt(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt credential: %v", err)
+	}
+	return sealed, nil
+}
+
+// openCredential decrypts a stored credential
+func (db *DB) openCredential(value string) (string, error) {
+	if !secrets.IsEncrypted(value) {
+		return value, nil
+	}
+	if db.cipher == nil {
+		return "", fmt.Errorf("database contains encrypted credentials but no encryption key is configured")
+	}
+	return db.cipher.Decrypt(value)
+}
+
+// storedCredential is the raw db_password column of a site
+type storedCredential struct {
+	id    int
+	value string
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// storedCredentials returns the raw db_password values of all sites
+func storedCredentials(q querier) ([]storedCredential, error) {
+	rows, err := q.Query(`SELECT id, COALESCE(db_password, '') FROM sites`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials: %v", err)
+	}
+	defer rows.Close()
+
+	var credentials []storedCredential
+	for rows.Next() {
+		var c storedCredential
+		if err := rows.Scan(&c.id, &c.value); err != nil {
+			return nil, fmt.Errorf("failed to scan credentials: %v", err)
+		}
+		credentials = append(credentials, c)
+	}
+	return credentials, rows.Err()
+}
+
+// encryptPlaintextCredentials encrypts every credential still stored in
+// plaintext. It runs as a schema migration, so it is recorded once it ran.
+func (db *DB) encryptPlaintextCredentials(tx *sql.Tx) error {
+	credentials, err := storedCredentials(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range credentials {
+		if c.value == "" || secrets.IsEncrypted(c.value) {
+			continue
+		}
+		sealed, err := db.sealCredential(c.value)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE sites SET db_password = ? WHERE id = ?`, sealed, c.id); err != nil {
+			return fmt.Errorf("failed to encrypt credentials of site %d: %v", c.id, err)
+		}
+	}
+	return nil
+}
+
+// Rekey re-encrypts all stored credentials with a new cipher in a single
+// transaction and returns the number of credentials that were re-encrypted
+func (db *DB) Rekey(newCipher *secrets.Cipher) (int, error) {
+	credentials, err := storedCredentials(db.conn)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	count := 0
+	for _, c := range credentials {
+		if c.value == "" {
+			continue
+		}
+		plaintext, err := db.openCredential(c.value)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt credentials of site %d: %v", c.id, err)
+		}
+		sealed, err := newCipher.Encrypt(plaintext)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(`UPDATE sites SET db_password = ? WHERE id = ?`, sealed, c.id); err != nil {
+			return 0, fmt.Errorf("failed to re-encrypt credentials of site %d: %v", c.id, err)
+		}
+		count++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit re-encrypted credentials: %v", err)
+	}
+
+	db.cipher = newCipher
+	return count, nil
+}
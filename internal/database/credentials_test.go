@@ -0,0 +1,146 @@
+package database
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tankadesign/caddy-site-manager/internal/secrets"
+)
+
+func newTestCipher(t *testing.T) *secrets.Cipher {
+	t.Helper()
+	key, err := secrets.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := secrets.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// openTestDB opens a migrated database in a temporary directory
+func openTestDB(t *testing.T, path string, cipher *secrets.Cipher) *DB {
+	t.Helper()
+	db, err := NewDB(path, cipher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// storedPassword returns the raw db_password column of a site
+func storedPassword(t *testing.T, db *DB, domain string) string {
+	t.Helper()
+	var value string
+	if err := db.conn.QueryRow(`SELECT db_password FROM sites WHERE domain = ?`, domain).Scan(&value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestCredentialsAreEncrypted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sites.db")
+	cipher := newTestCipher(t)
+	db := openTestDB(t, path, cipher)
+
+	if err := db.CreateSite(&Site{Domain: "example.com", DBPassword: "s3cr3t"}); err != nil {
+		t.Fatal(err)
+	}
+	if stored := storedPassword(t, db, "example.com"); !secrets.IsEncrypted(stored) {
+		t.Errorf("db_password stored as %q, want it encrypted", stored)
+	}
+
+	site, err := db.GetSite("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if site.DBPassword != "s3cr3t" {
+		t.Errorf("DBPassword = %q, want s3cr3t", site.DBPassword)
+	}
+
+	// Opened with another key the credential cannot be read
+	db.SetCipher(newTestCipher(t))
+	if _, err := db.GetSite("example.com"); err == nil || !strings.Contains(err.Error(), "wrong key?") {
+		t.Errorf("GetSite() with another key error = %v", err)
+	}
+	db.SetCipher(nil)
+	if _, err := db.GetSite("example.com"); err == nil || !strings.Contains(err.Error(), "no encryption key") {
+		t.Errorf("GetSite() without a key error = %v", err)
+	}
+}
+
+func TestRekey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sites.db")
+	db := openTestDB(t, path, newTestCipher(t))
+
+	for _, site := range []*Site{
+		{Domain: "example.com", DBPassword: "one"},
+		{Domain: "example.org", DBPassword: "two"},
+		{Domain: "static.example.com"},
+	} {
+		if err := db.CreateSite(site); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := storedPassword(t, db, "example.com")
+
+	newCipher := newTestCipher(t)
+	count, err := db.Rekey(newCipher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("Rekey() re-encrypted %d credentials, want 2", count)
+	}
+	if after := storedPassword(t, db, "example.com"); after == before || !secrets.IsEncrypted(after) {
+		t.Errorf("db_password = %q after rekey, want a new encrypted value", after)
+	}
+	if _, err := newCipher.Decrypt(storedPassword(t, db, "example.org")); err != nil {
+		t.Errorf("credential is not readable with the new key: %v", err)
+	}
+
+	site, err := db.GetSite("example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if site.DBPassword != "two" {
+		t.Errorf("DBPassword = %q after rekey, want two", site.DBPassword)
+	}
+}
+
+func TestEncryptCredentialsMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sites.db")
+
+	// Without a key the migration stays pending and credentials are
+	// stored the way older versions did
+	db := openTestDB(t, path, nil)
+	if err := db.CreateSite(&Site{Domain: "example.com", DBPassword: "legacy"}); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := db.SchemaVersion(); err != nil || version != 12 {
+		t.Fatalf("SchemaVersion() = %d, %v without a key, want 12", version, err)
+	}
+	db.Close()
+
+	cipher := newTestCipher(t)
+	db = openTestDB(t, path, cipher)
+	if version, err := db.SchemaVersion(); err != nil || version != LatestSchemaVersion() {
+		t.Fatalf("SchemaVersion() = %d, %v, want %d", version, err, LatestSchemaVersion())
+	}
+	stored := storedPassword(t, db, "example.com")
+	if plaintext, err := cipher.Decrypt(stored); !secrets.IsEncrypted(stored) || err != nil || plaintext != "legacy" {
+		t.Errorf("db_password = %q (%q, %v) after the migration, want legacy encrypted", stored, plaintext, err)
+	}
+
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := statuses[len(statuses)-1]; !last.Applied() || last.Description != "encrypt stored database credentials" {
+		t.Errorf("last migration = %+v, want the applied credential encryption", last)
+	}
+}
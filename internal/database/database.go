@@ -5,19 +5,42 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/tankadesign/caddy-site-manager/internal/secrets"
 )
 
 // DB represents the database connection
 type DB struct {
-	conn *sql.DB
-	path string
+	conn   *sql.DB
+	path   string
+	cipher *secrets.Cipher
 }
 
-// NewDB creates a new database connection
-func NewDB(dbPath string) (*DB, error) {
+// NewDB creates a new database connection and brings the schema up to date.
+// Stored credentials are encrypted with cipher, which may be nil when no
+// encryption key is available.
+func NewDB(dbPath string, cipher *secrets.Cipher) (*DB, error) {
+	db, err := OpenDB(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	db.SetCipher(cipher)
+
+	// Apply pending schema migrations
+	if _, err := db.Migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database schema: %v", err)
+	}
+
+	return db, nil
+}
+
+// OpenDB creates a new database connection without applying pending
+// migrations. It fails if the database was written by a newer binary.
+func OpenDB(dbPath string) (*DB, error) {
 	// Ensure the directory exists
 	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
 		return nil, fmt.Errorf("failed to create database directory: %v", err)
@@ -33,9 +56,22 @@ func NewDB(dbPath string) (*DB, error) {
 		path: dbPath,
 	}
 
-	// Initialize the database schema
-	if err := db.initSchema(); err != nil {
-		return nil, fmt.Errorf("failed to initialize database schema: %v", err)
+	// Make sure migrations can be tracked
+	if err := db.initMigrations(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// The database holds credentials, keep it private to its owner
+	if err := os.Chmod(dbPath, 0600); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to restrict database permissions: %v", err)
+	}
+
+	// Refuse databases migrated by a newer binary
+	if err := db.checkSchemaVersion(); err != nil {
+		db.Close()
+		return nil, err
 	}
 
 	return db, nil
@@ -46,50 +82,6 @@ func (db *DB) Close() error {
 	return db.conn.Close()
 }
 
-// initSchema creates the necessary tables
-func (db *DB) initSchema() error {
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS sites (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			domain TEXT UNIQUE NOT NULL,
-			document_root TEXT NOT NULL,
-			php_version TEXT NOT NULL DEFAULT '8.1',
-			is_wordpress BOOLEAN NOT NULL DEFAULT FALSE,
-			is_enabled BOOLEAN NOT NULL DEFAULT FALSE,
-			max_upload TEXT NOT NULL DEFAULT '256M',
-			db_name TEXT,
-			db_user TEXT,
-			db_password TEXT,
-			pool_name TEXT NOT NULL,
-			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
-		)`,
-		`CREATE TABLE IF NOT EXISTS basic_auths (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			site_id INTEGER NOT NULL,
-			path TEXT NOT NULL,
-			username TEXT NOT NULL,
-			password TEXT NOT NULL,
-			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			FOREIGN KEY (site_id) REFERENCES sites(id) ON DELETE CASCADE,
-			UNIQUE(site_id, path, username)
-		)`,
-		`CREATE INDEX IF NOT EXISTS idx_sites_domain ON sites(domain)`,
-		`CREATE INDEX IF NOT EXISTS idx_sites_enabled ON sites(is_enabled)`,
-		`CREATE INDEX IF NOT EXISTS idx_basic_auths_site_id ON basic_auths(site_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_basic_auths_path ON basic_auths(site_id, path)`,
-	}
-
-	for _, query := range queries {
-		if _, err := db.conn.Exec(query); err != nil {
-			return fmt.Errorf("failed to execute schema query: %v", err)
-		}
-	}
-
-	return nil
-}
-
 // Site operations
 
 // CreateSite creates a new site in the database
@@ -97,15 +89,28 @@ func (db *DB) CreateSite(site *Site) error {
 	site.CreatedAt = time.Now()
 	site.UpdatedAt = time.Now()
 
+	dbPassword, err := db.sealCredential(site.DBPassword)
+	if err != nil {
+		return err
+	}
+
 	query := `INSERT INTO sites (
-		domain, document_root, php_version, is_wordpress, is_enabled, max_upload,
-		db_name, db_user, db_password, pool_name, created_at, updated_at
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		domain, document_root, php_version, site_type, is_enabled, max_upload,
+		db_name, db_user, db_password, pool_name, canonical, upstreams, lb_policy, health_uri,
+		spa_fallback, caddy_template, pool_template, header_profile, header_overrides,
+		pm, pm_max_children, pm_start_servers, pm_min_spare_servers, pm_max_spare_servers,
+		pm_max_requests, pm_process_idle_timeout, system_user, extra_directives, config_hash,
+		created_at, updated_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	result, err := db.conn.Exec(query,
-		site.Domain, site.DocumentRoot, site.PHPVersion, site.IsWordPress, site.IsEnabled,
-		site.MaxUpload, site.DBName, site.DBUser, site.DBPassword, site.PoolName,
-		site.CreatedAt, site.UpdatedAt,
+		site.Domain, site.DocumentRoot, site.PHPVersion, site.Type, site.IsEnabled,
+		site.MaxUpload, site.DBName, site.DBUser, dbPassword, site.PoolName,
+		site.Canonical, strings.Join(site.Upstreams, " "), site.LBPolicy, site.HealthURI,
+		site.SPAFallback, site.CaddyTemplate, site.PoolTemplate, site.HeaderProfile,
+		strings.Join(site.HeaderOverrides, "\n"), site.PM, site.PMMaxChildren, site.PMStartServers,
+		site.PMMinSpareServers, site.PMMaxSpareServers, site.PMMaxRequests, site.PMProcessIdleTimeout,
+		site.SystemUser, site.ExtraDirectives, site.ConfigHash, site.CreatedAt, site.UpdatedAt,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create site: %v", err)
@@ -120,18 +125,51 @@ func (db *DB) CreateSite(site *Site) error {
 	return nil
 }
 
+// siteColumns are the columns read into a Site, in the order scanSite expects
+const siteColumns = `id, domain, document_root, php_version, site_type, is_enabled,
+	max_upload, db_name, db_user, db_password, pool_name, canonical, upstreams, lb_policy,
+	health_uri, spa_fallback, caddy_template, pool_template, header_profile, header_overrides,
+	pm, pm_max_children, pm_start_servers, pm_min_spare_servers, pm_max_spare_servers,
+	pm_max_requests, pm_process_idle_timeout, system_user, extra_directives, config_hash,
+	created_at, updated_at`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSite reads a row selected with siteColumns
+func scanSite(row rowScanner, site *Site) error {
+	var upstreams, headerOverrides string
+	err := row.Scan(
+		&site.ID, &site.Domain, &site.DocumentRoot, &site.PHPVersion, &site.Type,
+		&site.IsEnabled, &site.MaxUpload, &site.DBName, &site.DBUser, &site.DBPassword,
+		&site.PoolName, &site.Canonical, &upstreams, &site.LBPolicy, &site.HealthURI,
+		&site.SPAFallback, &site.CaddyTemplate, &site.PoolTemplate, &site.HeaderProfile,
+		&headerOverrides, &site.PM, &site.PMMaxChildren, &site.PMStartServers, &site.PMMinSpareServers,
+		&site.PMMaxSpareServers, &site.PMMaxRequests, &site.PMProcessIdleTimeout, &site.SystemUser,
+		&site.ExtraDirectives, &site.ConfigHash, &site.CreatedAt, &site.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Upstreams are stored as a space separated list
+	site.Upstreams = strings.Fields(upstreams)
+
+	// Header overrides contain spaces and are stored one per line
+	if headerOverrides != "" {
+		site.HeaderOverrides = strings.Split(headerOverrides, "\n")
+	}
+	return nil
+}
+
 // GetSite retrieves a site by domain
 func (db *DB) GetSite(domain string) (*Site, error) {
-	query := `SELECT id, domain, document_root, php_version, is_wordpress, is_enabled,
-		max_upload, db_name, db_user, db_password, pool_name, created_at, updated_at
-		FROM sites WHERE domain = ?`
+	query := `SELECT ` + siteColumns + ` FROM sites WHERE domain = ?`
 
 	var site Site
-	err := db.conn.QueryRow(query, domain).Scan(
-		&site.ID, &site.Domain, &site.DocumentRoot, &site.PHPVersion, &site.IsWordPress,
-		&site.IsEnabled, &site.MaxUpload, &site.DBName, &site.DBUser, &site.DBPassword,
-		&site.PoolName, &site.CreatedAt, &site.UpdatedAt,
-	)
+	err := scanSite(db.conn.QueryRow(query, domain), &site)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("site not found: %s", domain)
@@ -139,6 +177,10 @@ func (db *DB) GetSite(domain string) (*Site, error) {
 		return nil, fmt.Errorf("failed to get site: %v", err)
 	}
 
+	if site.DBPassword, err = db.openCredential(site.DBPassword); err != nil {
+		return nil, err
+	}
+
 	return &site, nil
 }
 
@@ -164,16 +206,29 @@ func (db *DB) GetSiteWithAuth(domain string) (*SiteWithAuth, error) {
 func (db *DB) UpdateSite(site *Site) error {
 	site.UpdatedAt = time.Now()
 
+	dbPassword, err := db.sealCredential(site.DBPassword)
+	if err != nil {
+		return err
+	}
+
 	query := `UPDATE sites SET
-		document_root = ?, php_version = ?, is_wordpress = ?, is_enabled = ?,
+		document_root = ?, php_version = ?, site_type = ?, is_enabled = ?,
 		max_upload = ?, db_name = ?, db_user = ?, db_password = ?, pool_name = ?,
-		updated_at = ?
+		canonical = ?, upstreams = ?, lb_policy = ?, health_uri = ?, spa_fallback = ?,
+		caddy_template = ?, pool_template = ?, header_profile = ?, header_overrides = ?,
+		pm = ?, pm_max_children = ?, pm_start_servers = ?, pm_min_spare_servers = ?,
+		pm_max_spare_servers = ?, pm_max_requests = ?, pm_process_idle_timeout = ?,
+		system_user = ?, extra_directives = ?, updated_at = ?
 		WHERE domain = ?`
 
-	_, err := db.conn.Exec(query,
-		site.DocumentRoot, site.PHPVersion, site.IsWordPress, site.IsEnabled,
-		site.MaxUpload, site.DBName, site.DBUser, site.DBPassword, site.PoolName,
-		site.UpdatedAt, site.Domain,
+	_, err = db.conn.Exec(query,
+		site.DocumentRoot, site.PHPVersion, site.Type, site.IsEnabled,
+		site.MaxUpload, site.DBName, site.DBUser, dbPassword, site.PoolName,
+		site.Canonical, strings.Join(site.Upstreams, " "), site.LBPolicy, site.HealthURI,
+		site.SPAFallback, site.CaddyTemplate, site.PoolTemplate, site.HeaderProfile,
+		strings.Join(site.HeaderOverrides, "\n"), site.PM, site.PMMaxChildren, site.PMStartServers,
+		site.PMMinSpareServers, site.PMMaxSpareServers, site.PMMaxRequests, site.PMProcessIdleTimeout,
+		site.SystemUser, site.ExtraDirectives, site.UpdatedAt, site.Domain,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to update site: %v", err)
@@ -182,11 +237,37 @@ func (db *DB) UpdateSite(site *Site) error {
 	return nil
 }
 
-// DeleteSite deletes a site and all its basic auth configurations
+// SetConfigHash records the hash of the Caddy config last written for a site
+func (db *DB) SetConfigHash(domain, hash string) error {
+	if _, err := db.conn.Exec(`UPDATE sites SET config_hash = ? WHERE domain = ?`, hash, domain); err != nil {
+		return fmt.Errorf("failed to update config hash: %v", err)
+	}
+	return nil
+}
+
+// DeleteSite deletes a site together with its basic auth configurations,
+// aliases and PHP settings
 func (db *DB) DeleteSite(domain string) error {
-	query := `DELETE FROM sites WHERE domain = ?`
-	_, err := db.conn.Exec(query, domain)
+	tx, err := db.conn.Begin()
 	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Foreign keys are not enforced by SQLite by default, so remove dependent
+	// rows explicitly
+	for _, query := range []string{
+		`DELETE FROM basic_auths WHERE site_id IN (SELECT id FROM sites WHERE domain = ?)`,
+		`DELETE FROM site_aliases WHERE site_id IN (SELECT id FROM sites WHERE domain = ?)`,
+		`DELETE FROM php_settings WHERE site_id IN (SELECT id FROM sites WHERE domain = ?)`,
+		`DELETE FROM sites WHERE domain = ?`,
+	} {
+		if _, err := tx.Exec(query, domain); err != nil {
+			return fmt.Errorf("failed to delete site: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to delete site: %v", err)
 	}
 	return nil
@@ -198,14 +279,10 @@ func (db *DB) ListSites(enabledOnly *bool) ([]Site, error) {
 	var args []interface{}
 
 	if enabledOnly != nil {
-		query = `SELECT id, domain, document_root, php_version, is_wordpress, is_enabled,
-			max_upload, db_name, db_user, db_password, pool_name, created_at, updated_at
-			FROM sites WHERE is_enabled = ? ORDER BY domain`
+		query = `SELECT ` + siteColumns + ` FROM sites WHERE is_enabled = ? ORDER BY domain`
 		args = append(args, *enabledOnly)
 	} else {
-		query = `SELECT id, domain, document_root, php_version, is_wordpress, is_enabled,
-			max_upload, db_name, db_user, db_password, pool_name, created_at, updated_at
-			FROM sites ORDER BY domain`
+		query = `SELECT ` + siteColumns + ` FROM sites ORDER BY domain`
 	}
 
 	rows, err := db.conn.Query(query, args...)
@@ -217,14 +294,12 @@ func (db *DB) ListSites(enabledOnly *bool) ([]Site, error) {
 	var sites []Site
 	for rows.Next() {
 		var site Site
-		err := rows.Scan(
-			&site.ID, &site.Domain, &site.DocumentRoot, &site.PHPVersion, &site.IsWordPress,
-			&site.IsEnabled, &site.MaxUpload, &site.DBName, &site.DBUser, &site.DBPassword,
-			&site.PoolName, &site.CreatedAt, &site.UpdatedAt,
-		)
-		if err != nil {
+		if err := scanSite(rows, &site); err != nil {
 			return nil, fmt.Errorf("failed to scan site: %v", err)
 		}
+		if site.DBPassword, err = db.openCredential(site.DBPassword); err != nil {
+			return nil, err
+		}
 		sites = append(sites, site)
 	}
 
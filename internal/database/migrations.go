@@ -0,0 +1,313 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migration is a numbered schema change. Migrations are applied in order and
+// each one exactly once; never change or renumber a migration that has been
+// released, add a new one instead.
+type migration struct {
+	Version     int
+	Description string
+	Statements  []string
+	// Apply, if set, changes data in code after the statements ran
+	Apply func(db *DB, tx *sql.Tx) error
+	// NeedsKey marks migrations that can only run with the encryption key
+	NeedsKey bool
+}
+
+// migrations lists every schema change in version order
+var migrations = []migration{
+	{
+		Version:     1,
+		Description: "create sites and basic_auths tables",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS sites (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				domain TEXT UNIQUE NOT NULL,
+				document_root TEXT NOT NULL,
+				php_version TEXT NOT NULL DEFAULT '8.1',
+				is_wordpress BOOLEAN NOT NULL DEFAULT FALSE,
+				is_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+				max_upload TEXT NOT NULL DEFAULT '256M',
+				db_name TEXT,
+				db_user TEXT,
+				db_password TEXT,
+				pool_name TEXT NOT NULL,
+				created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS basic_auths (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				site_id INTEGER NOT NULL,
+				path TEXT NOT NULL,
+				username TEXT NOT NULL,
+				password TEXT NOT NULL,
+				created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (site_id) REFERENCES sites(id) ON DELETE CASCADE,
+				UNIQUE(site_id, path, username)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_sites_domain ON sites(domain)`,
+			`CREATE INDEX IF NOT EXISTS idx_sites_enabled ON sites(is_enabled)`,
+			`CREATE INDEX IF NOT EXISTS idx_basic_auths_site_id ON basic_auths(site_id)`,
+			`CREATE INDEX IF NOT EXISTS idx_basic_auths_path ON basic_auths(site_id, path)`,
+		},
+	},
+	{
+		Version:     2,
+		Description: "create site_aliases table",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS site_aliases (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				site_id INTEGER NOT NULL,
+				hostname TEXT UNIQUE NOT NULL,
+				redirect BOOLEAN NOT NULL DEFAULT FALSE,
+				created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (site_id) REFERENCES sites(id) ON DELETE CASCADE
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_site_aliases_site_id ON site_aliases(site_id)`,
+		},
+	},
+	{
+		Version:     3,
+		Description: "add canonical host policy to sites",
+		Statements: []string{
+			// Existing sites keep redirecting www. to the apex domain
+			`ALTER TABLE sites ADD COLUMN canonical TEXT NOT NULL DEFAULT 'apex'`,
+		},
+	},
+	{
+		Version:     4,
+		Description: "replace is_wordpress with site_type",
+		Statements: []string{
+			`ALTER TABLE sites ADD COLUMN site_type TEXT NOT NULL DEFAULT 'php'`,
+			`UPDATE sites SET site_type = 'wordpress' WHERE is_wordpress`,
+			`ALTER TABLE sites DROP COLUMN is_wordpress`,
+		},
+	},
+	{
+		Version:     5,
+		Description: "add reverse proxy settings to sites",
+		Statements: []string{
+			`ALTER TABLE sites ADD COLUMN upstreams TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE sites ADD COLUMN lb_policy TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE sites ADD COLUMN health_uri TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		Version:     6,
+		Description: "add single page application fallback to sites",
+		Statements: []string{
+			`ALTER TABLE sites ADD COLUMN spa_fallback BOOLEAN NOT NULL DEFAULT FALSE`,
+		},
+	},
+	{
+		Version:     7,
+		Description: "add per-site template selection",
+		Statements: []string{
+			`ALTER TABLE sites ADD COLUMN caddy_template TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE sites ADD COLUMN pool_template TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		Version:     8,
+		Description: "add extra Caddy directives and rendered config hash",
+		Statements: []string{
+			`ALTER TABLE sites ADD COLUMN extra_directives TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE sites ADD COLUMN config_hash TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		Version:     9,
+		Description: "add header profile and header overrides to sites",
+		Statements: []string{
+			`ALTER TABLE sites ADD COLUMN header_profile TEXT NOT NULL DEFAULT 'basic'`,
+			`ALTER TABLE sites ADD COLUMN header_overrides TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		Version:     10,
+		Description: "add PHP-FPM process manager settings to sites",
+		Statements: []string{
+			`ALTER TABLE sites ADD COLUMN pm TEXT NOT NULL DEFAULT 'dynamic'`,
+			`ALTER TABLE sites ADD COLUMN pm_max_children INTEGER NOT NULL DEFAULT 10`,
+			`ALTER TABLE sites ADD COLUMN pm_start_servers INTEGER NOT NULL DEFAULT 3`,
+			`ALTER TABLE sites ADD COLUMN pm_min_spare_servers INTEGER NOT NULL DEFAULT 2`,
+			`ALTER TABLE sites ADD COLUMN pm_max_spare_servers INTEGER NOT NULL DEFAULT 5`,
+			`ALTER TABLE sites ADD COLUMN pm_max_requests INTEGER NOT NULL DEFAULT 1000`,
+			`ALTER TABLE sites ADD COLUMN pm_process_idle_timeout TEXT NOT NULL DEFAULT '10s'`,
+		},
+	},
+	{
+		Version:     11,
+		Description: "create php_settings table",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS php_settings (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				site_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				value TEXT NOT NULL,
+				directive TEXT NOT NULL,
+				created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (site_id) REFERENCES sites(id) ON DELETE CASCADE,
+				UNIQUE(site_id, name)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_php_settings_site_id ON php_settings(site_id)`,
+		},
+	},
+	{
+		Version:     12,
+		Description: "add isolated system user to sites",
+		Statements: []string{
+			`ALTER TABLE sites ADD COLUMN system_user TEXT NOT NULL DEFAULT ''`,
+		},
+	},
+	{
+		Version:     13,
+		Description: "encrypt stored database credentials",
+		Apply:       (*DB).encryptPlaintextCredentials,
+		NeedsKey:    true,
+	},
+}
+
+// MigrationStatus describes a known migration and whether it has been applied
+type MigrationStatus struct {
+	Version     int        `json:"version"`
+	Description string     `json:"description"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty"`
+}
+
+// Applied reports whether the migration has been applied to the database
+func (m MigrationStatus) Applied() bool {
+	return m.AppliedAt != nil
+}
+
+// LatestSchemaVersion returns the newest schema version this binary knows
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// initMigrations creates the table that tracks applied migrations
+func (db *DB) initMigrations() error {
+	_, err := db.conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+	return nil
+}
+
+// SchemaVersion returns the highest migration version applied to the database
+func (db *DB) SchemaVersion() (int, error) {
+	var version sql.NullInt64
+	if err := db.conn.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %v", err)
+	}
+	return int(version.Int64), nil
+}
+
+// checkSchemaVersion refuses to work with a database written by a newer binary
+func (db *DB) checkSchemaVersion() error {
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version > LatestSchemaVersion() {
+		return fmt.Errorf("database schema version %d is newer than this binary supports (%d); upgrade caddy-site-manager before using %s",
+			version, LatestSchemaVersion(), db.path)
+	}
+	return nil
+}
+
+// MigrationStatus returns every known migration with its applied state
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+	rows, err := db.conn.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %v", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan migration: %v", err)
+		}
+		applied[version] = appliedAt
+	}
+
+	var statuses []MigrationStatus
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Description: m.Description}
+		if appliedAt, ok := applied[m.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Migrate applies all pending migrations in order, each in its own
+// transaction, and returns the ones that were applied. Without a cipher it
+// stops before the first migration that needs the encryption key, which
+// stays pending until the database is opened with one.
+func (db *DB) Migrate() ([]MigrationStatus, error) {
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []MigrationStatus
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		if m.NeedsKey && db.cipher == nil {
+			break
+		}
+		if err := db.applyMigration(m); err != nil {
+			return applied, fmt.Errorf("migration %d (%s) failed: %v", m.Version, m.Description, err)
+		}
+		now := time.Now()
+		applied = append(applied, MigrationStatus{Version: m.Version, Description: m.Description, AppliedAt: &now})
+	}
+
+	return applied, nil
+}
+
+// applyMigration runs a single migration and records it
+func (db *DB) applyMigration(m migration) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range m.Statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	if m.Apply != nil {
+		if err := m.Apply(db, tx); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version, description, applied_at) VALUES (?, ?, ?)`,
+		m.Version, m.Description, time.Now()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// baselineSchema is the schema created before migrations were tracked
+var baselineSchema = migrations[0].Statements
+
+// createBaselineDB writes a database with the baseline schema and one
+// WordPress site, the way versions without schema_migrations left it
+func createBaselineDB(t *testing.T, path string) {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, statement := range baselineSchema {
+		if _, err := conn.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := conn.Exec(`INSERT INTO sites (domain, document_root, php_version, is_wordpress, is_enabled, db_name, db_user, db_password, pool_name)
+		VALUES ('example.com', '/var/www/example.com', '8.2', TRUE, TRUE, 'example_com', 'example_com', 'legacy', 'example_com')`); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateBaselineDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sites.db")
+	createBaselineDB(t, path)
+
+	db := openTestDB(t, path, newTestCipher(t))
+	if version, err := db.SchemaVersion(); err != nil || version != LatestSchemaVersion() {
+		t.Fatalf("SchemaVersion() = %d, %v, want %d", version, err, LatestSchemaVersion())
+	}
+
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if !s.Applied() {
+			t.Errorf("migration %d (%s) is pending", s.Version, s.Description)
+		}
+	}
+
+	site, err := db.GetSite("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if site.Type != "wordpress" || !site.IsEnabled || site.DBPassword != "legacy" || site.HeaderProfile != "basic" {
+		t.Errorf("site = %+v, want the enabled WordPress site with its defaults", site)
+	}
+
+	// Running the migrations again changes nothing
+	applied, err := db.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("second Migrate() applied %d migrations", len(applied))
+	}
+	var count int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != len(migrations) {
+		t.Errorf("schema_migrations has %d rows, want %d", count, len(migrations))
+	}
+}
+
+func TestOpenDBRefusesNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sites.db")
+	db := openTestDB(t, path, newTestCipher(t))
+	newer := LatestSchemaVersion() + 1
+	if _, err := db.conn.Exec(`INSERT INTO schema_migrations (version, description) VALUES (?, 'from the future')`, newer); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	_, err := OpenDB(path)
+	want := fmt.Sprintf("database schema version %d is newer than this binary supports (%d)", newer, LatestSchemaVersion())
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("OpenDB() error = %v, want %q", err, want)
+	}
+	if _, err := NewDB(path, nil); err == nil {
+		t.Error("NewDB() opened a newer database")
+	}
+}
@@ -6,34 +6,110 @@ import (
 
 // Site represents a website configuration in the database
 type Site struct {
-	ID               int       `db:"id" json:"id"`
-	Domain           string    `db:"domain" json:"domain"`
-	DocumentRoot     string    `db:"document_root" json:"document_root"`
-	PHPVersion       string    `db:"php_version" json:"php_version"`
-	IsWordPress      bool      `db:"is_wordpress" json:"is_wordpress"`
-	IsEnabled        bool      `db:"is_enabled" json:"is_enabled"`
-	MaxUpload        string    `db:"max_upload" json:"max_upload"`
-	DBName           string    `db:"db_name" json:"db_name"`
-	DBUser           string    `db:"db_user" json:"db_user"`
-	DBPassword       string    `db:"db_password" json:"db_password"`
-	PoolName         string    `db:"pool_name" json:"pool_name"`
-	CreatedAt        time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt        time.Time `db:"updated_at" json:"updated_at"`
+	ID                   int       `db:"id" json:"id" yaml:"id"`
+	Domain               string    `db:"domain" json:"domain" yaml:"domain"`
+	DocumentRoot         string    `db:"document_root" json:"document_root" yaml:"document_root"`
+	PHPVersion           string    `db:"php_version" json:"php_version" yaml:"php_version"`
+	Type                 string    `db:"site_type" json:"site_type" yaml:"site_type"`
+	IsEnabled            bool      `db:"is_enabled" json:"is_enabled" yaml:"is_enabled"`
+	MaxUpload            string    `db:"max_upload" json:"max_upload" yaml:"max_upload"`
+	DBName               string    `db:"db_name" json:"db_name" yaml:"db_name"`
+	DBUser               string    `db:"db_user" json:"db_user" yaml:"db_user"`
+	DBPassword           string    `db:"db_password" json:"db_password" yaml:"db_password"`
+	PoolName             string    `db:"pool_name" json:"pool_name" yaml:"pool_name"`
+	Canonical            string    `db:"canonical" json:"canonical" yaml:"canonical"`
+	Upstreams            []string  `db:"upstreams" json:"upstreams,omitempty" yaml:"upstreams,omitempty"`
+	LBPolicy             string    `db:"lb_policy" json:"lb_policy,omitempty" yaml:"lb_policy,omitempty"`
+	HealthURI            string    `db:"health_uri" json:"health_uri,omitempty" yaml:"health_uri,omitempty"`
+	SPAFallback          bool      `db:"spa_fallback" json:"spa_fallback,omitempty" yaml:"spa_fallback,omitempty"`
+	CaddyTemplate        string    `db:"caddy_template" json:"caddy_template,omitempty" yaml:"caddy_template,omitempty"`
+	PoolTemplate         string    `db:"pool_template" json:"pool_template,omitempty" yaml:"pool_template,omitempty"`
+	HeaderProfile        string    `db:"header_profile" json:"header_profile" yaml:"header_profile"`
+	HeaderOverrides      []string  `db:"header_overrides" json:"header_overrides,omitempty" yaml:"header_overrides,omitempty"`
+	PM                   string    `db:"pm" json:"pm" yaml:"pm"`
+	PMMaxChildren        int       `db:"pm_max_children" json:"pm_max_children" yaml:"pm_max_children"`
+	PMStartServers       int       `db:"pm_start_servers" json:"pm_start_servers" yaml:"pm_start_servers"`
+	PMMinSpareServers    int       `db:"pm_min_spare_servers" json:"pm_min_spare_servers" yaml:"pm_min_spare_servers"`
+	PMMaxSpareServers    int       `db:"pm_max_spare_servers" json:"pm_max_spare_servers" yaml:"pm_max_spare_servers"`
+	PMMaxRequests        int       `db:"pm_max_requests" json:"pm_max_requests" yaml:"pm_max_requests"`
+	PMProcessIdleTimeout string    `db:"pm_process_idle_timeout" json:"pm_process_idle_timeout" yaml:"pm_process_idle_timeout"`
+	SystemUser           string    `db:"system_user" json:"system_user,omitempty" yaml:"system_user,omitempty"`
+	ExtraDirectives      string    `db:"extra_directives" json:"extra_directives,omitempty" yaml:"extra_directives,omitempty"`
+	ConfigHash           string    `db:"config_hash" json:"-" yaml:"-"`
+	CreatedAt            time.Time `db:"created_at" json:"created_at" yaml:"created_at"`
+	UpdatedAt            time.Time `db:"updated_at" json:"updated_at" yaml:"updated_at"`
 }
 
+// Canonical host policies. With CanonicalApex the www. host redirects to the
+// domain, with CanonicalWWW the domain redirects to the www. host and with
+// CanonicalNone only the domain itself is served.
+const (
+	CanonicalApex = "apex"
+	CanonicalWWW  = "www"
+	CanonicalNone = "none"
+)
+
 // BasicAuth represents basic authentication settings for a site
 type BasicAuth struct {
-	ID       int    `db:"id" json:"id"`
-	SiteID   int    `db:"site_id" json:"site_id"`
-	Path     string `db:"path" json:"path"`
-	Username string `db:"username" json:"username"`
-	Password string `db:"password" json:"password"` // bcrypt hashed
-	CreatedAt time.Time `db:"created_at" json:"created_at"`
-	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+	ID       int    `db:"id" json:"id" yaml:"id"`
+	SiteID   int    `db:"site_id" json:"site_id" yaml:"site_id"`
+	Path     string `db:"path" json:"path" yaml:"path"`
+	Username string `db:"username" json:"username" yaml:"username"`
+	Password string `db:"password" json:"password" yaml:"password"` // bcrypt hashed
+	CreatedAt time.Time `db:"created_at" json:"created_at" yaml:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at" yaml:"updated_at"`
+}
+
+// SiteAlias is an additional hostname of a site. The alias either serves the
+// site directly or redirects permanently to the primary domain.
+type SiteAlias struct {
+	ID        int       `db:"id" json:"id" yaml:"id"`
+	SiteID    int       `db:"site_id" json:"site_id" yaml:"site_id"`
+	Hostname  string    `db:"hostname" json:"hostname" yaml:"hostname"`
+	Redirect  bool      `db:"redirect" json:"redirect" yaml:"redirect"`
+	CreatedAt time.Time `db:"created_at" json:"created_at" yaml:"created_at"`
+}
+
+// PHPSetting is a php.ini setting of a site's PHP-FPM pool. Directive is the
+// pool directive it is written with, e.g. php_admin_value or php_flag.
+type PHPSetting struct {
+	ID        int       `db:"id" json:"id" yaml:"id"`
+	SiteID    int       `db:"site_id" json:"site_id" yaml:"site_id"`
+	Name      string    `db:"name" json:"name" yaml:"name"`
+	Value     string    `db:"value" json:"value" yaml:"value"`
+	Directive string    `db:"directive" json:"directive" yaml:"directive"`
+	CreatedAt time.Time `db:"created_at" json:"created_at" yaml:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at" yaml:"updated_at"`
 }
 
 // SiteWithAuth represents a site with its basic auth configurations
 type SiteWithAuth struct {
-	Site
-	BasicAuths []BasicAuth `json:"basic_auths"`
+	Site       `yaml:",inline"`
+	BasicAuths []BasicAuth `json:"basic_auths" yaml:"basic_auths"`
+}
+
+// RedactedSecret replaces secrets in redacted output
+const RedactedSecret = "********"
+
+// Redacted returns a copy of the site with its database password hidden
+func (s Site) Redacted() Site {
+	if s.DBPassword != "" {
+		s.DBPassword = RedactedSecret
+	}
+	return s
+}
+
+// Redacted returns a copy of the basic auth with its password hash hidden
+func (a BasicAuth) Redacted() BasicAuth {
+	a.Password = RedactedSecret
+	return a
+}
+
+// Redacted returns a copy of the site and its basic auths with secrets hidden
+func (s SiteWithAuth) Redacted() SiteWithAuth {
+	redacted := SiteWithAuth{Site: s.Site.Redacted(), BasicAuths: make([]BasicAuth, 0, len(s.BasicAuths))}
+	for _, auth := range s.BasicAuths {
+		redacted.BasicAuths = append(redacted.BasicAuths, auth.Redacted())
+	}
+	return redacted
 }
@@ -0,0 +1,28 @@
+package database
+
+import "testing"
+
+func TestRedacted(t *testing.T) {
+	site := Site{Domain: "example.com", DBUser: "example_com", DBPassword: "s3cr3t"}
+	if redacted := site.Redacted(); redacted.DBPassword != RedactedSecret || redacted.DBUser != "example_com" {
+		t.Errorf("Redacted() = %+v, want only the password hidden", redacted)
+	}
+	if site.DBPassword != "s3cr3t" {
+		t.Error("Redacted() changed the original site")
+	}
+	if redacted := (Site{Domain: "static.example.com"}).Redacted(); redacted.DBPassword != "" {
+		t.Errorf("Redacted() of a site without database = %q, want empty", redacted.DBPassword)
+	}
+
+	withAuth := SiteWithAuth{Site: site, BasicAuths: []BasicAuth{{Path: "/admin", Username: "admin", Password: "$2a$10$hash"}}}
+	redacted := withAuth.Redacted()
+	if redacted.DBPassword != RedactedSecret || redacted.BasicAuths[0].Password != RedactedSecret || redacted.BasicAuths[0].Username != "admin" {
+		t.Errorf("Redacted() = %+v, want the password and hashes hidden", redacted)
+	}
+	if withAuth.BasicAuths[0].Password != "$2a$10$hash" {
+		t.Error("Redacted() changed the original basic auths")
+	}
+	if empty := (SiteWithAuth{Site: site}).Redacted(); empty.BasicAuths == nil {
+		t.Error("Redacted() of a site without basic auth has nil auths, which encode as null")
+	}
+}
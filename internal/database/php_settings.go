@@ -0,0 +1,67 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// SetPHPSetting stores a PHP setting of a site, replacing the setting of the
+// same name
+func (db *DB) SetPHPSetting(setting *PHPSetting) error {
+	now := time.Now()
+	setting.UpdatedAt = now
+
+	query := `INSERT INTO php_settings (site_id, name, value, directive, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(site_id, name) DO UPDATE SET
+			value = excluded.value, directive = excluded.directive, updated_at = excluded.updated_at`
+	if _, err := db.conn.Exec(query, setting.SiteID, setting.Name, setting.Value, setting.Directive, now, now); err != nil {
+		return fmt.Errorf("failed to store PHP setting: %v", err)
+	}
+
+	return db.conn.QueryRow(`SELECT id, created_at FROM php_settings WHERE site_id = ? AND name = ?`,
+		setting.SiteID, setting.Name).Scan(&setting.ID, &setting.CreatedAt)
+}
+
+// GetPHPSettings retrieves the PHP settings of a site
+func (db *DB) GetPHPSettings(siteID int) ([]PHPSetting, error) {
+	query := `SELECT id, site_id, name, value, directive, created_at, updated_at
+		FROM php_settings WHERE site_id = ? ORDER BY name`
+
+	rows, err := db.conn.Query(query, siteID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get PHP settings: %v", err)
+	}
+	defer rows.Close()
+
+	var settings []PHPSetting
+	for rows.Next() {
+		var setting PHPSetting
+		if err := rows.Scan(&setting.ID, &setting.SiteID, &setting.Name, &setting.Value,
+			&setting.Directive, &setting.CreatedAt, &setting.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan PHP setting: %v", err)
+		}
+		settings = append(settings, setting)
+	}
+
+	return settings, nil
+}
+
+// DeletePHPSetting removes a PHP setting from a site
+func (db *DB) DeletePHPSetting(siteID int, name string) error {
+	result, err := db.conn.Exec(`DELETE FROM php_settings WHERE site_id = ? AND name = ?`, siteID, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete PHP setting: %v", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("PHP setting %s not found", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format is an output format for command results
+type Format string
+
+// Supported output formats
+const (
+	Table Format = "table"
+	JSON  Format = "json"
+	YAML  Format = "yaml"
+	CSV   Format = "csv"
+)
+
+// Formats lists all supported output formats
+var Formats = []Format{Table, JSON, YAML, CSV}
+
+// ParseFormat validates an output format name. An empty name means Table.
+func ParseFormat(name string) (Format, error) {
+	if name == "" {
+		return Table, nil
+	}
+	for _, f := range Formats {
+		if string(f) == strings.ToLower(name) {
+			return f, nil
+		}
+	}
+
+	var names []string
+	for _, f := range Formats {
+		names = append(names, string(f))
+	}
+	return "", fmt.Errorf("unknown output format %q (use %s)", name, strings.Join(names, ", "))
+}
+
+// Rows is the tabular form of a result, used by the table and csv formats
+type Rows struct {
+	Headers []string
+	Rows    [][]string
+}
+
+// Write renders a result. The json and yaml formats encode value itself, the
+// table and csv formats render rows.
+func Write(w io.Writer, format Format, value interface{}, rows Rows) error {
+	switch format {
+	case JSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case YAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(value); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case CSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(rows.Headers); err != nil {
+			return err
+		}
+		if err := writer.WriteAll(rows.Rows); err != nil {
+			return err
+		}
+		return writer.Error()
+	case Table, "":
+		return writeTable(w, rows)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// writeTable renders rows as aligned columns
+func writeTable(w io.Writer, rows Rows) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(rows.Headers, "\t"))
+	for _, row := range rows.Rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
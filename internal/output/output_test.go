@@ -0,0 +1,65 @@
+package output
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+type record struct {
+	Domain  string `json:"domain" yaml:"domain"`
+	Enabled bool   `json:"enabled" yaml:"enabled"`
+}
+
+func TestParseFormat(t *testing.T) {
+	for name, want := range map[string]Format{"": Table, "table": Table, "JSON": JSON, "yaml": YAML, "csv": CSV} {
+		if got, err := ParseFormat(name); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil || !strings.Contains(err.Error(), "table, json, yaml, csv") {
+		t.Errorf("ParseFormat(xml) error = %v", err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	value := []record{{Domain: "example.com", Enabled: true}, {Domain: "a,b.example.com"}}
+	rows := Rows{
+		Headers: []string{"DOMAIN", "STATUS"},
+		Rows:    [][]string{{"example.com", "enabled"}, {"a,b.example.com", "disabled"}},
+	}
+
+	tests := map[Format]string{
+		Table: "DOMAIN           STATUS\nexample.com      enabled\na,b.example.com  disabled\n",
+		CSV:   "DOMAIN,STATUS\nexample.com,enabled\n\"a,b.example.com\",disabled\n",
+		JSON: `[
+  {
+    "domain": "example.com",
+    "enabled": true
+  },
+  {
+    "domain": "a,b.example.com",
+    "enabled": false
+  }
+]
+`,
+		YAML: `- domain: example.com
+  enabled: true
+- domain: a,b.example.com
+  enabled: false
+`,
+	}
+	for format, want := range tests {
+		var buf bytes.Buffer
+		if err := Write(&buf, format, value, rows); err != nil {
+			t.Fatalf("Write(%s): %v", format, err)
+		}
+		if buf.String() != want {
+			t.Errorf("Write(%s) =\n%s\nwant\n%s", format, buf.String(), want)
+		}
+	}
+
+	if err := Write(&bytes.Buffer{}, "xml", value, rows); err == nil {
+		t.Error("Write accepted an unknown format")
+	}
+}
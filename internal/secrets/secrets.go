@@ -0,0 +1,165 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// KeyEnvVar is the environment variable that can provide the encryption key
+// instead of a key file. Its value is the base64-encoded 32 byte key.
+const KeyEnvVar = "CADDY_SITE_MANAGER_KEY"
+
+// KeySize is the size of an encryption key in bytes (AES-256)
+const KeySize = 32
+
+// encryptedPrefix marks values produced by Cipher.Encrypt
+const encryptedPrefix = "enc:v1:"
+
+// Cipher encrypts and decrypts stored credentials with AES-256-GCM
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher creates a cipher from a 32 byte key
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+
+	return &Cipher{aead: aead}, nil
+}
+
+// IsEncrypted reports whether a stored value was produced by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// Encrypt encrypts a value for storage. Empty values stay empty.
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %v", err)
+	}
+
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a stored value. Values that are not encrypted (written
+// before encryption was enabled) are returned unchanged.
+func (c *Cipher) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode encrypted value: %v", err)
+	}
+
+	nonceSize := c.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", fmt.Errorf("encrypted value is too short")
+	}
+
+	plaintext, err := c.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value (wrong key?): %v", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// GenerateKey creates a new random encryption key
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate encryption key: %v", err)
+	}
+	return key, nil
+}
+
+// EncodeKey returns the textual form of a key as stored in key files and KeyEnvVar
+func EncodeKey(key []byte) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// decodeKey parses the textual form of a key
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key encoding: %v", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// KeyFromEnv reports whether the key is provided through KeyEnvVar
+func KeyFromEnv() bool {
+	return os.Getenv(KeyEnvVar) != ""
+}
+
+// LoadKey loads the encryption key from KeyEnvVar if it is set, otherwise from
+// the key file. A missing key file is reported with an error satisfying
+// os.IsNotExist.
+func LoadKey(keyFile string) ([]byte, error) {
+	if encoded := os.Getenv(KeyEnvVar); encoded != "" {
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", KeyEnvVar, err)
+		}
+		return key, nil
+	}
+
+	content, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := decodeKey(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", keyFile, err)
+	}
+	return key, nil
+}
+
+// WriteKeyFile atomically writes a key file readable only by its owner
+func WriteKeyFile(keyFile string, key []byte) error {
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0755); err != nil {
+		return fmt.Errorf("failed to create key directory: %v", err)
+	}
+
+	tmpFile := keyFile + ".tmp"
+	if err := os.WriteFile(tmpFile, []byte(EncodeKey(key)+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write key file: %v", err)
+	}
+
+	if err := os.Rename(tmpFile, keyFile); err != nil {
+		os.Remove(tmpFile)
+		return fmt.Errorf("failed to install key file: %v", err)
+	}
+
+	return nil
+}
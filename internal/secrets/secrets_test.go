@@ -0,0 +1,114 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestCipher(t *testing.T) *Cipher {
+	t.Helper()
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	c := newTestCipher(t)
+
+	sealed, err := c.Encrypt("s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealed, "enc:v1:") || !IsEncrypted(sealed) || strings.Contains(sealed, "s3cr3t") {
+		t.Errorf("Encrypt() = %q, want an enc:v1: value without the plaintext", sealed)
+	}
+	if again, _ := c.Encrypt("s3cr3t"); again == sealed {
+		t.Error("Encrypt() reused a nonce")
+	}
+
+	plaintext, err := c.Decrypt(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext != "s3cr3t" {
+		t.Errorf("Decrypt() = %q, want s3cr3t", plaintext)
+	}
+}
+
+func TestEncryptEmptyAndPlaintext(t *testing.T) {
+	c := newTestCipher(t)
+
+	if sealed, err := c.Encrypt(""); err != nil || sealed != "" {
+		t.Errorf("Encrypt(\"\") = %q, %v, want an empty value", sealed, err)
+	}
+	if plaintext, err := c.Decrypt("legacy"); err != nil || plaintext != "legacy" {
+		t.Errorf("Decrypt(plaintext) = %q, %v, want it unchanged", plaintext, err)
+	}
+}
+
+func TestDecryptWrongKey(t *testing.T) {
+	sealed, err := newTestCipher(t).Encrypt("s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = newTestCipher(t).Decrypt(sealed)
+	if err == nil || !strings.Contains(err.Error(), "wrong key?") {
+		t.Errorf("Decrypt() with another key error = %v", err)
+	}
+
+	for _, value := range []string{"enc:v1:not base64!", "enc:v1:AAAA"} {
+		if _, err := newTestCipher(t).Decrypt(value); err == nil {
+			t.Errorf("Decrypt(%q) succeeded", value)
+		}
+	}
+}
+
+func TestNewCipherKeySize(t *testing.T) {
+	if _, err := NewCipher(make([]byte, 16)); err == nil {
+		t.Error("16 byte key was accepted")
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "keys", "site-manager.key")
+	t.Setenv(KeyEnvVar, "")
+
+	if _, err := LoadKey(keyFile); !os.IsNotExist(err) {
+		t.Errorf("LoadKey() of a missing file error = %v, want not exist", err)
+	}
+
+	if err := WriteKeyFile(keyFile, key); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode = %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+	if loaded, err := LoadKey(keyFile); err != nil || string(loaded) != string(key) {
+		t.Errorf("LoadKey() = %x, %v, want the written key", loaded, err)
+	}
+
+	// The environment takes precedence over the key file
+	other, _ := GenerateKey()
+	t.Setenv(KeyEnvVar, EncodeKey(other))
+	if loaded, err := LoadKey(keyFile); err != nil || string(loaded) != string(other) {
+		t.Errorf("LoadKey() = %x, %v, want the key from %s", loaded, err, KeyEnvVar)
+	}
+
+	t.Setenv(KeyEnvVar, "c2hvcnQ=")
+	if _, err := LoadKey(keyFile); err == nil || !strings.Contains(err.Error(), KeyEnvVar) {
+		t.Errorf("LoadKey() with a short key error = %v", err)
+	}
+}
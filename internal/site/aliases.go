@@ -0,0 +1,201 @@
+package site
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+// hostnamePattern matches hostnames Caddy accepts as site addresses,
+// including a leading wildcard label
+var hostnamePattern = regexp.MustCompile(`^(\*\.)?([a-z0-9]([a-z0-9-]*[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// caddyTemplateData is the data the Caddy templates are rendered with.
+// PrimaryHost is the canonical host of the site and CanonicalRedirect the
+// host that redirects to it, if any. Headers are the response headers of the
+// site's header profile with its overrides applied.
+type caddyTemplateData struct {
+	*database.Site
+	PrimaryHost       string
+	CanonicalRedirect string
+	Aliases           []string
+	RedirectAliases   []string
+	Headers           []Header
+}
+
+// caddyTemplateData collects a site and its aliases for the Caddy templates
+func (sm *SQLiteSiteManager) caddyTemplateData(site *database.Site) (*caddyTemplateData, error) {
+	data := &caddyTemplateData{Site: site}
+	data.PrimaryHost, data.CanonicalRedirect = canonicalHosts(site)
+
+	headers, err := sm.siteHeaders(site)
+	if err != nil {
+		return nil, err
+	}
+	data.Headers = headers
+
+	// A site that is not stored yet has no aliases
+	if site.ID == 0 {
+		return data, nil
+	}
+
+	aliases, err := sm.DB.GetAliases(site.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, alias := range aliases {
+		if alias.Redirect {
+			data.RedirectAliases = append(data.RedirectAliases, alias.Hostname)
+		} else {
+			data.Aliases = append(data.Aliases, alias.Hostname)
+		}
+	}
+
+	return data, nil
+}
+
+// checkHostnameAvailable returns an error if a hostname already belongs to a
+// site, either as its domain, as an alias or as its www. host
+func (sm *SQLiteSiteManager) checkHostnameAvailable(hostname string) error {
+	owner, err := sm.DB.HostnameOwner(hostname)
+	if err != nil {
+		return err
+	}
+	if owner == hostname {
+		return fmt.Errorf("hostname %s is already a site", hostname)
+	}
+	if owner != "" {
+		return fmt.Errorf("hostname %s is already an alias of %s", hostname, owner)
+	}
+
+	if apex := strings.TrimPrefix(hostname, "www."); apex != hostname {
+		exists, err := sm.DB.SiteExists(apex)
+		if err != nil {
+			return err
+		}
+		if exists {
+			site, err := sm.DB.GetSite(apex)
+			if err != nil {
+				return err
+			}
+			if site.Canonical != database.CanonicalNone {
+				return fmt.Errorf("hostname %s already belongs to %s", hostname, apex)
+			}
+		}
+	}
+
+	return nil
+}
+
+// AddAlias adds an additional hostname to a site. With redirect the alias
+// answers with a permanent redirect to the primary domain, otherwise it serves
+// the site directly.
+func (sm *SQLiteSiteManager) AddAlias(domain, hostname string, redirect bool) error {
+	hostname = strings.ToLower(strings.TrimSpace(hostname))
+
+	if sm.Config.Verbose {
+		fmt.Fprintf(sm.Out, "Adding alias %s to %s\n", hostname, domain)
+	}
+
+	if !hostnamePattern.MatchString(hostname) {
+		return fmt.Errorf("invalid hostname: %s", hostname)
+	}
+
+	// Get site from database
+	site, err := sm.DB.GetSite(domain)
+	if err != nil {
+		return err
+	}
+
+	if err := sm.checkHostnameAvailable(hostname); err != nil {
+		return err
+	}
+
+	if sm.Config.DryRun {
+		if sm.Config.Verbose {
+			fmt.Fprintf(sm.Out, "Would add alias:\n")
+			fmt.Fprintf(sm.Out, "  Domain: %s\n", domain)
+			fmt.Fprintf(sm.Out, "  Alias: %s\n", hostname)
+			fmt.Fprintf(sm.Out, "  Redirect: %t\n", redirect)
+		}
+		return nil
+	}
+
+	alias := &database.SiteAlias{
+		SiteID:   site.ID,
+		Hostname: hostname,
+		Redirect: redirect,
+	}
+	if err := sm.DB.CreateAlias(alias); err != nil {
+		return fmt.Errorf("failed to store alias in database: %v", err)
+	}
+
+	// Regenerate Caddy configuration and reload Caddy
+	return sm.updateSiteConfig(site, func() error {
+		return sm.DB.DeleteAlias(site.ID, hostname)
+	})
+}
+
+// RemoveAlias removes an additional hostname from a site
+func (sm *SQLiteSiteManager) RemoveAlias(domain, hostname string) error {
+	hostname = strings.ToLower(strings.TrimSpace(hostname))
+
+	if sm.Config.Verbose {
+		fmt.Fprintf(sm.Out, "Removing alias %s from %s\n", hostname, domain)
+	}
+
+	// Get site from database
+	site, err := sm.DB.GetSite(domain)
+	if err != nil {
+		return err
+	}
+
+	if sm.Config.DryRun {
+		if sm.Config.Verbose {
+			fmt.Fprintf(sm.Out, "Would remove alias: %s\n", hostname)
+		}
+		return nil
+	}
+
+	aliases, err := sm.DB.GetAliases(site.ID)
+	if err != nil {
+		return err
+	}
+	var previous *database.SiteAlias
+	for i := range aliases {
+		if aliases[i].Hostname == hostname {
+			previous = &aliases[i]
+		}
+	}
+
+	if err := sm.DB.DeleteAlias(site.ID, hostname); err != nil {
+		return err
+	}
+
+	// Regenerate Caddy configuration and reload Caddy
+	return sm.updateSiteConfig(site, func() error {
+		if previous == nil {
+			return nil
+		}
+		return sm.DB.CreateAlias(previous)
+	})
+}
+
+// ListAliases returns the aliases of a site
+func (sm *SQLiteSiteManager) ListAliases(domain string) ([]database.SiteAlias, error) {
+	site, err := sm.DB.GetSite(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	aliases, err := sm.DB.GetAliases(site.ID)
+	if err != nil {
+		return nil, err
+	}
+	if aliases == nil {
+		aliases = []database.SiteAlias{}
+	}
+	return aliases, nil
+}
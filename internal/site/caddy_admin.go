@@ -0,0 +1,181 @@
+package site
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CaddyAdmin is a client of the Caddy admin API
+type CaddyAdmin struct {
+	// Address is the admin endpoint, as host:port or URL
+	Address string
+	Client  *http.Client
+}
+
+// NewCaddyAdmin creates an admin API client for an address
+func NewCaddyAdmin(address string) *CaddyAdmin {
+	return &CaddyAdmin{
+		Address: address,
+		Client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// caddyAdaptWarning is a warning reported by the Caddyfile adapter
+type caddyAdaptWarning struct {
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	Directive string `json:"directive"`
+	Message   string `json:"message"`
+}
+
+// String returns the warning like caddy adapt prints it
+func (w caddyAdaptWarning) String() string {
+	if w.File == "" {
+		return w.Message
+	}
+	return fmt.Sprintf("%s:%d: %s", w.File, w.Line, w.Message)
+}
+
+// Adapt converts a Caddyfile to a JSON config and returns it with the
+// warnings of the adapter
+func (a *CaddyAdmin) Adapt(caddyfile []byte) (json.RawMessage, []string, error) {
+	body, err := a.post("/adapt", "text/caddyfile", caddyfile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var adapted struct {
+		Result   json.RawMessage     `json:"result"`
+		Warnings []caddyAdaptWarning `json:"warnings"`
+	}
+	if err := json.Unmarshal(body, &adapted); err != nil {
+		return nil, nil, fmt.Errorf("invalid response from Caddy admin API: %v", err)
+	}
+
+	var warnings []string
+	for _, w := range adapted.Warnings {
+		warnings = append(warnings, w.String())
+	}
+	return adapted.Result, warnings, nil
+}
+
+// Load replaces the running config of Caddy. Caddy keeps the previous config
+// if the new one fails to load.
+func (a *CaddyAdmin) Load(config json.RawMessage) error {
+	_, err := a.post("/load", "application/json", config)
+	return err
+}
+
+// post sends a request to the admin API and returns the response body, or
+// the error message of Caddy if the request failed
+func (a *CaddyAdmin) post(path, contentType string, body []byte) ([]byte, error) {
+	url := strings.TrimRight(a.Address, "/") + path
+	if !strings.Contains(a.Address, "://") {
+		url = "http://" + url
+	}
+
+	resp, err := a.Client.Post(url, contentType, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("caddy admin API unreachable: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response from Caddy admin API: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Error != "" {
+			return nil, fmt.Errorf("caddy admin API: %s", apiErr.Error)
+		}
+		return nil, fmt.Errorf("caddy admin API: %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+
+	return respBody, nil
+}
+
+// adaptCaddyfile adapts a Caddyfile through the admin API, which also checks
+// every imported site config. Relative imports are made absolute first, since
+// Caddy adapts the posted Caddyfile without knowing its path. While site
+// configs are enabled in enabledSites, a config with fewer site blocks or with
+// import warnings is refused: loading it would take sites offline.
+func (sm *SQLiteSiteManager) adaptCaddyfile(path, enabledSites string) (json.RawMessage, error) {
+	if sm.skipAdminAPI("/adapt") {
+		return nil, nil
+	}
+
+	caddyfile, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Caddyfile: %v", err)
+	}
+	sites, err := countSiteConfigs(enabledSites)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read enabled sites: %v", err)
+	}
+
+	config, warnings, err := sm.Admin.Adapt(absoluteImports(caddyfile, filepath.Dir(path)))
+	if err != nil {
+		return nil, err
+	}
+
+	var importWarnings []string
+	for _, warning := range warnings {
+		if sm.Config.Verbose {
+			fmt.Fprintf(sm.Out, "Caddyfile warning: %s\n", warning)
+		}
+		if strings.Contains(strings.ToLower(warning), "import") {
+			importWarnings = append(importWarnings, warning)
+		}
+	}
+	if sites > 0 {
+		if len(importWarnings) > 0 {
+			return nil, fmt.Errorf("refusing to load Caddyfile with failed imports: %s", strings.Join(importWarnings, "; "))
+		}
+		if blocks := adaptedSiteBlocks(config); blocks < sites {
+			return nil, fmt.Errorf("refusing to load Caddyfile with %d site blocks for %d enabled sites (does it import %s?)",
+				blocks, sites, sm.Config.EnabledSites)
+		}
+	}
+	return config, nil
+}
+
+// loadCaddyfile adapts the main Caddyfile and loads it through the admin API.
+// Caddy keeps running the previous config if /load fails, so the error must
+// reach the caller, which puts the previous files back.
+func (sm *SQLiteSiteManager) loadCaddyfile() error {
+	if sm.skipAdminAPI("/load") {
+		return nil
+	}
+
+	config, err := sm.adaptCaddyfile(sm.Config.Path(sm.Config.CaddyFile), sm.Config.Path(sm.Config.EnabledSites))
+	if err != nil {
+		return err
+	}
+	if err := sm.Admin.Load(config); err != nil {
+		return fmt.Errorf("caddy rejected the config: %v", err)
+	}
+	return nil
+}
+
+// skipAdminAPI reports whether admin API requests are skipped because paths
+// are staged below a root prefix, which the running Caddy does not read
+func (sm *SQLiteSiteManager) skipAdminAPI(path string) bool {
+	if sm.Config.Root == "" {
+		return false
+	}
+	if sm.Config.Verbose {
+		fmt.Fprintf(sm.Out, "Sandbox: skipping Caddy admin API %s\n", path)
+	}
+	return true
+}
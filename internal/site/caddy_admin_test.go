@@ -0,0 +1,254 @@
+package site
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tankadesign/caddy-site-manager/internal/config"
+)
+
+// adminStub is a stand-in for the Caddy admin API that answers /adapt with a
+// fixed response and records what was posted
+type adminStub struct {
+	adaptResponse string
+	adaptStatus   int
+	loadStatus    int
+	loadResponse  string
+
+	adapted []byte
+	loaded  []byte
+}
+
+func (s *adminStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status, response := http.StatusOK, ""
+	switch r.URL.Path {
+	case "/adapt":
+		if r.Header.Get("Content-Type") != "text/caddyfile" {
+			http.Error(w, "unexpected content type", http.StatusBadRequest)
+			return
+		}
+		s.adapted = body
+		status, response = s.adaptStatus, s.adaptResponse
+	case "/load":
+		if r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "unexpected content type", http.StatusBadRequest)
+			return
+		}
+		s.loaded = body
+		status, response = s.loadStatus, s.loadResponse
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, response)
+}
+
+// newAdminStub starts a stand-in admin API and returns a client for it,
+// addressed as host:port like the --admin-address default
+func newAdminStub(t *testing.T, stub *adminStub) *CaddyAdmin {
+	t.Helper()
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	return NewCaddyAdmin(strings.TrimPrefix(server.URL, "http://"))
+}
+
+const adaptedOneSite = `{"result":{"apps":{"http":{"servers":{"srv0":{"routes":[{"match":[{"host":["example.com"]}]}]}}}}}}`
+
+func TestCaddyAdminAdaptAndLoad(t *testing.T) {
+	stub := &adminStub{adaptResponse: `{
+		"result": {"apps": {"http": {"servers": {}}}},
+		"warnings": [
+			{"file": "Caddyfile", "line": 3, "directive": "header", "message": "unnecessary header_up"},
+			{"message": "no file"}
+		]
+	}`}
+	admin := newAdminStub(t, stub)
+
+	config, warnings, err := admin.Adapt([]byte("example.com {\n}\n"))
+	if err != nil {
+		t.Fatalf("Adapt: %v", err)
+	}
+	if string(stub.adapted) != "example.com {\n}\n" {
+		t.Errorf("posted Caddyfile = %q", stub.adapted)
+	}
+	if string(config) != `{"apps": {"http": {"servers": {}}}}` {
+		t.Errorf("adapted config = %s", config)
+	}
+	want := []string{"Caddyfile:3: unnecessary header_up", "no file"}
+	if strings.Join(warnings, "|") != strings.Join(want, "|") {
+		t.Errorf("warnings = %q, want %q", warnings, want)
+	}
+
+	if err := admin.Load(config); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !bytes.Equal(stub.loaded, config) {
+		t.Errorf("loaded config = %s, want %s", stub.loaded, config)
+	}
+}
+
+func TestCaddyAdminErrors(t *testing.T) {
+	stub := &adminStub{
+		adaptStatus:   http.StatusBadRequest,
+		adaptResponse: `{"error":"adapting config using caddyfile: Caddyfile:2: unrecognized directive: BROKEN"}`,
+		loadStatus:    http.StatusInternalServerError,
+		loadResponse:  "boom\n",
+	}
+	admin := newAdminStub(t, stub)
+
+	_, _, err := admin.Adapt([]byte("example.com {\n\tBROKEN\n}\n"))
+	if err == nil || err.Error() != "caddy admin API: adapting config using caddyfile: Caddyfile:2: unrecognized directive: BROKEN" {
+		t.Errorf("Adapt error = %v", err)
+	}
+
+	err = admin.Load(json.RawMessage(`{}`))
+	if err == nil || err.Error() != "caddy admin API: 500 Internal Server Error: boom" {
+		t.Errorf("Load error = %v", err)
+	}
+
+	unreachable := NewCaddyAdmin("http://127.0.0.1:1")
+	if err := unreachable.Load(json.RawMessage(`{}`)); err == nil || !strings.Contains(err.Error(), "unreachable") {
+		t.Errorf("Load on closed port error = %v", err)
+	}
+}
+
+// newAPIManager creates a manager on a temporary config directory that
+// reloads Caddy through the stand-in admin API. The Caddyfile imports the
+// enabled sites with a relative path.
+func newAPIManager(t *testing.T, stub *adminStub) *SQLiteSiteManager {
+	t.Helper()
+
+	configDir := t.TempDir()
+	cfg := config.NewCaddyConfig(configDir)
+	cfg.ReloadMethod = config.ReloadAdminAPI
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfg.CaddyFile, []byte("import enabled-sites/*\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return &SQLiteSiteManager{
+		Config: cfg,
+		Runner: NewRecordingRunner(),
+		Admin:  newAdminStub(t, stub),
+		Out:    &bytes.Buffer{},
+	}
+}
+
+func TestLoadCaddyfile(t *testing.T) {
+	stub := &adminStub{adaptResponse: adaptedOneSite}
+	sm := newAPIManager(t, stub)
+	if err := os.WriteFile(filepath.Join(sm.Config.EnabledSites, "example.com"), []byte("example.com {\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sm.loadCaddyfile(); err != nil {
+		t.Fatalf("loadCaddyfile: %v", err)
+	}
+	if want := "import " + filepath.Join(sm.Config.ConfigDir, "enabled-sites") + "/*\n"; string(stub.adapted) != want {
+		t.Errorf("posted Caddyfile = %q, want %q", stub.adapted, want)
+	}
+	if string(stub.loaded) != `{"apps":{"http":{"servers":{"srv0":{"routes":[{"match":[{"host":["example.com"]}]}]}}}}}` {
+		t.Errorf("loaded config = %s", stub.loaded)
+	}
+}
+
+func TestLoadCaddyfileRefusesConfigWithoutSites(t *testing.T) {
+	tests := map[string]string{
+		"no servers":     `{"result":{"apps":{"tls":{}}}}`,
+		"import warning": `{"result":{"apps":{"http":{"servers":{"srv0":{"routes":[{}]}}}}},"warnings":[{"message":"No files matching import glob pattern: enabled-sites/*"}]}`,
+	}
+	for name, response := range tests {
+		t.Run(name, func(t *testing.T) {
+			stub := &adminStub{adaptResponse: response}
+			sm := newAPIManager(t, stub)
+			if err := os.WriteFile(filepath.Join(sm.Config.EnabledSites, "example.com"), []byte("example.com {\n}\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := sm.loadCaddyfile(); err == nil || !strings.Contains(err.Error(), "refusing to load") {
+				t.Errorf("loadCaddyfile error = %v, want refusal", err)
+			}
+			if stub.loaded != nil {
+				t.Errorf("config was loaded: %s", stub.loaded)
+			}
+		})
+	}
+}
+
+func TestLoadCaddyfileWithoutEnabledSites(t *testing.T) {
+	stub := &adminStub{adaptResponse: `{"result":{}}`}
+	sm := newAPIManager(t, stub)
+
+	if err := sm.loadCaddyfile(); err != nil {
+		t.Fatalf("loadCaddyfile: %v", err)
+	}
+	if stub.loaded == nil {
+		t.Error("config without sites was not loaded although no site is enabled")
+	}
+}
+
+func TestLoadCaddyfileSkippedUnderRoot(t *testing.T) {
+	sm, _ := newTestManager(t)
+	sm.Config.ReloadMethod = config.ReloadAdminAPI
+	sm.Admin = NewCaddyAdmin("http://127.0.0.1:1")
+	sm.Admin.Client = &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		t.Errorf("admin API request under --root: %s %s", r.Method, r.URL)
+		return nil, io.EOF
+	})}
+
+	if err := sm.loadCaddyfile(); err != nil {
+		t.Fatalf("loadCaddyfile: %v", err)
+	}
+	if _, err := sm.adaptCaddyfile(sm.Config.Path(sm.Config.CaddyFile), sm.Config.Path(sm.Config.EnabledSites)); err != nil {
+		t.Fatalf("adaptCaddyfile: %v", err)
+	}
+}
+
+// roundTripperFunc adapts a function to http.RoundTripper
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestRejectedLoadRestoresConfig(t *testing.T) {
+	stub := &adminStub{
+		adaptResponse: adaptedOneSite,
+		loadStatus:    http.StatusBadRequest,
+		loadResponse:  `{"error":"loading new config: http app module: start: listening on :443: address already in use"}`,
+	}
+	sm := newAPIManager(t, stub)
+
+	err := sm.activateConfig(enableTestSite(sm, "example.com")...)
+	if err == nil || !strings.Contains(err.Error(), "caddy rejected the config") || !strings.Contains(err.Error(), "previous config restored") {
+		t.Fatalf("activateConfig error = %v", err)
+	}
+	if stub.loaded == nil {
+		t.Fatal("config was not loaded")
+	}
+	for _, path := range []string{sm.siteConfigFile("example.com"), sm.siteSymlink("example.com")} {
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			t.Errorf("%s is still in place after Caddy rejected the config", path)
+		}
+	}
+}
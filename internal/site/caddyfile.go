@@ -0,0 +1,230 @@
+package site
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// caddyfileImport matches an import directive and its file pattern or
+// snippet name
+var caddyfileImport = regexp.MustCompile(`(?m)^([ \t]*import[ \t]+)("[^"\n]*"|[^\s"]+)`)
+
+// caddyfileSnippet matches the definition of a snippet such as (common) {
+var caddyfileSnippet = regexp.MustCompile(`(?m)^[ \t]*\(([^)\s]+)\)`)
+
+// absoluteImports resolves the relative file imports of a Caddyfile against
+// dir. Caddy resolves them against the directory of the importing file, which
+// a Caddyfile posted to the admin API does not have, so they would otherwise
+// be resolved against the working directory of the Caddy process.
+func absoluteImports(content []byte, dir string) []byte {
+	snippets := make(map[string]bool)
+	for _, match := range caddyfileSnippet.FindAllSubmatch(content, -1) {
+		snippets[string(match[1])] = true
+	}
+
+	return caddyfileImport.ReplaceAllFunc(content, func(match []byte) []byte {
+		groups := caddyfileImport.FindSubmatch(match)
+		prefix, pattern := string(groups[1]), string(groups[2])
+		quoted := strings.HasPrefix(pattern, `"`)
+		pattern = strings.Trim(pattern, `"`)
+
+		// Snippets and environment placeholders are left to Caddy
+		if pattern == "" || filepath.IsAbs(pattern) || snippets[pattern] || strings.HasPrefix(pattern, "{") {
+			return match
+		}
+
+		pattern = filepath.Join(dir, pattern)
+		if quoted {
+			pattern = `"` + pattern + `"`
+		}
+		return []byte(prefix + pattern)
+	})
+}
+
+// caddyfileImports returns the absolute file patterns a Caddyfile imports,
+// with relative ones resolved against dir. Imports of snippets are left out.
+func caddyfileImports(content []byte, dir string) []string {
+	var patterns []string
+	for _, match := range caddyfileImport.FindAllSubmatch(absoluteImports(content, dir), -1) {
+		if pattern := strings.Trim(string(match[2]), `"`); filepath.IsAbs(pattern) {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// checkSitesImported verifies that the imports of a Caddyfile cover every site
+// config in enabledDir. Caddy only warns about an import that matches nothing,
+// so a Caddyfile that misses the site configs would pass validation while
+// serving none of them. A missing Caddyfile is left for Caddy to report.
+func checkSitesImported(caddyfile, enabledDir string) error {
+	content, err := os.ReadFile(caddyfile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	imported := make(map[string]bool)
+	for _, pattern := range caddyfileImports(content, filepath.Dir(caddyfile)) {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			continue
+		}
+		for _, match := range matches {
+			imported[filepath.Clean(match)] = true
+		}
+	}
+
+	entries, err := os.ReadDir(enabledDir)
+	if err != nil {
+		return err
+	}
+	var sites, missing []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		sites = append(sites, entry.Name())
+		if !imported[filepath.Join(enabledDir, entry.Name())] {
+			missing = append(missing, entry.Name())
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("the Caddyfile does not import %d of %d enabled sites (%s); add an import of enabled-sites/*",
+			len(missing), len(sites), strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// countSiteConfigs returns the number of site configs in a directory such as
+// enabled-sites. Hidden files, such as leftovers of atomic swaps, are left out.
+func countSiteConfigs(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), ".") {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// adaptedSiteBlocks returns the number of routes of the HTTP servers in an
+// adapted config. Every site block of the Caddyfile becomes one route.
+func adaptedSiteBlocks(config json.RawMessage) int {
+	var adapted struct {
+		Apps struct {
+			HTTP struct {
+				Servers map[string]struct {
+					Routes []json.RawMessage `json:"routes"`
+				} `json:"servers"`
+			} `json:"http"`
+		} `json:"apps"`
+	}
+	if err := json.Unmarshal(config, &adapted); err != nil {
+		return 0
+	}
+
+	count := 0
+	for _, server := range adapted.Apps.HTTP.Servers {
+		count += len(server.Routes)
+	}
+	return count
+}
+
+// caddyfileToken is a token of a Caddyfile and the byte offset it starts at
+type caddyfileToken struct {
+	offset int
+	text   string
+	quoted bool
+}
+
+// caddyfileTokens splits a Caddyfile into tokens the way Caddy's lexer does.
+// Comments are dropped, and a token that starts with a double quote or
+// backquote runs to the closing quote, so braces and # inside it are text.
+// Only an unquoted { or } token opens or closes a block; placeholders such as
+// {host} are single tokens.
+func caddyfileTokens(text string) ([]caddyfileToken, error) {
+	var tokens []caddyfileToken
+	var val strings.Builder
+	start, line := -1, 1
+	var quote rune
+	escaped, comment := false, false
+
+	emit := func() {
+		if start >= 0 {
+			tokens = append(tokens, caddyfileToken{offset: start, text: val.String(), quoted: quote != 0})
+		}
+		val.Reset()
+		start, quote = -1, 0
+	}
+
+	for i, r := range text {
+		if r == '\n' {
+			line++
+		}
+
+		if quote != 0 {
+			switch {
+			case escaped:
+				escaped = false
+				if r != quote {
+					val.WriteRune('\\')
+				}
+				val.WriteRune(r)
+			case r == '\\' && quote == '"':
+				escaped = true
+			case r == quote:
+				emit()
+			default:
+				val.WriteRune(r)
+			}
+			continue
+		}
+
+		if unicode.IsSpace(r) {
+			if r == '\n' {
+				comment = false
+			}
+			emit()
+			continue
+		}
+		if comment {
+			continue
+		}
+		if start < 0 {
+			if r == '#' {
+				comment = true
+				continue
+			}
+			start = i
+			if r == '"' || r == '`' {
+				quote = r
+				continue
+			}
+		}
+		if escaped {
+			escaped = false
+		} else if r == '\\' {
+			escaped = true
+			continue
+		}
+		val.WriteRune(r)
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quoted string on line %d", line)
+	}
+	emit()
+	return tokens, nil
+}
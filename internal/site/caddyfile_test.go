@@ -0,0 +1,57 @@
+package site
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAbsoluteImports(t *testing.T) {
+	caddyfile := `(common) {
+	encode gzip
+}
+
+import enabled-sites/*
+import "conf.d/*.caddy"
+import /etc/caddy/snippets/*
+import {$SITES_DIR}/*
+
+example.com {
+	import common
+	import ./extra/headers
+}
+`
+	want := `(common) {
+	encode gzip
+}
+
+import /etc/caddy/enabled-sites/*
+import "/etc/caddy/conf.d/*.caddy"
+import /etc/caddy/snippets/*
+import {$SITES_DIR}/*
+
+example.com {
+	import common
+	import /etc/caddy/extra/headers
+}
+`
+	if got := string(absoluteImports([]byte(caddyfile), "/etc/caddy")); got != want {
+		t.Errorf("absoluteImports() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestAdaptedSiteBlocks(t *testing.T) {
+	tests := []struct {
+		config string
+		want   int
+	}{
+		{`{"apps":{"http":{"servers":{"srv0":{"routes":[{},{}]},"srv1":{"routes":[{}]}}}}}`, 3},
+		{`{"apps":{"tls":{}}}`, 0},
+		{`{}`, 0},
+		{`null`, 0},
+	}
+	for _, tt := range tests {
+		if got := adaptedSiteBlocks(json.RawMessage(tt.config)); got != tt.want {
+			t.Errorf("adaptedSiteBlocks(%s) = %d, want %d", tt.config, got, tt.want)
+		}
+	}
+}
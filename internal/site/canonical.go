@@ -0,0 +1,89 @@
+package site
+
+import (
+	"fmt"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+	"golang.org/x/net/publicsuffix"
+)
+
+// defaultCanonical returns the canonical policy for a new site. Only
+// registrable domains such as example.com or example.co.uk get a www.
+// redirect; for subdomains such as blog.example.com and internal names a www.
+// host is almost never wanted.
+func defaultCanonical(domain string) string {
+	if _, icann := publicsuffix.PublicSuffix(domain); !icann {
+		return database.CanonicalNone
+	}
+	if apex, err := publicsuffix.EffectiveTLDPlusOne(domain); err == nil && apex == domain {
+		return database.CanonicalApex
+	}
+	return database.CanonicalNone
+}
+
+// validateCanonical checks a canonical policy name
+func validateCanonical(policy string) error {
+	switch policy {
+	case database.CanonicalApex, database.CanonicalWWW, database.CanonicalNone:
+		return nil
+	}
+	return fmt.Errorf("invalid canonical policy %q (use %s, %s or %s)",
+		policy, database.CanonicalApex, database.CanonicalWWW, database.CanonicalNone)
+}
+
+// canonicalHosts returns the host a site is served on and the host that
+// redirects to it, which is empty when the policy is none
+func canonicalHosts(site *database.Site) (primary, redirect string) {
+	switch site.Canonical {
+	case database.CanonicalWWW:
+		return "www." + site.Domain, site.Domain
+	case database.CanonicalNone:
+		return site.Domain, ""
+	default:
+		return site.Domain, "www." + site.Domain
+	}
+}
+
+// SetCanonical changes which of a site's domain and www. host is canonical
+func (sm *SQLiteSiteManager) SetCanonical(domain, policy string) error {
+	if sm.Config.Verbose {
+		fmt.Fprintf(sm.Out, "Setting canonical host policy of %s to %s\n", domain, policy)
+	}
+
+	if err := validateCanonical(policy); err != nil {
+		return err
+	}
+
+	// Get site from database
+	site, err := sm.DB.GetSite(domain)
+	if err != nil {
+		return err
+	}
+
+	// The www. host must not be taken by another site before it is used
+	if site.Canonical == database.CanonicalNone && policy != database.CanonicalNone {
+		if owner, err := sm.DB.HostnameOwner("www." + domain); err != nil {
+			return err
+		} else if owner != "" {
+			return fmt.Errorf("hostname www.%s already belongs to %s", domain, owner)
+		}
+	}
+
+	if sm.Config.DryRun {
+		if sm.Config.Verbose {
+			fmt.Fprintf(sm.Out, "Would change canonical host policy from %s to %s\n", site.Canonical, policy)
+		}
+		return nil
+	}
+
+	previous := *site
+	site.Canonical = policy
+	if err := sm.DB.UpdateSite(site); err != nil {
+		return fmt.Errorf("failed to update site in database: %v", err)
+	}
+
+	// Regenerate Caddy configuration and reload Caddy
+	return sm.updateSiteConfig(site, func() error {
+		return sm.DB.UpdateSite(&previous)
+	})
+}
@@ -0,0 +1,29 @@
+package site
+
+import (
+	"testing"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+func TestDefaultCanonical(t *testing.T) {
+	tests := []struct {
+		domain string
+		want   string
+	}{
+		{"example.com", database.CanonicalApex},
+		{"example.co.uk", database.CanonicalApex},
+		{"example.com.au", database.CanonicalApex},
+		{"blog.example.com", database.CanonicalNone},
+		{"blog.example.co.uk", database.CanonicalNone},
+		{"intranet.lan", database.CanonicalNone},
+		{"myapp.github.io", database.CanonicalNone},
+		{"co.uk", database.CanonicalNone},
+		{"localhost", database.CanonicalNone},
+	}
+	for _, tt := range tests {
+		if got := defaultCanonical(tt.domain); got != tt.want {
+			t.Errorf("defaultCanonical(%q) = %s, want %s", tt.domain, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package site
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/tankadesign/caddy-site-manager/internal/config"
+)
+
+// defaultMySQLSocket is the socket of MySQL and MariaDB on Debian and Ubuntu
+const defaultMySQLSocket = "/var/run/mysqld/mysqld.sock"
+
+// databaseUserHost is the host part of the accounts created for sites
+const databaseUserHost = "localhost"
+
+// DatabaseProvisioner creates and removes the MySQL databases and users of
+// sites. Users are accounts on localhost.
+type DatabaseProvisioner interface {
+	DatabaseExists(name string) (bool, error)
+	UserExists(user string) (bool, error)
+	// CreateDatabase creates a database and a user with all privileges on
+	// it. Existing databases and users are kept.
+	CreateDatabase(name, user, password string) error
+	DropDatabase(name string) error
+	DropUser(user string) error
+}
+
+// MySQLProvisioner provisions databases over a connection as an admin user.
+// The connection is opened on first use, so commands that do not touch
+// databases work without MySQL.
+type MySQLProvisioner struct {
+	Config *config.CaddyConfig
+	db     *sql.DB
+}
+
+// NewMySQLProvisioner creates a provisioner with the connection settings of
+// the configuration
+func NewMySQLProvisioner(cfg *config.CaddyConfig) *MySQLProvisioner {
+	return &MySQLProvisioner{Config: cfg}
+}
+
+// connectionConfig returns the driver settings of the admin connection
+func (p *MySQLProvisioner) connectionConfig() (*mysql.Config, error) {
+	settings := map[string]string{}
+	if p.Config.MySQLCredentialsFile != "" {
+		var err error
+		settings, err = readMySQLCredentials(p.Config.MySQLCredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read MySQL credentials file: %v", err)
+		}
+	}
+
+	// Explicit settings win over the credentials file
+	for key, value := range map[string]string{"socket": p.Config.MySQLSocket, "host": p.Config.MySQLHost, "user": p.Config.MySQLUser} {
+		if value != "" {
+			settings[key] = value
+		}
+	}
+
+	mc := mysql.NewConfig()
+	mc.User = valueOrDefault(settings["user"], "root")
+	mc.Passwd = settings["password"]
+	// Identifiers cannot be placeholders, but account names and passwords
+	// are interpolated and escaped by the driver
+	mc.InterpolateParams = true
+	if host := settings["host"]; host != "" && host != "localhost" {
+		mc.Net = "tcp"
+		mc.Addr = net.JoinHostPort(host, valueOrDefault(settings["port"], "3306"))
+	} else {
+		mc.Net = "unix"
+		mc.Addr = valueOrDefault(settings["socket"], defaultMySQLSocket)
+	}
+	return mc, nil
+}
+
+// valueOrDefault returns value, or fallback if it is empty
+func valueOrDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// readMySQLCredentials reads the [client] section of a my.cnf style file such
+// as /etc/mysql/debian.cnf
+func readMySQLCredentials(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseMySQLCredentials(f)
+}
+
+// parseMySQLCredentials parses the [client] section of a my.cnf style file
+func parseMySQLCredentials(r io.Reader) (map[string]string, error) {
+	settings := map[string]string{}
+	section := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != "client" {
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		key = strings.ReplaceAll(strings.TrimSpace(key), "-", "_")
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		settings[key] = value
+	}
+	return settings, scanner.Err()
+}
+
+// conn returns the admin connection, opening it on first use
+func (p *MySQLProvisioner) conn() (*sql.DB, error) {
+	if p.db != nil {
+		return p.db, nil
+	}
+
+	mc, err := p.connectionConfig()
+	if err != nil {
+		return nil, err
+	}
+	connector, err := mysql.NewConnector(mc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MySQL connection settings: %v", err)
+	}
+	db := sql.OpenDB(connector)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to MySQL as %s via %s(%s): %v", mc.User, mc.Net, mc.Addr, err)
+	}
+
+	p.db = db
+	return db, nil
+}
+
+// exists runs a counting query and reports whether it found a row
+func (p *MySQLProvisioner) exists(query string, args ...interface{}) (bool, error) {
+	db, err := p.conn()
+	if err != nil {
+		return false, err
+	}
+	var count int
+	if err := db.QueryRow(query, args...).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// statement is a SQL statement with the values of its placeholders
+type statement struct {
+	query string
+	args  []interface{}
+}
+
+// exec runs statements in order and stops at the first error
+func (p *MySQLProvisioner) exec(statements ...statement) error {
+	db, err := p.conn()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt.query, stmt.args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DatabaseExists reports whether a database exists
+func (p *MySQLProvisioner) DatabaseExists(name string) (bool, error) {
+	return p.exists(`SELECT COUNT(*) FROM INFORMATION_SCHEMA.SCHEMATA WHERE SCHEMA_NAME = ?`, name)
+}
+
+// UserExists reports whether a user exists on localhost
+func (p *MySQLProvisioner) UserExists(user string) (bool, error) {
+	return p.exists(`SELECT COUNT(*) FROM mysql.user WHERE User = ? AND Host = ?`, user, databaseUserHost)
+}
+
+// CreateDatabase creates a database and a user with all privileges on it
+func (p *MySQLProvisioner) CreateDatabase(name, user, password string) error {
+	err := p.exec(
+		statement{query: "CREATE DATABASE IF NOT EXISTS " + quoteIdentifier(name)},
+		statement{query: "CREATE USER IF NOT EXISTS ?@? IDENTIFIED BY ?", args: []interface{}{user, databaseUserHost, password}},
+		statement{query: "GRANT ALL PRIVILEGES ON " + quoteIdentifier(name) + ".* TO ?@?", args: []interface{}{user, databaseUserHost}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create database %s for user %s: %v", name, user, err)
+	}
+	return nil
+}
+
+// DropDatabase removes a database if it exists
+func (p *MySQLProvisioner) DropDatabase(name string) error {
+	if err := p.exec(statement{query: "DROP DATABASE IF EXISTS " + quoteIdentifier(name)}); err != nil {
+		return fmt.Errorf("failed to drop database %s: %v", name, err)
+	}
+	return nil
+}
+
+// DropUser removes a user on localhost if it exists
+func (p *MySQLProvisioner) DropUser(user string) error {
+	if err := p.exec(statement{query: "DROP USER IF EXISTS ?@?", args: []interface{}{user, databaseUserHost}}); err != nil {
+		return fmt.Errorf("failed to drop database user %s: %v", user, err)
+	}
+	return nil
+}
+
+// quoteIdentifier quotes a database or table name for MySQL
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// sandboxProvisioner is used when all paths are staged below a root prefix.
+// The MySQL server of the host is left alone: nothing exists and every change
+// is skipped.
+type sandboxProvisioner struct {
+	sm *SQLiteSiteManager
+}
+
+// skip reports a skipped change in verbose mode
+func (p sandboxProvisioner) skip(format string, args ...interface{}) error {
+	if p.sm.Config.Verbose {
+		fmt.Fprintf(p.sm.Out, "Sandbox: skipping MySQL "+format+"\n", args...)
+	}
+	return nil
+}
+
+func (p sandboxProvisioner) DatabaseExists(name string) (bool, error) { return false, nil }
+
+func (p sandboxProvisioner) UserExists(user string) (bool, error) { return false, nil }
+
+func (p sandboxProvisioner) CreateDatabase(name, user, password string) error {
+	return p.skip("create database %s for user %s", name, user)
+}
+
+func (p sandboxProvisioner) DropDatabase(name string) error {
+	return p.skip("drop database %s", name)
+}
+
+func (p sandboxProvisioner) DropUser(user string) error {
+	return p.skip("drop user %s", user)
+}
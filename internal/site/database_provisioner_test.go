@@ -0,0 +1,223 @@
+package site
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tankadesign/caddy-site-manager/internal/config"
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := map[string]string{
+		"example_com":   "`example_com`",
+		"my-site.db":    "`my-site.db`",
+		"evil`; DROP x": "`evil``; DROP x`",
+		"``":            "``````",
+	}
+	for name, want := range tests {
+		if got := quoteIdentifier(name); got != want {
+			t.Errorf("quoteIdentifier(%q) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestParseMySQLCredentials(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want map[string]string
+	}{
+		{
+			name: "debian.cnf",
+			file: `# Automatically generated for Debian scripts. DO NOT TOUCH!
+[client]
+host     = localhost
+user     = debian-sys-maint
+password = s3cr3t
+socket   = /var/run/mysqld/mysqld.sock
+[mysql_upgrade]
+host     = localhost
+user     = upgrade-user
+password = other
+`,
+			want: map[string]string{
+				"host":     "localhost",
+				"user":     "debian-sys-maint",
+				"password": "s3cr3t",
+				"socket":   "/var/run/mysqld/mysqld.sock",
+			},
+		},
+		{
+			name: "quoted values",
+			file: "[client]\npassword = \"with # and = inside\"\nuser='admin'\n",
+			want: map[string]string{"password": "with # and = inside", "user": "admin"},
+		},
+		{
+			name: "dashed keys and comments",
+			file: "; comment\n[client]\n# comment\nssl-mode = DISABLED\nport=3307\n",
+			want: map[string]string{"ssl_mode": "DISABLED", "port": "3307"},
+		},
+		{
+			name: "no client section",
+			file: "[mysqld]\nuser = mysql\n",
+			want: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMySQLCredentials(strings.NewReader(tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMySQLCredentials() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnectionConfig(t *testing.T) {
+	credentials := filepath.Join(t.TempDir(), "debian.cnf")
+	if err := os.WriteFile(credentials, []byte("[client]\nuser = maint\npassword = pw\nsocket = /run/mysqld/other.sock\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tcpCredentials := filepath.Join(t.TempDir(), "remote.cnf")
+	if err := os.WriteFile(tcpCredentials, []byte("[client]\nhost = db.internal\nport = 3307\nuser = maint\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name             string
+		cfg              config.CaddyConfig
+		user, passwd     string
+		network, address string
+	}{
+		{
+			name: "defaults", user: "root",
+			network: "unix", address: defaultMySQLSocket,
+		},
+		{
+			name: "credentials file", cfg: config.CaddyConfig{MySQLCredentialsFile: credentials},
+			user: "maint", passwd: "pw", network: "unix", address: "/run/mysqld/other.sock",
+		},
+		{
+			name: "config overrides credentials file",
+			cfg:  config.CaddyConfig{MySQLCredentialsFile: credentials, MySQLUser: "admin", MySQLSocket: "/tmp/mysql.sock"},
+			user: "admin", passwd: "pw", network: "unix", address: "/tmp/mysql.sock",
+		},
+		{
+			name: "tcp host from credentials file", cfg: config.CaddyConfig{MySQLCredentialsFile: tcpCredentials},
+			user: "maint", network: "tcp", address: "db.internal:3307",
+		},
+		{
+			name: "tcp host from config", cfg: config.CaddyConfig{MySQLHost: "10.0.0.5"},
+			user: "root", network: "tcp", address: "10.0.0.5:3306",
+		},
+		{
+			name: "localhost uses the socket", cfg: config.CaddyConfig{MySQLHost: "localhost"},
+			user: "root", network: "unix", address: defaultMySQLSocket,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			mc, err := NewMySQLProvisioner(&cfg).connectionConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mc.User != tt.user || mc.Passwd != tt.passwd || mc.Net != tt.network || mc.Addr != tt.address {
+				t.Errorf("got %s:%s@%s(%s), want %s:%s@%s(%s)", mc.User, mc.Passwd, mc.Net, mc.Addr, tt.user, tt.passwd, tt.network, tt.address)
+			}
+			if !mc.InterpolateParams {
+				t.Error("parameters are not interpolated by the driver")
+			}
+		})
+	}
+
+	cfg := config.CaddyConfig{MySQLCredentialsFile: filepath.Join(t.TempDir(), "missing.cnf")}
+	if _, err := NewMySQLProvisioner(&cfg).connectionConfig(); err == nil {
+		t.Error("missing credentials file was accepted")
+	}
+}
+
+// fakeProvisioner is a DatabaseProvisioner that keeps databases and users in
+// memory and records the changes made. With createErr set, CreateDatabase
+// fails after creating the user, like a failed grant.
+type fakeProvisioner struct {
+	databases map[string]bool
+	users     map[string]bool
+	calls     []string
+	createErr error
+}
+
+func newFakeProvisioner() *fakeProvisioner {
+	return &fakeProvisioner{databases: make(map[string]bool), users: make(map[string]bool)}
+}
+
+func (p *fakeProvisioner) DatabaseExists(name string) (bool, error) { return p.databases[name], nil }
+
+func (p *fakeProvisioner) UserExists(user string) (bool, error) { return p.users[user], nil }
+
+func (p *fakeProvisioner) CreateDatabase(name, user, password string) error {
+	p.calls = append(p.calls, "create "+name+" "+user)
+	if p.createErr != nil {
+		p.users[user] = true
+		return p.createErr
+	}
+	p.databases[name], p.users[user] = true, true
+	return nil
+}
+
+func (p *fakeProvisioner) DropDatabase(name string) error {
+	p.calls = append(p.calls, "drop database "+name)
+	delete(p.databases, name)
+	return nil
+}
+
+func (p *fakeProvisioner) DropUser(user string) error {
+	p.calls = append(p.calls, "drop user "+user)
+	delete(p.users, user)
+	return nil
+}
+
+func TestProvisionDatabaseRollback(t *testing.T) {
+	tests := []struct {
+		name        string
+		userExisted bool
+		want        []string
+	}{
+		{"new user", false, []string{"create example_com example_com", "drop database example_com", "drop user example_com"}},
+		{"existing user is kept", true, []string{"create example_com example_com", "drop database example_com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm, _ := newTestManager(t)
+			databases := newFakeProvisioner()
+			databases.users["example_com"] = tt.userExisted
+			sm.Databases = databases
+
+			site := &database.Site{Domain: "example.com", DBName: "example_com", DBUser: "example_com", DBPassword: "secret"}
+			j := sm.newJournal()
+			if err := sm.provisionDatabase(site, j); err != nil {
+				t.Fatalf("provisionDatabase: %v", err)
+			}
+			if err := j.rollback(); err != nil {
+				t.Fatalf("rollback: %v", err)
+			}
+
+			if !reflect.DeepEqual(databases.calls, tt.want) {
+				t.Errorf("calls = %q, want %q", databases.calls, tt.want)
+			}
+			if databases.databases["example_com"] {
+				t.Error("database was not dropped")
+			}
+			if databases.users["example_com"] != tt.userExisted {
+				t.Errorf("user exists = %v after rollback, want %v", databases.users["example_com"], tt.userExisted)
+			}
+		})
+	}
+}
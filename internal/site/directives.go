@@ -0,0 +1,197 @@
+package site
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+// configHash returns the hash that identifies a rendered Caddy config
+func configHash(config string) string {
+	sum := sha256.Sum256([]byte(config))
+	return hex.EncodeToString(sum[:])
+}
+
+// validateDirectives checks that extra directives cannot close the site
+// block they are inserted into. Braces in comments and quoted strings do not
+// count.
+func validateDirectives(directives string) error {
+	tokens, err := caddyfileTokens(directives)
+	if err != nil {
+		return fmt.Errorf("invalid extra directives: %v", err)
+	}
+
+	depth := 0
+	for _, token := range tokens {
+		if token.quoted {
+			continue
+		}
+		switch token.text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth < 0 {
+				return fmt.Errorf("extra directives close a block that they did not open")
+			}
+		}
+	}
+	if depth != 0 {
+		return fmt.Errorf("extra directives have %d unclosed block(s)", depth)
+	}
+	return nil
+}
+
+// siteBlockEnd returns the index of the brace that closes the first block of
+// a Caddy config, or -1 if there is none
+func siteBlockEnd(config string) int {
+	tokens, err := caddyfileTokens(config)
+	if err != nil {
+		return -1
+	}
+
+	depth := 0
+	for _, token := range tokens {
+		if token.quoted {
+			continue
+		}
+		switch token.text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth == 0 {
+				return token.offset
+			}
+		}
+	}
+	return -1
+}
+
+// addDirectivesToConfig inserts extra directives at the end of the site block
+func addDirectivesToConfig(config, domain, directives string) string {
+	end := siteBlockEnd(config)
+	if end == -1 {
+		return config
+	}
+	lineStart := strings.LastIndex(config[:end], "\n") + 1
+
+	var block strings.Builder
+	fmt.Fprintf(&block, "\n\t# Extra directives (caddy-site-manager directives edit %s)\n", domain)
+	for _, line := range strings.Split(directives, "\n") {
+		if strings.TrimSpace(line) == "" {
+			block.WriteString("\n")
+			continue
+		}
+		block.WriteString("\t" + line + "\n")
+	}
+
+	return config[:lineStart] + block.String() + config[lineStart:]
+}
+
+// renderCaddyConfig renders the complete Caddy config of a site: the template,
+// its basic auth routes and its extra directives
+func (sm *SQLiteSiteManager) renderCaddyConfig(site *database.Site, auths []database.BasicAuth) (string, error) {
+	tmpl, err := sm.caddyTemplate(site)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := sm.caddyTemplateData(site)
+	if err != nil {
+		return "", err
+	}
+
+	var config strings.Builder
+	if err := tmpl.Execute(&config, data); err != nil {
+		return "", fmt.Errorf("failed to execute template: %v", err)
+	}
+
+	result := config.String()
+
+	// Add basic auth blocks if any exist
+	if len(auths) > 0 {
+		result = sm.addBasicAuthToConfig(result, auths)
+	}
+
+	if site.ExtraDirectives != "" {
+		result = addDirectivesToConfig(result, site.Domain, site.ExtraDirectives)
+	}
+
+	return result, nil
+}
+
+// configModified reports whether the Caddy config of a site was changed on
+// disk since it was last written. Sites imported from existing configs have
+// no recorded hash and are never reported.
+func (sm *SQLiteSiteManager) configModified(site *database.Site) (bool, error) {
+	if site.ConfigHash == "" {
+		return false, nil
+	}
+
+	content, err := os.ReadFile(sm.siteConfigFile(site.Domain))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	return configHash(string(content)) != site.ConfigHash, nil
+}
+
+// ExtraDirectives returns the extra Caddy directives of a site
+func (sm *SQLiteSiteManager) ExtraDirectives(domain string) (string, error) {
+	site, err := sm.DB.GetSite(domain)
+	if err != nil {
+		return "", err
+	}
+	return site.ExtraDirectives, nil
+}
+
+// SetExtraDirectives replaces the extra Caddy directives of a site, which are
+// added to its site block every time the config is rendered. If Caddy rejects
+// the resulting config, the previous directives are kept.
+func (sm *SQLiteSiteManager) SetExtraDirectives(domain, directives string) error {
+	directives = strings.TrimRight(directives, " \t\r\n")
+
+	if sm.Config.Verbose {
+		fmt.Fprintf(sm.Out, "Setting extra directives for %s\n", domain)
+	}
+
+	if err := validateDirectives(directives); err != nil {
+		return err
+	}
+
+	// Get site from database
+	site, err := sm.DB.GetSite(domain)
+	if err != nil {
+		return err
+	}
+
+	if sm.Config.DryRun {
+		if sm.Config.Verbose {
+			fmt.Fprintf(sm.Out, "Would set extra directives:\n%s\n", directives)
+		}
+		return nil
+	}
+
+	previous := site.ExtraDirectives
+	site.ExtraDirectives = directives
+	if err := sm.DB.UpdateSite(site); err != nil {
+		return fmt.Errorf("failed to update site in database: %v", err)
+	}
+
+	// Regenerate Caddy configuration, restoring the previous directives if
+	// the new ones are rejected
+	return sm.updateSiteConfig(site, func() error {
+		site.ExtraDirectives = previous
+		return sm.DB.UpdateSite(site)
+	})
+}
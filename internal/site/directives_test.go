@@ -0,0 +1,48 @@
+package site
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateDirectives(t *testing.T) {
+	tests := []struct {
+		directives string
+		err        string
+	}{
+		{directives: "encode gzip"},
+		{directives: "handle /api/* {\n\treverse_proxy localhost:8080\n}"},
+		{directives: `respond "{}" 200`},
+		{directives: `respond "}"`},
+		{directives: "respond `{ \"ok\": true`"},
+		{directives: `header X-Braces "a } b"`},
+		{directives: "# }\nencode gzip"},
+		{directives: "respond {host} # {"},
+		{directives: `respond "say \"}\""`},
+		{directives: "}", err: "close a block"},
+		{directives: "# {\n}", err: "close a block"},
+		{directives: "handle {\n\trespond \"}\"", err: "1 unclosed block"},
+		{directives: `respond "unterminated }`, err: "unterminated quoted string"},
+	}
+	for _, tt := range tests {
+		err := validateDirectives(tt.directives)
+		if tt.err == "" && err != nil {
+			t.Errorf("validateDirectives(%q) = %v", tt.directives, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("validateDirectives(%q) = %v, want error containing %q", tt.directives, err, tt.err)
+		}
+	}
+}
+
+func TestAddDirectivesToConfig(t *testing.T) {
+	config := "example.com {\n\t# the } in this comment does not close the block\n\trespond \"{}\" 200\n\theader X-Test \"a } b\"\n}\n\nwww.example.com {\n\tredir https://example.com{uri}\n}\n"
+
+	got := addDirectivesToConfig(config, "example.com", "encode gzip")
+	want := "example.com {\n\t# the } in this comment does not close the block\n\trespond \"{}\" 200\n\theader X-Test \"a } b\"\n" +
+		"\n\t# Extra directives (caddy-site-manager directives edit example.com)\n\tencode gzip\n" +
+		"}\n\nwww.example.com {\n\tredir https://example.com{uri}\n}\n"
+	if got != want {
+		t.Errorf("addDirectivesToConfig:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -2,15 +2,18 @@ package site
 
 import (
 	"fmt"
+	"io"
+	"os"
 
 	"github.com/tankadesign/caddy-site-manager/internal/config"
 	"github.com/tankadesign/caddy-site-manager/internal/database"
+	"github.com/tankadesign/caddy-site-manager/internal/secrets"
 )
 
 // NewManager creates the SQLite-based site manager
 func NewManager(cfg *config.CaddyConfig) (Manager, error) {
 	// Create SQLite database connection
-	db, err := database.NewDB(cfg.DatabasePath)
+	db, err := OpenDatabase(cfg, os.Stdout)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create database connection: %v", err)
 	}
@@ -18,3 +21,46 @@ func NewManager(cfg *config.CaddyConfig) (Manager, error) {
 	// Create SQLite-based manager
 	return NewSQLiteSiteManager(cfg, db)
 }
+
+// OpenDatabase opens the site database with credential encryption enabled.
+// The encryption key is created on first use unless it comes from the
+// environment or this is a dry run; progress is written to out.
+func OpenDatabase(cfg *config.CaddyConfig, out io.Writer) (*database.DB, error) {
+	cipher, err := LoadCipher(cfg, out)
+	if err != nil {
+		return nil, err
+	}
+
+	return database.NewDB(cfg.Path(cfg.DatabasePath), cipher)
+}
+
+// LoadCipher loads the credential encryption key, creating the key file if
+// needed. In a dry run a missing key is not created and no cipher returned.
+func LoadCipher(cfg *config.CaddyConfig, out io.Writer) (*secrets.Cipher, error) {
+	keyFile := cfg.Path(cfg.KeyFile)
+
+	key, err := secrets.LoadKey(keyFile)
+	if os.IsNotExist(err) {
+		if cfg.DryRun {
+			if cfg.Verbose {
+				fmt.Fprintf(out, "Would create encryption key: %s\n", keyFile)
+			}
+			return nil, nil
+		}
+
+		key, err = secrets.GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		if err := secrets.WriteKeyFile(keyFile, key); err != nil {
+			return nil, err
+		}
+		if cfg.Verbose {
+			fmt.Fprintf(out, "Created encryption key: %s\n", keyFile)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load encryption key: %v", err)
+	}
+
+	return secrets.NewCipher(key)
+}
@@ -0,0 +1,263 @@
+package site
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+// DefaultHeaderProfile is used for sites without a header profile
+const DefaultHeaderProfile = "basic"
+
+// builtinHeaderProfiles are the header profiles available without a config
+// file. Profiles of the same name in the config file replace them.
+var builtinHeaderProfiles = map[string][]string{
+	"basic": {
+		"X-Content-Type-Options: nosniff",
+		"Referrer-Policy: strict-origin-when-cross-origin",
+	},
+	"strict": {
+		"Strict-Transport-Security: max-age=31536000; includeSubDomains",
+		"X-Content-Type-Options: nosniff",
+		"Referrer-Policy: strict-origin-when-cross-origin",
+		"Content-Security-Policy: default-src 'self'; frame-ancestors 'self'; base-uri 'self'; form-action 'self'",
+		"Permissions-Policy: camera=(), microphone=(), geolocation=()",
+		"X-Frame-Options: SAMEORIGIN",
+	},
+}
+
+// headerNamePattern matches HTTP header field names
+var headerNamePattern = regexp.MustCompile(`^[A-Za-z0-9!#$%&'*+.^_|~-]+$`)
+
+// Header is a response header set by a site, or removed if Remove is set
+type Header struct {
+	Name   string
+	Value  string
+	Remove bool
+}
+
+// String returns the header as a line of a Caddy header block. The value is
+// quoted the Caddyfile way: its lexer only unescapes \" and keeps any other
+// backslash as is, so only quotes are escaped.
+func (h Header) String() string {
+	if h.Remove {
+		return "-" + h.Name
+	}
+	return h.Name + ` "` + strings.ReplaceAll(h.Value, `"`, `\"`) + `"`
+}
+
+// validateHeaderValue checks that a header value can be written to a quoted
+// Caddyfile token
+func validateHeaderValue(value string) error {
+	for _, r := range value {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("invalid header value %q: control characters are not allowed", value)
+		}
+	}
+	if strings.HasSuffix(value, `\`) || strings.Contains(value, `\"`) {
+		return fmt.Errorf("invalid header value %q: a backslash cannot end the value or precede a quote", value)
+	}
+	return nil
+}
+
+// parseHeader parses a header in the form "Name: value", or "-Name" for a
+// header that is removed
+func parseHeader(s string) (Header, error) {
+	s = strings.TrimSpace(s)
+	if name, found := strings.CutPrefix(s, "-"); found {
+		if !headerNamePattern.MatchString(name) {
+			return Header{}, fmt.Errorf("invalid header name: %q", name)
+		}
+		return Header{Name: name, Remove: true}, nil
+	}
+
+	name, value, found := strings.Cut(s, ":")
+	name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+	if !found || value == "" {
+		return Header{}, fmt.Errorf("invalid header %q (use \"Name: value\")", s)
+	}
+	if !headerNamePattern.MatchString(name) {
+		return Header{}, fmt.Errorf("invalid header name: %q", name)
+	}
+	if err := validateHeaderValue(value); err != nil {
+		return Header{}, err
+	}
+	return Header{Name: name, Value: value}, nil
+}
+
+// headerProfiles returns the built-in profiles merged with the profiles of
+// the config file
+func (sm *SQLiteSiteManager) headerProfiles() map[string][]string {
+	profiles := make(map[string][]string)
+	for name, headers := range builtinHeaderProfiles {
+		profiles[name] = headers
+	}
+	for name, headers := range sm.Config.HeaderProfiles {
+		profiles[name] = headers
+	}
+	return profiles
+}
+
+// HeaderProfileNames returns the names of all header profiles in order
+func (sm *SQLiteSiteManager) HeaderProfileNames() []string {
+	var names []string
+	for name := range sm.headerProfiles() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// headerProfileName returns the header profile of a site
+func headerProfileName(site *database.Site) string {
+	if site.HeaderProfile == "" {
+		return DefaultHeaderProfile
+	}
+	return site.HeaderProfile
+}
+
+// validateHeaderProfile checks that a header profile exists and is valid
+func (sm *SQLiteSiteManager) validateHeaderProfile(name string) error {
+	headers, ok := sm.headerProfiles()[name]
+	if !ok {
+		return fmt.Errorf("unknown header profile %q (available: %s)", name, strings.Join(sm.HeaderProfileNames(), ", "))
+	}
+	for _, header := range headers {
+		if _, err := parseHeader(header); err != nil {
+			return fmt.Errorf("header profile %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// siteHeaders returns the response headers of a site: those of its profile
+// with its overrides applied
+func (sm *SQLiteSiteManager) siteHeaders(site *database.Site) ([]Header, error) {
+	profile := headerProfileName(site)
+	if err := sm.validateHeaderProfile(profile); err != nil {
+		return nil, err
+	}
+
+	var headers []Header
+	for _, s := range sm.headerProfiles()[profile] {
+		header, _ := parseHeader(s)
+		headers = append(headers, header)
+	}
+
+	for _, s := range site.HeaderOverrides {
+		override, err := parseHeader(s)
+		if err != nil {
+			return nil, err
+		}
+		headers = setHeader(headers, override)
+	}
+
+	return headers, nil
+}
+
+// setHeader replaces the header of the same name or appends it
+func setHeader(headers []Header, header Header) []Header {
+	for i, h := range headers {
+		if strings.EqualFold(h.Name, header.Name) {
+			headers[i] = header
+			return headers
+		}
+	}
+	return append(headers, header)
+}
+
+// HeaderOptions changes the response headers of a site. Set holds headers in
+// the form "Name: value", Remove and Reset hold header names.
+type HeaderOptions struct {
+	// Profile selects the header profile, empty keeps the current one
+	Profile string
+	// Set adds or replaces headers
+	Set []string
+	// Remove removes headers from responses, including those of the profile
+	Remove []string
+	// Reset drops overrides so the profile applies again
+	Reset []string
+}
+
+// SetHeaders changes the header profile and header overrides of a site
+func (sm *SQLiteSiteManager) SetHeaders(domain string, opts *HeaderOptions) error {
+	if sm.Config.Verbose {
+		fmt.Fprintf(sm.Out, "Updating headers of %s\n", domain)
+	}
+
+	// Get site from database
+	site, err := sm.DB.GetSite(domain)
+	if err != nil {
+		return err
+	}
+	previous := *site
+
+	if opts.Profile != "" {
+		if err := sm.validateHeaderProfile(opts.Profile); err != nil {
+			return err
+		}
+		site.HeaderProfile = opts.Profile
+	}
+
+	overrides := make([]Header, 0, len(site.HeaderOverrides))
+	for _, s := range site.HeaderOverrides {
+		header, err := parseHeader(s)
+		if err != nil {
+			return err
+		}
+		overrides = append(overrides, header)
+	}
+
+	for _, name := range opts.Reset {
+		kept := overrides[:0]
+		for _, h := range overrides {
+			if !strings.EqualFold(h.Name, name) {
+				kept = append(kept, h)
+			}
+		}
+		overrides = kept
+	}
+	for _, s := range opts.Set {
+		header, err := parseHeader(s)
+		if err != nil {
+			return err
+		}
+		overrides = setHeader(overrides, header)
+	}
+	for _, name := range opts.Remove {
+		header, err := parseHeader("-" + name)
+		if err != nil {
+			return err
+		}
+		overrides = setHeader(overrides, header)
+	}
+
+	site.HeaderOverrides = nil
+	for _, h := range overrides {
+		if h.Remove {
+			site.HeaderOverrides = append(site.HeaderOverrides, "-"+h.Name)
+		} else {
+			site.HeaderOverrides = append(site.HeaderOverrides, h.Name+": "+h.Value)
+		}
+	}
+
+	if sm.Config.DryRun {
+		if sm.Config.Verbose {
+			fmt.Fprintf(sm.Out, "Would set header profile %s with overrides: %s\n", headerProfileName(site), strings.Join(site.HeaderOverrides, ", "))
+		}
+		return nil
+	}
+
+	if err := sm.DB.UpdateSite(site); err != nil {
+		return fmt.Errorf("failed to update site in database: %v", err)
+	}
+
+	// Regenerate Caddy configuration and reload Caddy
+	return sm.updateSiteConfig(site, func() error {
+		return sm.DB.UpdateSite(&previous)
+	})
+}
@@ -0,0 +1,53 @@
+package site
+
+import "testing"
+
+func TestHeaderString(t *testing.T) {
+	tests := []struct {
+		header Header
+		want   string
+	}{
+		{Header{Name: "X-Frame-Options", Value: "SAMEORIGIN"}, `X-Frame-Options "SAMEORIGIN"`},
+		{Header{Name: "Content-Security-Policy", Value: `default-src 'self'; report-to "csp"`}, `Content-Security-Policy "default-src 'self'; report-to \"csp\""`},
+		{Header{Name: "X-Greeting", Value: "café ☕"}, `X-Greeting "café ☕"`},
+		{Header{Name: "X-Path", Value: `C:\sites\app`}, `X-Path "C:\sites\app"`},
+		{Header{Name: "Server", Remove: true}, "-Server"},
+	}
+	for _, tt := range tests {
+		if got := tt.header.String(); got != tt.want {
+			t.Errorf("%+v.String() = %s, want %s", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	valid := map[string]Header{
+		"X-Frame-Options: SAMEORIGIN": {Name: "X-Frame-Options", Value: "SAMEORIGIN"},
+		" X-Greeting :  café ":        {Name: "X-Greeting", Value: "café"},
+		"-Server":                     {Name: "Server", Remove: true},
+	}
+	for s, want := range valid {
+		got, err := parseHeader(s)
+		if err != nil {
+			t.Errorf("parseHeader(%q): %v", s, err)
+		} else if got != want {
+			t.Errorf("parseHeader(%q) = %+v, want %+v", s, got, want)
+		}
+	}
+
+	for _, s := range []string{
+		"X-Frame-Options",
+		"X-Frame-Options:",
+		"Bad Name: value",
+		"-Bad Name",
+		"X-Test: a\x00b",
+		"X-Test: a\tb",
+		"X-Test: a\x7fb",
+		`X-Test: trailing\`,
+		`X-Test: a\"b`,
+	} {
+		if _, err := parseHeader(s); err == nil {
+			t.Errorf("parseHeader(%q) succeeded, want error", s)
+		}
+	}
+}
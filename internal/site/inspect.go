@@ -0,0 +1,131 @@
+package site
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+	"github.com/tankadesign/caddy-site-manager/internal/wordpress"
+)
+
+// SiteDetail is a site as stored in the database together with facts derived
+// from the host: which of its files exist and whether they match the database
+type SiteDetail struct {
+	database.Site `yaml:",inline"`
+
+	Aliases            []database.SiteAlias `json:"aliases" yaml:"aliases"`
+	PoolConfigFile     string               `json:"pool_config_file" yaml:"pool_config_file"`
+	PoolConfigExists   bool                 `json:"pool_config_exists" yaml:"pool_config_exists"`
+	PoolSocket         string               `json:"pool_socket" yaml:"pool_socket"`
+	PoolSocketExists   bool                 `json:"pool_socket_exists" yaml:"pool_socket_exists"`
+	ConfigFile         string               `json:"config_file" yaml:"config_file"`
+	ConfigFileExists   bool                 `json:"config_file_exists" yaml:"config_file_exists"`
+	ConfigFileModified bool                 `json:"config_file_modified" yaml:"config_file_modified"`
+	Symlink            string               `json:"symlink" yaml:"symlink"`
+	SymlinkExists      bool                 `json:"symlink_exists" yaml:"symlink_exists"`
+	SymlinkTarget      string               `json:"symlink_target,omitempty" yaml:"symlink_target,omitempty"`
+	SymlinkMatches     bool                 `json:"symlink_matches" yaml:"symlink_matches"`
+	EnabledMatches     bool                 `json:"enabled_matches" yaml:"enabled_matches"`
+	DocumentRootExists bool                 `json:"document_root_exists" yaml:"document_root_exists"`
+	DocumentRootSize   int64                `json:"document_root_size" yaml:"document_root_size"`
+	WordPressVersion   string               `json:"wordpress_version,omitempty" yaml:"wordpress_version,omitempty"`
+	BasicAuthPaths     []string             `json:"basic_auth_paths" yaml:"basic_auth_paths"`
+}
+
+// poolSocket returns the host path of a site's PHP-FPM socket
+func poolSocket(site *database.Site) string {
+	return fmt.Sprintf("/run/php/php%s-fpm-%s.sock", site.PHPVersion, site.PoolName)
+}
+
+// inspectSite gathers the stored and derived details of a site
+func (sm *SQLiteSiteManager) inspectSite(domain string) (*SiteDetail, error) {
+	siteWithAuth, err := sm.DB.GetSiteWithAuth(domain)
+	if err != nil {
+		return nil, err
+	}
+	site := &siteWithAuth.Site
+
+	detail := &SiteDetail{
+		Site:           *site,
+		ConfigFile:     sm.siteConfigFile(domain),
+		Symlink:        sm.siteSymlink(domain),
+		BasicAuthPaths: []string{},
+	}
+
+	if site.PoolName != "" {
+		detail.PoolConfigFile = sm.poolConfigFile(site)
+		detail.PoolSocket = poolSocket(site)
+		detail.PoolConfigExists = fileExists(detail.PoolConfigFile)
+		detail.PoolSocketExists = fileExists(sm.Config.Path(detail.PoolSocket))
+	}
+	detail.ConfigFileExists = fileExists(detail.ConfigFile)
+	if detail.ConfigFileModified, err = sm.configModified(site); err != nil {
+		return nil, err
+	}
+
+	// The symlink should point at the config file in available-sites
+	if target, err := os.Readlink(detail.Symlink); err == nil {
+		detail.SymlinkExists = true
+		detail.SymlinkTarget = target
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(detail.Symlink), target)
+		} else {
+			target = sm.Config.Path(target)
+		}
+		detail.SymlinkMatches = filepath.Clean(target) == filepath.Clean(detail.ConfigFile)
+	}
+	detail.EnabledMatches = site.IsEnabled == (detail.SymlinkExists && detail.SymlinkMatches)
+
+	siteDir := sm.siteDirectory(site)
+	if info, err := os.Stat(siteDir); err == nil && info.IsDir() && site.DocumentRoot != "" {
+		detail.DocumentRootExists = true
+		detail.DocumentRootSize = directorySize(siteDir)
+	}
+
+	if site.Type == TypeWordPress {
+		if version, err := wordpress.ReadVersion(siteDir); err == nil {
+			detail.WordPressVersion = version
+		}
+	}
+
+	aliases, err := sm.DB.GetAliases(site.ID)
+	if err != nil {
+		return nil, err
+	}
+	detail.Aliases = append([]database.SiteAlias{}, aliases...)
+
+	seen := make(map[string]bool)
+	for _, auth := range siteWithAuth.BasicAuths {
+		if !seen[auth.Path] {
+			seen[auth.Path] = true
+			detail.BasicAuthPaths = append(detail.BasicAuthPaths, auth.Path)
+		}
+	}
+
+	return detail, nil
+}
+
+// fileExists reports whether a file, directory or socket exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// directorySize returns the total size of all regular files below a directory
+func directorySize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.Type().IsRegular() {
+			if info, err := entry.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
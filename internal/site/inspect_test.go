@@ -0,0 +1,101 @@
+package site
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+func TestShowSite(t *testing.T) {
+	sm, _ := newTestManager(t)
+	if _, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com"}); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	site, err := sm.DB.GetSite("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, auth := range []database.BasicAuth{
+		{SiteID: site.ID, Path: "/admin", Username: "alice", Password: "hash"},
+		{SiteID: site.ID, Path: "/admin", Username: "bob", Password: "hash"},
+		{SiteID: site.ID, Path: "/private", Username: "alice", Password: "hash"},
+	} {
+		if err := sm.DB.CreateBasicAuth(&auth); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	detail, err := sm.ShowSite("example.com")
+	if err != nil {
+		t.Fatalf("ShowSite: %v", err)
+	}
+	if !detail.PoolConfigExists || detail.PoolSocketExists || detail.PoolSocket != "/run/php/php8.3-fpm-example_com.sock" {
+		t.Errorf("pool = %s (exists %v), socket = %s (exists %v)", detail.PoolConfigFile, detail.PoolConfigExists, detail.PoolSocket, detail.PoolSocketExists)
+	}
+	if !detail.ConfigFileExists || detail.ConfigFileModified {
+		t.Errorf("config file exists = %v, modified = %v", detail.ConfigFileExists, detail.ConfigFileModified)
+	}
+	if !detail.SymlinkExists || !detail.SymlinkMatches || !detail.EnabledMatches {
+		t.Errorf("symlink exists = %v, matches = %v, enabled matches = %v", detail.SymlinkExists, detail.SymlinkMatches, detail.EnabledMatches)
+	}
+	if !detail.DocumentRootExists || detail.DocumentRootSize == 0 {
+		t.Errorf("document root exists = %v, size = %d", detail.DocumentRootExists, detail.DocumentRootSize)
+	}
+	if want := []string{"/admin", "/private"}; !reflect.DeepEqual(detail.BasicAuthPaths, want) {
+		t.Errorf("BasicAuthPaths = %q, want %q", detail.BasicAuthPaths, want)
+	}
+
+	// Files changed behind the manager's back no longer match the database
+	socket := sm.Config.Path(detail.PoolSocket)
+	if err := os.MkdirAll(filepath.Dir(socket), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(socket, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(detail.ConfigFile, []byte("example.com {\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(detail.Symlink); err != nil {
+		t.Fatal(err)
+	}
+
+	detail, err = sm.ShowSite("example.com")
+	if err != nil {
+		t.Fatalf("ShowSite: %v", err)
+	}
+	if !detail.PoolSocketExists || !detail.ConfigFileModified || detail.SymlinkExists || detail.EnabledMatches {
+		t.Errorf("socket exists = %v, config modified = %v, symlink exists = %v, enabled matches = %v",
+			detail.PoolSocketExists, detail.ConfigFileModified, detail.SymlinkExists, detail.EnabledMatches)
+	}
+}
+
+func TestShowSiteWordPressVersion(t *testing.T) {
+	sm, _ := newTestManager(t)
+	site := &database.Site{Domain: "blog.example.com", DocumentRoot: "/var/www/sites/blog.example.com", Type: TypeWordPress, PoolName: "blog_example_com", PHPVersion: "8.3"}
+	if err := sm.DB.CreateSite(site); err != nil {
+		t.Fatal(err)
+	}
+	includes := filepath.Join(sm.siteDirectory(site), "wp-includes")
+	if err := os.MkdirAll(includes, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(includes, "version.php"), []byte("<?php\n$wp_version = '6.6.2';\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	detail, err := sm.ShowSite("blog.example.com")
+	if err != nil {
+		t.Fatalf("ShowSite: %v", err)
+	}
+	if detail.WordPressVersion != "6.6.2" {
+		t.Errorf("WordPressVersion = %q, want 6.6.2", detail.WordPressVersion)
+	}
+	if detail.ConfigFileExists || detail.PoolConfigExists || !detail.EnabledMatches {
+		t.Errorf("config exists = %v, pool exists = %v, enabled matches = %v for a disabled site without files",
+			detail.ConfigFileExists, detail.PoolConfigExists, detail.EnabledMatches)
+	}
+}
@@ -1,31 +1,92 @@
 package site
 
+import (
+	"errors"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+// ErrDeletionCancelled is returned by DeleteSite when the user declines the
+// confirmation of a hard delete
+var ErrDeletionCancelled = errors.New("deletion cancelled")
+
 // SiteCreateOptions represents options for creating a site
 type SiteCreateOptions struct {
 	Domain     string
-	WordPress  bool
+	Type       string
 	DBName     string
 	DBPassword string
 	MaxUpload  string
 	PHPVersion string
+	Canonical  string
+
+	// HeaderProfile selects the response headers, empty uses the default
+	HeaderProfile string
+
+	// Templates to use instead of the defaults of the site type
+	CaddyTemplate string
+	PoolTemplate  string
+
+	// Reverse proxy settings
+	Upstreams []string
+	LBPolicy  string
+	HealthURI string
+
+	// Static site settings
+	SPAFallback bool
+
+	// PHP-FPM process manager settings, zero values use the defaults
+	PM          string
+	MaxChildren int
+
+	// Isolate runs the site as its own system user
+	Isolate bool
 }
 
 // SiteDeleteOptions represents options for deleting a site
 type SiteDeleteOptions struct {
-	Domain     string
-	Hard       bool
-	Force      bool
+	Domain string
+	Hard   bool
+	Force  bool
+}
+
+// CreateResult describes a newly created site: the stored record including
+// generated database credentials, the files that were written for it and the
+// instructions of its site type. The pool fields are empty for sites without
+// a PHP-FPM pool.
+type CreateResult struct {
+	Site           database.Site
+	ConfigFile     string
+	Symlink        string
+	PoolConfigFile string
+	PoolSocket     string
+	PHPSettings    []PHPSetting
+	NextSteps      []string
 }
 
 // Manager interface defines the operations that both managers must implement
 type Manager interface {
-	CreateSite(opts *SiteCreateOptions) error
+	CreateSite(opts *SiteCreateOptions) (*CreateResult, error)
 	DeleteSite(opts *SiteDeleteOptions) error
 	EnableSite(domain string) error
 	DisableSite(domain string) error
-	ListSites() error
+	ListSites() ([]database.Site, error)
+	ShowSite(domain string) (*SiteDetail, error)
 	AddBasicAuth(domain, path, username, password string) error
 	RemoveBasicAuth(domain, path string) error
-	ListBasicAuth(domain string) error
+	ListBasicAuth(domain string) (*database.SiteWithAuth, error)
 	ModifyMaxUpload(domain, newSize string) error
+	AddAlias(domain, hostname string, redirect bool) error
+	RemoveAlias(domain, hostname string) error
+	ListAliases(domain string) ([]database.SiteAlias, error)
+	SetCanonical(domain, policy string) error
+	ExtraDirectives(domain string) (string, error)
+	SetExtraDirectives(domain, directives string) error
+	SetHeaders(domain string, opts *HeaderOptions) error
+	SetPoolSettings(domain string, settings []string) error
+	PHPSettings(domain string) ([]PHPSetting, error)
+	SetPHPSettings(domain string, settings []string, opts *PHPSettingOptions) error
+	UnsetPHPSettings(domain string, names []string) error
+	SwitchPHPVersion(domain, version string) error
+	PHPVersions() ([]PHPRuntime, error)
 }
@@ -0,0 +1,108 @@
+package site
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os/user"
+	"strings"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+// defaultPoolUser is the user and group PHP-FPM pools of sites without their
+// own system user run as
+const defaultPoolUser = "www-data"
+
+// maxSystemUserLength is the longest user name useradd accepts
+const maxSystemUserLength = 32
+
+// systemUserName returns the system user of an isolated site. Long names are
+// shortened and made unique with a hash of the domain.
+func systemUserName(domain string) string {
+	name := "web_" + strings.ToLower(generatePoolName(domain))
+	if len(name) <= maxSystemUserLength {
+		return name
+	}
+	sum := fmt.Sprintf("%x", sha1.Sum([]byte(domain)))
+	return name[:maxSystemUserLength-9] + "_" + sum[:8]
+}
+
+// checkSystemUser verifies that the system user of a new isolated site is not
+// used by another site or already present on the host
+func (sm *SQLiteSiteManager) checkSystemUser(name string) error {
+	sites, err := sm.DB.ListSites(nil)
+	if err != nil {
+		return err
+	}
+	for _, s := range sites {
+		if s.SystemUser == name {
+			return fmt.Errorf("system user %s already belongs to %s", name, s.Domain)
+		}
+	}
+
+	if sm.Config.Root != "" {
+		return nil
+	}
+	if _, err := user.Lookup(name); err == nil {
+		return fmt.Errorf("system user %s already exists", name)
+	}
+	return nil
+}
+
+// createSystemUser creates the system user and group of an isolated site. The
+// user cannot log in and its home is the site directory.
+func (sm *SQLiteSiteManager) createSystemUser(site *database.Site) error {
+	if sm.Config.DryRun {
+		if sm.Config.Verbose {
+			fmt.Fprintf(sm.Out, "Would create system user: %s\n", site.SystemUser)
+		}
+		return nil
+	}
+
+	if sm.Config.Verbose {
+		fmt.Fprintf(sm.Out, "Creating system user %s...\n", site.SystemUser)
+	}
+
+	if _, err := sm.Runner.Output("useradd", "--system", "--user-group", "--no-create-home",
+		"--home-dir", site.DocumentRoot, "--shell", "/usr/sbin/nologin", site.SystemUser); err != nil {
+		return fmt.Errorf("failed to create system user %s: %v", site.SystemUser, commandError(err))
+	}
+	return nil
+}
+
+// removeSystemUser removes the system user and group of an isolated site
+func (sm *SQLiteSiteManager) removeSystemUser(site *database.Site) error {
+	if sm.Config.DryRun {
+		if sm.Config.Verbose {
+			fmt.Fprintf(sm.Out, "Would remove system user: %s\n", site.SystemUser)
+		}
+		return nil
+	}
+
+	if sm.Config.Verbose {
+		fmt.Fprintf(sm.Out, "Removing system user %s...\n", site.SystemUser)
+	}
+
+	if _, err := sm.Runner.Output("userdel", site.SystemUser); err != nil {
+		return fmt.Errorf("failed to remove system user %s: %v", site.SystemUser, commandError(err))
+	}
+	return nil
+}
+
+// siteOwnership returns the owner and group of a site's files. Files of
+// isolated sites belong to their system user and are readable by Caddy
+// through its group only.
+func (sm *SQLiteSiteManager) siteOwnership(site *database.Site) (string, string) {
+	if site.SystemUser != "" {
+		return site.SystemUser, sm.Config.CaddyGroup
+	}
+	return sm.Config.SiteOwner, sm.Config.SiteGroup
+}
+
+// poolUser returns the user and group the PHP-FPM pool of a site runs as
+func poolUser(site *database.Site) (string, string) {
+	if site.SystemUser != "" {
+		return site.SystemUser, site.SystemUser
+	}
+	return defaultPoolUser, defaultPoolUser
+}
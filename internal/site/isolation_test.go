@@ -0,0 +1,120 @@
+package site
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+func TestSystemUserName(t *testing.T) {
+	if got := systemUserName("Example.com"); got != "web_example_com" {
+		t.Errorf("systemUserName(Example.com) = %s", got)
+	}
+
+	long := systemUserName("a-very-long-subdomain.of-a-long-domain.example.com")
+	other := systemUserName("a-very-long-subdomain.of-a-long-domain.example.org")
+	if len(long) > maxSystemUserLength || len(other) > maxSystemUserLength {
+		t.Errorf("names %s and %s are longer than %d characters", long, other, maxSystemUserLength)
+	}
+	if long == other || !strings.HasPrefix(long, "web_a_very_long") {
+		t.Errorf("long names %s and %s are not distinct shortened names", long, other)
+	}
+}
+
+func TestCreateIsolatedSite(t *testing.T) {
+	sm, runner := newTestManager(t)
+	result, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com", Isolate: true})
+	if err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	if result.Site.SystemUser != "web_example_com" {
+		t.Fatalf("SystemUser = %q", result.Site.SystemUser)
+	}
+
+	siteDir := sm.siteDirectory(&result.Site)
+	want := []string{
+		"useradd --system --user-group --no-create-home --home-dir /var/www/sites/example.com --shell /usr/sbin/nologin web_example_com",
+		"chown -R web_example_com:caddy " + siteDir,
+		"find " + siteDir + " -type d -exec chmod 750 {} +",
+		"find " + siteDir + " -type f -exec chmod 640 {} +",
+	}
+	lines := commandLines(runner)
+	for _, line := range want {
+		if !slices.Contains(lines, line) {
+			t.Errorf("commands do not contain %q:\n%q", line, lines)
+		}
+	}
+
+	pool, err := os.ReadFile(result.PoolConfigFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"user = web_example_com",
+		"group = web_example_com",
+		"php_admin_value[open_basedir] = /var/www/sites/example.com:/tmp:/var/lib/php/sessions",
+	} {
+		if !strings.Contains(string(pool), line) {
+			t.Errorf("pool does not contain %q:\n%s", line, pool)
+		}
+	}
+
+	// open_basedir is what keeps the site in its directory
+	err = sm.SetPHPSettings("example.com", []string{"open_basedir=/"}, &PHPSettingOptions{})
+	if err == nil || !strings.Contains(err.Error(), "managed for isolated sites") {
+		t.Errorf("SetPHPSettings(open_basedir) error = %v", err)
+	}
+
+	runner.Reset()
+	if err := sm.DeleteSite(&SiteDeleteOptions{Domain: "example.com", Hard: true, Force: true}); err != nil {
+		t.Fatalf("DeleteSite: %v", err)
+	}
+	if lines := runner.CommandLines(); !slices.Contains(lines, "userdel web_example_com") {
+		t.Errorf("DeleteSite did not remove the system user: %q", lines)
+	}
+}
+
+func TestCreateSiteOwnership(t *testing.T) {
+	sm, runner := newTestManager(t)
+	sm.Config.SiteOwner, sm.Config.SiteGroup = "deploy", "web"
+	result, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com"})
+	if err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+
+	siteDir := sm.siteDirectory(&result.Site)
+	if lines := commandLines(runner); !slices.Contains(lines, "chown -R deploy:web "+siteDir) || slices.ContainsFunc(lines, func(line string) bool { return strings.HasPrefix(line, "useradd") }) {
+		t.Errorf("commands = %q, want the configured owner and no system user", lines)
+	}
+	pool, err := os.ReadFile(result.PoolConfigFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(pool), "user = www-data") || strings.Contains(string(pool), "open_basedir") {
+		t.Errorf("shared pool:\n%s", pool)
+	}
+}
+
+func TestIsolatedSiteErrors(t *testing.T) {
+	sm, runner := newTestManager(t)
+	if _, err := sm.CreateSite(&SiteCreateOptions{Domain: "static.example.com", Type: TypeStatic, Isolate: true}); err == nil ||
+		!strings.Contains(err.Error(), "no PHP-FPM pool to isolate") {
+		t.Errorf("CreateSite of an isolated static site error = %v", err)
+	}
+
+	// A system user is never shared between sites
+	taken := &database.Site{Domain: "example.org", DocumentRoot: "/var/www/sites/example.org", PoolName: "example_org", SystemUser: "web_example_com"}
+	if err := sm.DB.CreateSite(taken); err != nil {
+		t.Fatal(err)
+	}
+	_, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com", Isolate: true})
+	if err == nil || !strings.Contains(err.Error(), "system user web_example_com already belongs to example.org") {
+		t.Errorf("CreateSite error = %v", err)
+	}
+	if lines := runner.CommandLines(); len(lines) != 0 {
+		t.Errorf("rejected sites ran %q", lines)
+	}
+}
@@ -0,0 +1,89 @@
+package site
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// journal records the completed steps of a multi-step operation together with
+// the action that undoes each of them, so a failure at any point can put the
+// host back into the state it was in before the operation started.
+type journal struct {
+	sm    *SQLiteSiteManager
+	steps []journalStep
+}
+
+// journalStep is a completed step and its undo action
+type journalStep struct {
+	description string
+	undo        func() error
+}
+
+// newJournal creates an empty journal for the site manager
+func (sm *SQLiteSiteManager) newJournal() *journal {
+	return &journal{sm: sm}
+}
+
+// record registers the undo action for a step. Nothing is recorded in
+// dry-run mode since no step changes the host.
+func (j *journal) record(description string, undo func() error) {
+	if j.sm.Config.DryRun {
+		return
+	}
+	j.steps = append(j.steps, journalStep{description: description, undo: undo})
+}
+
+// rollback undoes all recorded steps in reverse order. Every step is attempted
+// even if an earlier undo fails; the failures are returned together.
+func (j *journal) rollback() error {
+	if len(j.steps) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(j.sm.Out, "Rolling back changes...")
+
+	var failures []string
+	for i := len(j.steps) - 1; i >= 0; i-- {
+		step := j.steps[i]
+		if j.sm.Config.Verbose {
+			fmt.Fprintf(j.sm.Out, "Undoing: %s\n", step.description)
+		}
+		if err := step.undo(); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", step.description, err))
+		}
+	}
+	j.steps = nil
+
+	if len(failures) > 0 {
+		return fmt.Errorf("rollback incomplete: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// snapshotFile captures the current content of a file and returns an undo
+// action that restores it, or removes the file if it did not exist.
+func snapshotFile(path string) (func() error, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return func() error {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return nil
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	mode := info.Mode().Perm()
+
+	return func() error {
+		return os.WriteFile(path, content, mode)
+	}, nil
+}
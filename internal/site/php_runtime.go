@@ -0,0 +1,183 @@
+package site
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// phpVersionPattern matches PHP versions such as 8.3
+var phpVersionPattern = regexp.MustCompile(`^[0-9]+\.[0-9]+$`)
+
+// phpReportedVersionPattern extracts the version from the output of php-fpm -v
+var phpReportedVersionPattern = regexp.MustCompile(`^PHP ([0-9]+\.[0-9]+\.[0-9]+\S*)`)
+
+// phpEndOfLife is the end of security support of each PHP release
+var phpEndOfLife = map[string]string{
+	"5.6": "2018-12-31",
+	"7.0": "2019-01-10",
+	"7.1": "2019-12-01",
+	"7.2": "2020-11-30",
+	"7.3": "2021-12-06",
+	"7.4": "2022-11-28",
+	"8.0": "2023-11-26",
+	"8.1": "2025-12-31",
+	"8.2": "2026-12-31",
+	"8.3": "2027-12-31",
+	"8.4": "2028-12-31",
+}
+
+// PHPRuntime is a PHP version that is installed or used by sites
+type PHPRuntime struct {
+	Version string `json:"version" yaml:"version"`
+	// Installed reports whether PHP-FPM of the version is installed
+	Installed bool `json:"installed" yaml:"installed"`
+	// Reported is the full version the PHP-FPM binary reports, if it runs
+	Reported  string `json:"reported,omitempty" yaml:"reported,omitempty"`
+	Sites     int    `json:"sites" yaml:"sites"`
+	EndOfLife string `json:"end_of_life,omitempty" yaml:"end_of_life,omitempty"`
+	// Unsupported reports whether the version is past its end of life
+	Unsupported bool `json:"unsupported" yaml:"unsupported"`
+}
+
+// phpEndOfLifeDate returns the end of security support of a PHP version and
+// whether the version has reached it
+func phpEndOfLifeDate(version string) (string, bool) {
+	date, ok := phpEndOfLife[version]
+	if !ok {
+		return "", false
+	}
+	eol, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date, false
+	}
+	return date, time.Now().After(eol)
+}
+
+// installedPHPVersions returns the PHP versions with a PHP-FPM configuration
+// directory in /etc/php
+func (sm *SQLiteSiteManager) installedPHPVersions() ([]string, error) {
+	dirs, err := filepath.Glob(filepath.Join(sm.Config.Path(phpConfigDir), "*", "fpm"))
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, dir := range dirs {
+		version := filepath.Base(filepath.Dir(dir))
+		if info, err := os.Stat(dir); err == nil && info.IsDir() && phpVersionPattern.MatchString(version) {
+			versions = append(versions, version)
+		}
+	}
+	return versions, nil
+}
+
+// reportedPHPVersion asks the PHP-FPM binary of a version for its full
+// version, which is empty if the binary cannot be run
+func (sm *SQLiteSiteManager) reportedPHPVersion(version string) string {
+	out, err := sm.Runner.Output("php-fpm"+version, "-v")
+	if err != nil {
+		return ""
+	}
+	if match := phpReportedVersionPattern.FindStringSubmatch(string(out)); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// PHPVersions lists the installed PHP versions and the versions sites use,
+// with the number of sites on each
+func (sm *SQLiteSiteManager) PHPVersions() ([]PHPRuntime, error) {
+	installed, err := sm.installedPHPVersions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover PHP versions: %v", err)
+	}
+
+	sites, err := sm.DB.ListSites(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	runtimes := make(map[string]*PHPRuntime)
+	runtime := func(version string) *PHPRuntime {
+		if runtimes[version] == nil {
+			runtimes[version] = &PHPRuntime{Version: version}
+			runtimes[version].EndOfLife, runtimes[version].Unsupported = phpEndOfLifeDate(version)
+		}
+		return runtimes[version]
+	}
+	for _, version := range installed {
+		r := runtime(version)
+		r.Installed = true
+		r.Reported = sm.reportedPHPVersion(version)
+	}
+	for _, s := range sites {
+		if s.PoolName != "" && s.PHPVersion != "" {
+			runtime(s.PHPVersion).Sites++
+		}
+	}
+
+	var result []PHPRuntime
+	for _, r := range runtimes {
+		result = append(result, *r)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return comparePHPVersions(result[i].Version, result[j].Version) < 0
+	})
+	return result, nil
+}
+
+// comparePHPVersions orders PHP versions numerically, so 8.10 follows 8.9
+func comparePHPVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, _ := strconv.Atoi(as[i])
+		y, _ := strconv.Atoi(bs[i])
+		if x != y {
+			return x - y
+		}
+	}
+	return len(as) - len(bs)
+}
+
+// checkPHPFPMInstalled verifies that PHP-FPM of a version is installed, so a
+// site is not set up for a pool that PHP-FPM never loads
+func (sm *SQLiteSiteManager) checkPHPFPMInstalled(version string) error {
+	if !phpVersionPattern.MatchString(version) {
+		return fmt.Errorf("invalid PHP version %q (use e.g. 8.3)", version)
+	}
+
+	if sm.Config.Root != "" {
+		if sm.Config.Verbose {
+			fmt.Fprintf(sm.Out, "Sandbox: skipping check for PHP-FPM %s\n", version)
+		}
+		return nil
+	}
+
+	installed, err := sm.installedPHPVersions()
+	if err != nil {
+		return fmt.Errorf("failed to discover PHP versions: %v", err)
+	}
+	for _, v := range installed {
+		if v == version {
+			return nil
+		}
+	}
+	if len(installed) == 0 {
+		return fmt.Errorf("PHP-FPM %s is not installed (no PHP-FPM found in %s)", version, phpConfigDir)
+	}
+	return fmt.Errorf("PHP-FPM %s is not installed (installed: %s)", version, strings.Join(installed, ", "))
+}
+
+// warnPHPEndOfLife warns when a site is set up on a PHP version that no
+// longer receives security fixes
+func (sm *SQLiteSiteManager) warnPHPEndOfLife(version string) {
+	if date, unsupported := phpEndOfLifeDate(version); unsupported {
+		fmt.Fprintf(sm.Out, "Warning: PHP %s reached end of life on %s and no longer receives security fixes.\n", version, date)
+	}
+}
@@ -0,0 +1,151 @@
+package site
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+// stagePHPVersions creates the PHP-FPM configuration directories of versions
+// below the root of a test manager
+func stagePHPVersions(t *testing.T, sm *SQLiteSiteManager, versions ...string) {
+	t.Helper()
+	for _, version := range versions {
+		if err := os.MkdirAll(sm.Config.Path(filepath.Join(phpConfigDir, version, "fpm")), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestComparePHPVersions(t *testing.T) {
+	sorted := []string{"8.10", "7.4", "8.2", "8.9"}
+	sort.Slice(sorted, func(i, j int) bool { return comparePHPVersions(sorted[i], sorted[j]) < 0 })
+	if want := []string{"7.4", "8.2", "8.9", "8.10"}; !reflect.DeepEqual(sorted, want) {
+		t.Errorf("sorted = %q, want %q", sorted, want)
+	}
+}
+
+func TestPHPEndOfLifeDate(t *testing.T) {
+	if date, unsupported := phpEndOfLifeDate("7.4"); date != "2022-11-28" || !unsupported {
+		t.Errorf("phpEndOfLifeDate(7.4) = %s, %v", date, unsupported)
+	}
+	if date, unsupported := phpEndOfLifeDate("8.4"); date != "2028-12-31" || unsupported {
+		t.Errorf("phpEndOfLifeDate(8.4) = %s, %v", date, unsupported)
+	}
+	if date, unsupported := phpEndOfLifeDate("9.0"); date != "" || unsupported {
+		t.Errorf("phpEndOfLifeDate of an unknown version = %s, %v", date, unsupported)
+	}
+}
+
+func TestPHPVersions(t *testing.T) {
+	sm, runner := newTestManager(t)
+	stagePHPVersions(t, sm, "8.3", "8.4", "7.4")
+	if err := os.MkdirAll(sm.Config.Path(filepath.Join(phpConfigDir, "mods-available")), 0755); err != nil {
+		t.Fatal(err)
+	}
+	runner.Outputs["php-fpm8.3 -v"] = []byte("PHP 8.3.11 (fpm-fcgi) (built: Sep  2 2024 11:21:47)\nCopyright (c) The PHP Group\n")
+	runner.Errors["php-fpm7.4 -v"] = os.ErrNotExist
+
+	for _, site := range []*database.Site{
+		{Domain: "a.example.com", PHPVersion: "8.3", PoolName: "a_example_com"},
+		{Domain: "b.example.com", PHPVersion: "8.3", PoolName: "b_example_com"},
+		{Domain: "old.example.com", PHPVersion: "8.1", PoolName: "old_example_com"},
+		{Domain: "static.example.com", Type: TypeStatic},
+	} {
+		if err := sm.DB.CreateSite(site); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runtimes, err := sm.PHPVersions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range runtimes {
+		got = append(got, strings.Join([]string{r.Version, boolString(r.Installed), r.Reported, strings.Repeat("*", r.Sites)}, " "))
+	}
+	want := []string{"7.4 true  ", "8.1 false  *", "8.3 true 8.3.11 **", "8.4 true  "}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PHPVersions() = %q, want %q", got, want)
+	}
+	if !runtimes[0].Unsupported || runtimes[3].Unsupported {
+		t.Errorf("unsupported = %v/%v, want 7.4 past and 8.4 within its end of life", runtimes[0].Unsupported, runtimes[3].Unsupported)
+	}
+}
+
+// boolString formats a bool for table comparisons
+func boolString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+func TestCreateSiteChecksPHPVersion(t *testing.T) {
+	sm, runner := newTestManager(t)
+	sm.Config.Verbose = true
+	out := &bytes.Buffer{}
+	sm.Out = out
+
+	for _, version := range []string{"8.x", "8", "../8.3"} {
+		_, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com", PHPVersion: version})
+		if err == nil || !strings.Contains(err.Error(), "invalid PHP version") {
+			t.Errorf("CreateSite with PHP %q error = %v", version, err)
+		}
+	}
+	if lines := runner.CommandLines(); len(lines) != 0 {
+		t.Errorf("CreateSite with an invalid PHP version ran %q", lines)
+	}
+
+	// A staged root has no PHP-FPM installed, so only the format is checked
+	if _, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com", PHPVersion: "8.4"}); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	if want := "Sandbox: skipping check for PHP-FPM 8.4"; !strings.Contains(out.String(), want) {
+		t.Errorf("output does not contain %q:\n%s", want, out.String())
+	}
+
+	// Static sites have no pool and need no PHP
+	if _, err := sm.CreateSite(&SiteCreateOptions{Domain: "static.example.com", Type: TypeStatic, PHPVersion: "8.x"}); err != nil {
+		t.Errorf("CreateSite of a static site: %v", err)
+	}
+}
+
+func TestInstalledPHPVersions(t *testing.T) {
+	sm, _ := newTestManager(t)
+	stagePHPVersions(t, sm, "8.3", "7.4", "latest")
+	for _, dir := range []string{"mods-available", "8.2/cli"} {
+		if err := os.MkdirAll(sm.Config.Path(filepath.Join(phpConfigDir, dir)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	versions, err := sm.installedPHPVersions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"7.4", "8.3"}; !reflect.DeepEqual(versions, want) {
+		t.Errorf("installedPHPVersions() = %q, want %q", versions, want)
+	}
+}
+
+func TestCreateSiteWarnsAboutEndOfLife(t *testing.T) {
+	sm, _ := newTestManager(t)
+	stagePHPVersions(t, sm, "7.4")
+	out := &bytes.Buffer{}
+	sm.Out = out
+
+	if _, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com", PHPVersion: "7.4"}); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	if want := "Warning: PHP 7.4 reached end of life on 2022-11-28"; !strings.Contains(out.String(), want) {
+		t.Errorf("output does not contain %q:\n%s", want, out.String())
+	}
+}
@@ -0,0 +1,396 @@
+package site
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+// PHP-FPM pool directives for php.ini settings. Admin settings cannot be
+// changed by scripts with ini_set, the others can.
+const (
+	PHPAdminValue = "php_admin_value"
+	PHPAdminFlag  = "php_admin_flag"
+	PHPValue      = "php_value"
+	PHPFlag       = "php_flag"
+)
+
+// Sources of effective PHP settings
+const (
+	PHPSettingDefault = "default"
+	PHPSettingSite    = "site"
+	PHPSettingManaged = "managed"
+)
+
+// Types of php.ini values
+const (
+	phpTypeFlag   = "flag"
+	phpTypeSize   = "size"
+	phpTypeInt    = "int"
+	phpTypeString = "string"
+)
+
+// phpDirective describes a known php.ini directive. System directives can
+// only be set for the whole pool, not changed by scripts.
+type phpDirective struct {
+	valueType string
+	system    bool
+}
+
+// phpDirectives are the php.ini directives that are validated by php set
+var phpDirectives = map[string]phpDirective{
+	"allow_url_fopen":                 {phpTypeFlag, true},
+	"allow_url_include":               {phpTypeFlag, true},
+	"auto_prepend_file":               {phpTypeString, false},
+	"date.timezone":                   {phpTypeString, false},
+	"default_socket_timeout":          {phpTypeInt, false},
+	"disable_functions":               {phpTypeString, true},
+	"display_errors":                  {phpTypeFlag, false},
+	"error_reporting":                 {phpTypeString, false},
+	"expose_php":                      {phpTypeFlag, true},
+	"log_errors":                      {phpTypeFlag, false},
+	"max_execution_time":              {phpTypeInt, false},
+	"max_file_uploads":                {phpTypeInt, true},
+	"max_input_nesting_level":         {phpTypeInt, false},
+	"max_input_time":                  {phpTypeInt, false},
+	"max_input_vars":                  {phpTypeInt, false},
+	"memory_limit":                    {phpTypeSize, false},
+	"open_basedir":                    {phpTypeString, false},
+	"opcache.enable":                  {phpTypeFlag, false},
+	"opcache.interned_strings_buffer": {phpTypeInt, true},
+	"opcache.jit":                     {phpTypeString, false},
+	"opcache.jit_buffer_size":         {phpTypeSize, true},
+	"opcache.max_accelerated_files":   {phpTypeInt, true},
+	"opcache.memory_consumption":      {phpTypeInt, true},
+	"opcache.revalidate_freq":         {phpTypeInt, false},
+	"opcache.validate_timestamps":     {phpTypeFlag, false},
+	"output_buffering":                {phpTypeString, false},
+	"realpath_cache_size":             {phpTypeSize, true},
+	"realpath_cache_ttl":              {phpTypeInt, true},
+	"sendmail_path":                   {phpTypeString, true},
+	"session.cookie_httponly":         {phpTypeFlag, false},
+	"session.cookie_samesite":         {phpTypeString, false},
+	"session.cookie_secure":           {phpTypeFlag, false},
+	"session.gc_maxlifetime":          {phpTypeInt, false},
+	"session.save_path":               {phpTypeString, false},
+	"short_open_tag":                  {phpTypeFlag, false},
+	"zend.assertions":                 {phpTypeInt, false},
+}
+
+// managedPHPSettings are set from other site settings and cannot be changed
+// with php set
+var managedPHPSettings = map[string]string{
+	"upload_max_filesize": "use max-upload",
+	"post_max_size":       "use max-upload",
+	"error_log":           "the pool log file is managed",
+}
+
+var (
+	phpSizePattern = regexp.MustCompile(`^(-1|[0-9]+[KMGkmg]?)$`)
+	phpIntPattern  = regexp.MustCompile(`^-?[0-9]+$`)
+	phpNamePattern = regexp.MustCompile(`^[a-z0-9_]+(\.[a-z0-9_]+)*$`)
+	phpFlagValues  = map[string]string{
+		"on": "on", "off": "off", "1": "on", "0": "off",
+		"true": "on", "false": "off", "yes": "on", "no": "off",
+	}
+)
+
+// PHPSetting is an effective php.ini setting of a site's PHP-FPM pool
+type PHPSetting struct {
+	Name      string `json:"name" yaml:"name"`
+	Value     string `json:"value" yaml:"value"`
+	Directive string `json:"directive" yaml:"directive"`
+	Source    string `json:"source" yaml:"source"`
+}
+
+// String returns the setting as a line of a PHP-FPM pool configuration
+func (s PHPSetting) String() string {
+	return fmt.Sprintf("%s[%s] = %s", s.Directive, s.Name, s.Value)
+}
+
+// defaultPHPSettings returns the php.ini settings of a pool without overrides
+func defaultPHPSettings(site *database.Site) []PHPSetting {
+	value := func(name, value string) PHPSetting {
+		return PHPSetting{Name: name, Value: value, Directive: PHPAdminValue, Source: PHPSettingDefault}
+	}
+	flag := func(name, value string) PHPSetting {
+		return PHPSetting{Name: name, Value: value, Directive: PHPAdminFlag, Source: PHPSettingDefault}
+	}
+	managed := func(name, value string) PHPSetting {
+		return PHPSetting{Name: name, Value: value, Directive: PHPAdminValue, Source: PHPSettingManaged}
+	}
+
+	settings := []PHPSetting{
+		managed("upload_max_filesize", site.MaxUpload),
+		managed("post_max_size", site.MaxUpload),
+		value("max_execution_time", "300"),
+		value("max_input_time", "300"),
+		value("memory_limit", "512M"),
+		value("max_file_uploads", "50"),
+		value("max_input_vars", "5000"),
+		value("max_input_nesting_level", "64"),
+		flag("allow_url_fopen", "on"),
+		flag("allow_url_include", "off"),
+		flag("expose_php", "off"),
+		flag("display_errors", "off"),
+		flag("log_errors", "on"),
+		managed("error_log", fmt.Sprintf("%s/%s-error.log", phpLogDir, site.PoolName)),
+		value("session.save_path", "/var/lib/php/sessions"),
+		flag("session.cookie_httponly", "on"),
+		flag("opcache.enable", "on"),
+		value("opcache.memory_consumption", "128"),
+		value("opcache.interned_strings_buffer", "8"),
+		value("opcache.max_accelerated_files", "4000"),
+		flag("opcache.validate_timestamps", "on"),
+		value("opcache.revalidate_freq", "60"),
+	}
+
+	// Keep the scripts of isolated sites out of other sites' files
+	if site.SystemUser != "" {
+		settings = append(settings, managed("open_basedir", isolatedOpenBasedir(site)))
+	}
+	return settings
+}
+
+// isolatedOpenBasedir returns the directories scripts of an isolated site may
+// access: its own directory, temporary files and sessions
+func isolatedOpenBasedir(site *database.Site) string {
+	return strings.Join([]string{site.DocumentRoot, "/tmp", "/var/lib/php/sessions"}, ":")
+}
+
+// effectivePHPSettings returns the php.ini settings of a pool: the defaults
+// with the settings stored for the site applied
+func effectivePHPSettings(site *database.Site, overrides []database.PHPSetting) []PHPSetting {
+	settings := defaultPHPSettings(site)
+	for _, override := range overrides {
+		setting := PHPSetting{Name: override.Name, Value: override.Value, Directive: override.Directive, Source: PHPSettingSite}
+		replaced := false
+		for i := range settings {
+			if settings[i].Name == override.Name {
+				settings[i] = setting
+				replaced = true
+			}
+		}
+		if !replaced {
+			settings = append(settings, setting)
+		}
+	}
+	return settings
+}
+
+// parsePHPSetting parses a setting in the form name=value and returns it
+// with the directive it is written with. Unknown directives are rejected
+// unless force is set.
+func parsePHPSetting(s string, user, force bool) (*database.PHPSetting, error) {
+	name, value, found := strings.Cut(s, "=")
+	name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+	if !found || !phpNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid PHP setting %q (use name=value, e.g. memory_limit=1G)", s)
+	}
+	if reason, ok := managedPHPSettings[name]; ok {
+		return nil, fmt.Errorf("%s cannot be set: %s", name, reason)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return nil, fmt.Errorf("invalid value for %s: must be a single line", name)
+	}
+
+	directive, known := phpDirectives[name]
+	if !known {
+		if !force {
+			return nil, fmt.Errorf("unknown PHP directive %s (use --force to set it anyway)", name)
+		}
+		directive = phpDirective{valueType: phpTypeString}
+	}
+
+	switch directive.valueType {
+	case phpTypeFlag:
+		flag, ok := phpFlagValues[strings.ToLower(value)]
+		if !ok {
+			return nil, fmt.Errorf("invalid value for %s: %q (use on or off)", name, value)
+		}
+		value = flag
+	case phpTypeSize:
+		if !phpSizePattern.MatchString(value) {
+			return nil, fmt.Errorf("invalid value for %s: %q (use e.g. 512M, 1G or -1)", name, value)
+		}
+	case phpTypeInt:
+		if !phpIntPattern.MatchString(value) {
+			return nil, fmt.Errorf("invalid value for %s: %q (must be a number)", name, value)
+		}
+	}
+
+	if user && directive.system {
+		return nil, fmt.Errorf("%s cannot be changed by scripts, set it without --user", name)
+	}
+
+	setting := &database.PHPSetting{Name: name, Value: value}
+	switch {
+	case directive.valueType == phpTypeFlag && user:
+		setting.Directive = PHPFlag
+	case directive.valueType == phpTypeFlag:
+		setting.Directive = PHPAdminFlag
+	case user:
+		setting.Directive = PHPValue
+	default:
+		setting.Directive = PHPAdminValue
+	}
+	return setting, nil
+}
+
+// PHPSettingOptions control how php set writes settings
+type PHPSettingOptions struct {
+	// User lets scripts change the settings with ini_set
+	User bool
+	// Force accepts directives that are not known
+	Force bool
+}
+
+// PHPSettings returns the effective php.ini settings of a site's pool
+func (sm *SQLiteSiteManager) PHPSettings(domain string) ([]PHPSetting, error) {
+	site, err := sm.DB.GetSite(domain)
+	if err != nil {
+		return nil, err
+	}
+	if site.PoolName == "" {
+		return nil, fmt.Errorf("%s sites have no PHP-FPM pool", DisplayName(site.Type))
+	}
+
+	overrides, err := sm.DB.GetPHPSettings(site.ID)
+	if err != nil {
+		return nil, err
+	}
+	return effectivePHPSettings(site, overrides), nil
+}
+
+// SetPHPSettings stores php.ini settings of a site, given as name=value
+// pairs, re-renders its PHP-FPM pool and reloads PHP-FPM
+func (sm *SQLiteSiteManager) SetPHPSettings(domain string, settings []string, opts *PHPSettingOptions) error {
+	if sm.Config.Verbose {
+		fmt.Fprintf(sm.Out, "Setting PHP settings of %s\n", domain)
+	}
+
+	site, err := sm.DB.GetSite(domain)
+	if err != nil {
+		return err
+	}
+	if site.PoolName == "" {
+		return fmt.Errorf("%s sites have no PHP-FPM pool", DisplayName(site.Type))
+	}
+
+	var parsed []*database.PHPSetting
+	for _, s := range settings {
+		setting, err := parsePHPSetting(s, opts.User, opts.Force)
+		if err != nil {
+			return err
+		}
+		if setting.Name == "open_basedir" && site.SystemUser != "" {
+			return fmt.Errorf("open_basedir cannot be set: it is managed for isolated sites")
+		}
+		setting.SiteID = site.ID
+		parsed = append(parsed, setting)
+	}
+
+	if sm.Config.DryRun {
+		if sm.Config.Verbose {
+			for _, setting := range parsed {
+				fmt.Fprintf(sm.Out, "Would set %s[%s] = %s\n", setting.Directive, setting.Name, setting.Value)
+			}
+		}
+		return nil
+	}
+
+	previous, err := sm.DB.GetPHPSettings(site.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, setting := range parsed {
+		if err := sm.DB.SetPHPSetting(setting); err != nil {
+			return err
+		}
+	}
+
+	return sm.updatePool(site, func() error {
+		return sm.restorePHPSettings(site, previous)
+	})
+}
+
+// UnsetPHPSettings removes php.ini settings of a site, so the defaults apply
+// again, re-renders its PHP-FPM pool and reloads PHP-FPM
+func (sm *SQLiteSiteManager) UnsetPHPSettings(domain string, names []string) error {
+	if sm.Config.Verbose {
+		fmt.Fprintf(sm.Out, "Removing PHP settings of %s\n", domain)
+	}
+
+	site, err := sm.DB.GetSite(domain)
+	if err != nil {
+		return err
+	}
+	if site.PoolName == "" {
+		return fmt.Errorf("%s sites have no PHP-FPM pool", DisplayName(site.Type))
+	}
+
+	previous, err := sm.DB.GetPHPSettings(site.ID)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		found := false
+		for _, setting := range previous {
+			found = found || setting.Name == name
+		}
+		if !found {
+			return fmt.Errorf("PHP setting %s is not set for %s", name, domain)
+		}
+	}
+
+	if sm.Config.DryRun {
+		if sm.Config.Verbose {
+			fmt.Fprintf(sm.Out, "Would remove PHP settings: %s\n", strings.Join(names, ", "))
+		}
+		return nil
+	}
+
+	for _, name := range names {
+		if err := sm.DB.DeletePHPSetting(site.ID, name); err != nil {
+			return err
+		}
+	}
+
+	return sm.updatePool(site, func() error {
+		return sm.restorePHPSettings(site, previous)
+	})
+}
+
+// restorePHPSettings replaces the PHP settings of a site with earlier ones
+func (sm *SQLiteSiteManager) restorePHPSettings(site *database.Site, settings []database.PHPSetting) error {
+	current, err := sm.DB.GetPHPSettings(site.ID)
+	if err != nil {
+		return err
+	}
+	for _, setting := range current {
+		if err := sm.DB.DeletePHPSetting(site.ID, setting.Name); err != nil {
+			return err
+		}
+	}
+	for i := range settings {
+		if err := sm.DB.SetPHPSetting(&settings[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PHPSettingNames returns the known php.ini directives accepted by php set in
+// order
+func PHPSettingNames() []string {
+	var names []string
+	for name := range phpDirectives {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,110 @@
+package site
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSetPHPSettingsRollsBackRejectedDirective(t *testing.T) {
+	sm, runner := newTestManager(t)
+	if _, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com"}); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	if err := sm.SetPHPSettings("example.com", []string{"memory_limit=1G"}, &PHPSettingOptions{}); err != nil {
+		t.Fatalf("SetPHPSettings: %v", err)
+	}
+	site, err := sm.DB.GetSite("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := os.ReadFile(sm.poolConfigFile(site))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner.Reset()
+	runner.Errors["php-fpm8.3 -t"] = errors.New("exit status 78")
+	err = sm.SetPHPSettings("example.com", []string{"made.up_directive=1"}, &PHPSettingOptions{Force: true})
+	if err == nil || !strings.Contains(err.Error(), "configuration test failed") {
+		t.Fatalf("SetPHPSettings error = %v", err)
+	}
+	for _, line := range runner.CommandLines() {
+		if strings.HasPrefix(line, "systemctl") {
+			t.Errorf("PHP-FPM was touched after the failed test: %s", line)
+		}
+	}
+
+	if restored, _ := os.ReadFile(sm.poolConfigFile(site)); string(restored) != string(pool) {
+		t.Errorf("pool was not restored:\n%s", restored)
+	}
+	settings, err := sm.DB.GetPHPSettings(site.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(settings) != 1 || settings[0].Name != "memory_limit" {
+		t.Errorf("stored settings = %+v, want only memory_limit", settings)
+	}
+}
+
+func TestModifyMaxUploadRendersPool(t *testing.T) {
+	sm, runner := newTestManager(t)
+	if _, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com"}); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+
+	runner.Reset()
+	if err := sm.ModifyMaxUpload("example.com", "1G"); err != nil {
+		t.Fatalf("ModifyMaxUpload: %v", err)
+	}
+	site, err := sm.DB.GetSite("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := os.ReadFile(sm.poolConfigFile(site))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"php_admin_value[upload_max_filesize] = 1G", "php_admin_value[post_max_size] = 1G"} {
+		if !strings.Contains(string(pool), line) {
+			t.Errorf("pool does not contain %q:\n%s", line, pool)
+		}
+	}
+	want := []string{
+		"chown www-data:www-data " + sm.poolLogDir(),
+		"php-fpm8.3 -t",
+		"systemctl reload php8.3-fpm",
+		"caddy validate --config <staged Caddyfile> --adapter caddyfile",
+		"systemctl reload caddy",
+	}
+	if got := commandLines(runner); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+}
+
+func TestModifyMaxUploadRestoresPoolWhenCaddyFails(t *testing.T) {
+	sm, runner := newTestManager(t)
+	if _, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com"}); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	site, err := sm.DB.GetSite("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := os.ReadFile(sm.poolConfigFile(site))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner.Errors["systemctl reload caddy"] = errors.New("exit status 1")
+	if err := sm.ModifyMaxUpload("example.com", "1G"); err == nil {
+		t.Fatal("ModifyMaxUpload succeeded although Caddy failed to reload")
+	}
+	if restored, _ := os.ReadFile(sm.poolConfigFile(site)); string(restored) != string(pool) {
+		t.Errorf("pool was not restored:\n%s", restored)
+	}
+	if reverted, _ := sm.DB.GetSite("example.com"); reverted.MaxUpload != site.MaxUpload {
+		t.Errorf("max upload = %s, want %s", reverted.MaxUpload, site.MaxUpload)
+	}
+}
@@ -0,0 +1,140 @@
+package site
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+// SwitchPHPVersion moves the PHP-FPM pool of a site to another PHP version and
+// points its Caddy config at the new socket. The old pool keeps serving until
+// Caddy uses the new one; if the new pool fails the configuration test or to
+// load, or Caddy rejects the config, every step is undone.
+func (sm *SQLiteSiteManager) SwitchPHPVersion(domain, version string) error {
+	if sm.Config.Verbose {
+		fmt.Fprintf(sm.Out, "Switching %s to PHP %s\n", domain, version)
+	}
+
+	site, err := sm.DB.GetSite(domain)
+	if err != nil {
+		return err
+	}
+	if site.PoolName == "" {
+		return fmt.Errorf("%s sites have no PHP-FPM pool", DisplayName(site.Type))
+	}
+	if site.PHPVersion == version {
+		return fmt.Errorf("%s already uses PHP %s", domain, version)
+	}
+
+	if err := sm.checkPHPFPMInstalled(version); err != nil {
+		return err
+	}
+	sm.warnPHPEndOfLife(version)
+
+	poolTemplate, err := poolTemplateName(site)
+	if err != nil {
+		return err
+	}
+
+	previous := *site
+	oldPool := sm.poolConfigFile(&previous)
+	site.PHPVersion = version
+
+	if sm.Config.DryRun {
+		if sm.Config.Verbose {
+			fmt.Fprintf(sm.Out, "Would write PHP-FPM pool: %s\n", sm.poolConfigFile(site))
+			fmt.Fprintf(sm.Out, "Would test and reload PHP-FPM %s\n", version)
+			fmt.Fprintf(sm.Out, "Would regenerate Caddy config with socket %s\n", poolSocket(site))
+			fmt.Fprintf(sm.Out, "Would remove PHP-FPM pool: %s\n", oldPool)
+			fmt.Fprintf(sm.Out, "Would test and reload PHP-FPM %s\n", previous.PHPVersion)
+		}
+		return nil
+	}
+
+	j := sm.newJournal()
+	if err := sm.switchPHPVersion(site, &previous, poolTemplate, j); err != nil {
+		if rbErr := j.rollback(); rbErr != nil {
+			return fmt.Errorf("%v (%v)", err, rbErr)
+		}
+		return err
+	}
+
+	// The site runs on the new pool now, so the old one is only cleaned up
+	// and a failure leaves nothing to roll back
+	if err := sm.removeOldPool(oldPool, previous.PHPVersion); err != nil {
+		fmt.Fprintf(sm.Out, "Warning: switched to PHP %s, but %v\n", version, err)
+	}
+
+	return nil
+}
+
+// switchPHPVersion performs the steps of a PHP version switch that are undone
+// if a later one fails
+func (sm *SQLiteSiteManager) switchPHPVersion(site, previous *database.Site, poolTemplate string, j *journal) error {
+	if err := sm.DB.UpdateSite(site); err != nil {
+		return fmt.Errorf("failed to update site in database: %v", err)
+	}
+	j.record("site record of "+site.Domain, func() error {
+		if err := sm.DB.UpdateSite(previous); err != nil {
+			return err
+		}
+		return sm.DB.SetConfigHash(previous.Domain, previous.ConfigHash)
+	})
+
+	// Start the new pool next to the old one
+	newPool := sm.poolConfigFile(site)
+	restorePool, err := snapshotFile(newPool)
+	if err != nil {
+		return fmt.Errorf("failed to inspect PHP-FPM pool: %v", err)
+	}
+	version := site.PHPVersion
+	j.record("PHP-FPM pool "+newPool, func() error {
+		if err := restorePool(); err != nil {
+			return err
+		}
+		if err := sm.testPHPFPMConfig(version); err != nil {
+			return err
+		}
+		return sm.reloadPHPFPM(version)
+	})
+	if err := sm.createPHPFPMPool(site, poolTemplate); err != nil {
+		return fmt.Errorf("failed to create PHP-FPM pool: %v", err)
+	}
+	if err := sm.testPHPFPMConfig(version); err != nil {
+		return err
+	}
+	if err := sm.reloadPHPFPM(version); err != nil {
+		return fmt.Errorf("new pool failed to load: %v", err)
+	}
+
+	// Point Caddy at the new socket
+	configFile := sm.siteConfigFile(site.Domain)
+	restoreConfig, err := snapshotConfigFile(configFile)
+	if err != nil {
+		return fmt.Errorf("failed to inspect Caddy config: %v", err)
+	}
+	j.record("Caddy config "+configFile, func() error {
+		if err := restoreConfig(); err != nil {
+			return err
+		}
+		return sm.reloadCaddy()
+	})
+	if err := sm.regenerateCaddyConfig(site.ID, configFile); err != nil {
+		return fmt.Errorf("failed to regenerate Caddy config: %v", err)
+	}
+	return nil
+}
+
+// removeOldPool removes the pool a site used before a PHP version switch and
+// reloads PHP-FPM of that version. The configuration is tested first, since
+// PHP-FPM refuses to run without any pool.
+func (sm *SQLiteSiteManager) removeOldPool(pool, version string) error {
+	if err := os.Remove(pool); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove old PHP-FPM pool: %v", err)
+	}
+	if err := sm.testPHPFPMConfig(version); err != nil {
+		return fmt.Errorf("PHP-FPM %s was not reloaded: %v", version, err)
+	}
+	return sm.reloadPHPFPM(version)
+}
@@ -0,0 +1,182 @@
+package site
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newPHPSite creates a PHP site on PHP 8.3 and returns the paths of its pool
+// for 8.3 and 8.4
+func newPHPSite(t *testing.T, sm *SQLiteSiteManager) (oldPool, newPool string) {
+	t.Helper()
+	if _, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com"}); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	site, err := sm.DB.GetSite("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPool = sm.poolConfigFile(site)
+	site.PHPVersion = "8.4"
+	return oldPool, sm.poolConfigFile(site)
+}
+
+func TestSwitchPHPVersion(t *testing.T) {
+	sm, runner := newTestManager(t)
+	oldPool, newPool := newPHPSite(t, sm)
+
+	runner.Reset()
+	if err := sm.SwitchPHPVersion("example.com", "8.4"); err != nil {
+		t.Fatalf("SwitchPHPVersion: %v", err)
+	}
+
+	want := []string{
+		"chown www-data:www-data " + sm.poolLogDir(),
+		"php-fpm8.4 -t",
+		"systemctl reload php8.4-fpm",
+		"caddy validate --config <staged Caddyfile> --adapter caddyfile",
+		"systemctl reload caddy",
+		"php-fpm8.3 -t",
+		"systemctl reload php8.3-fpm",
+	}
+	if got := commandLines(runner); !reflect.DeepEqual(got, want) {
+		t.Errorf("commands:\n got %q\nwant %q", got, want)
+	}
+
+	if _, err := os.Stat(oldPool); !os.IsNotExist(err) {
+		t.Errorf("old pool %s was not removed", oldPool)
+	}
+	if _, err := os.Stat(newPool); err != nil {
+		t.Errorf("new pool was not written: %v", err)
+	}
+	site, err := sm.DB.GetSite("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if site.PHPVersion != "8.4" {
+		t.Errorf("PHP version = %s, want 8.4", site.PHPVersion)
+	}
+	if config, _ := os.ReadFile(sm.siteConfigFile("example.com")); !strings.Contains(string(config), "php8.4-fpm") {
+		t.Errorf("Caddy config does not use the PHP 8.4 socket:\n%s", config)
+	}
+}
+
+// brokenConfigRunner fails a command while a broken config is in place, like
+// php-fpm -t and reloads do for an invalid pool or site config
+type brokenConfigRunner struct {
+	*RecordingRunner
+	command string
+	broken  func() bool
+}
+
+func (r brokenConfigRunner) Run(name string, args ...string) error {
+	_, err := r.Output(name, args...)
+	return err
+}
+
+func (r brokenConfigRunner) Output(name string, args ...string) ([]byte, error) {
+	out, err := r.RecordingRunner.Output(name, args...)
+	if (RecordedCommand{Name: name, Args: args}).String() == r.command && r.broken() {
+		return nil, errors.New("exit status 1")
+	}
+	return out, err
+}
+
+func TestSwitchPHPVersionRollback(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    []string
+	}{
+		{
+			name:    "new pool fails the test",
+			command: "php-fpm8.4 -t",
+			want:    []string{"php-fpm8.4 -t", "php-fpm8.4 -t", "systemctl reload php8.4-fpm"},
+		},
+		{
+			name:    "new pool fails to load",
+			command: "systemctl reload php8.4-fpm",
+			want:    []string{"systemctl reload php8.4-fpm", "php-fpm8.4 -t", "systemctl reload php8.4-fpm"},
+		},
+		{
+			name:    "Caddy fails to reload",
+			command: "systemctl reload caddy",
+			want:    []string{"systemctl reload caddy", "systemctl reload caddy", "php-fpm8.4 -t", "systemctl reload php8.4-fpm"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm, runner := newTestManager(t)
+			oldPool, newPool := newPHPSite(t, sm)
+			configFile := sm.siteConfigFile("example.com")
+			config, err := os.ReadFile(configFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The new pool or the Caddy config using it is what breaks
+			runner.Reset()
+			sm.Runner = brokenConfigRunner{RecordingRunner: runner, command: tt.command, broken: func() bool {
+				if tt.command == "systemctl reload caddy" {
+					current, _ := os.ReadFile(configFile)
+					return strings.Contains(string(current), "php8.4-fpm")
+				}
+				_, err := os.Stat(newPool)
+				return err == nil
+			}}
+			err = sm.SwitchPHPVersion("example.com", "8.4")
+			if err == nil || strings.Contains(err.Error(), "rollback incomplete") {
+				t.Fatalf("SwitchPHPVersion error = %v", err)
+			}
+
+			// The rollback removes the new pool and reloads its PHP-FPM
+			got := commandLines(runner)
+			if len(got) < len(tt.want) || !reflect.DeepEqual(got[len(got)-len(tt.want):], tt.want) {
+				t.Errorf("commands = %q, want them to end with %q", got, tt.want)
+			}
+			for _, line := range got {
+				if strings.Contains(line, "8.3") {
+					t.Errorf("PHP-FPM 8.3 was touched: %s", line)
+				}
+			}
+
+			if _, err := os.Stat(newPool); !os.IsNotExist(err) {
+				t.Errorf("new pool %s was left behind", newPool)
+			}
+			if _, err := os.Stat(oldPool); err != nil {
+				t.Errorf("old pool was removed: %v", err)
+			}
+			if restored, _ := os.ReadFile(configFile); string(restored) != string(config) {
+				t.Errorf("Caddy config was not restored:\n%s", restored)
+			}
+			if site, _ := sm.DB.GetSite("example.com"); site.PHPVersion != "8.3" {
+				t.Errorf("PHP version = %s, want 8.3", site.PHPVersion)
+			}
+		})
+	}
+}
+
+func TestSwitchPHPVersionWarnsAboutOldPool(t *testing.T) {
+	sm, runner := newTestManager(t)
+	newPHPSite(t, sm)
+
+	runner.Errors["php-fpm8.3 -t"] = errors.New("exit status 78")
+	if err := sm.SwitchPHPVersion("example.com", "8.4"); err != nil {
+		t.Fatalf("SwitchPHPVersion: %v", err)
+	}
+	if out := sm.Out.(*bytes.Buffer).String(); !strings.Contains(out, "Warning: switched to PHP 8.4, but PHP-FPM 8.3 was not reloaded") {
+		t.Errorf("output = %q, want a warning about PHP-FPM 8.3", out)
+	}
+	for _, line := range runner.CommandLines() {
+		if line == "systemctl reload php8.3-fpm" {
+			t.Error("PHP-FPM 8.3 was reloaded after its configuration test failed")
+		}
+	}
+	if site, _ := sm.DB.GetSite("example.com"); site.PHPVersion != "8.4" {
+		t.Errorf("PHP version = %s, want 8.4", site.PHPVersion)
+	}
+}
@@ -0,0 +1,258 @@
+package site
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+// PHP-FPM process manager modes
+const (
+	PMStatic   = "static"
+	PMDynamic  = "dynamic"
+	PMOndemand = "ondemand"
+)
+
+// setDefaultPoolSettings sets the process manager settings used unless a site
+// is tuned with create flags or pool set
+func setDefaultPoolSettings(site *database.Site) {
+	site.PM = PMDynamic
+	site.PMMaxChildren = 10
+	site.PMStartServers = 3
+	site.PMMinSpareServers = 2
+	site.PMMaxSpareServers = 5
+	site.PMMaxRequests = 1000
+	site.PMProcessIdleTimeout = "10s"
+}
+
+// idleTimeoutPattern matches PHP-FPM time values such as 10s or 5m
+var idleTimeoutPattern = regexp.MustCompile(`^[0-9]+[smhd]?$`)
+
+// poolSettings are the settings accepted by pool set, keyed by their name in
+// the PHP-FPM pool configuration
+var poolSettings = map[string]func(site *database.Site, value string) error{
+	"pm": func(site *database.Site, value string) error {
+		switch value {
+		case PMStatic, PMDynamic, PMOndemand:
+			site.PM = value
+			return nil
+		}
+		return fmt.Errorf("invalid pm %q (use %s, %s or %s)", value, PMStatic, PMDynamic, PMOndemand)
+	},
+	"pm.max_children":      intSetting(func(site *database.Site) *int { return &site.PMMaxChildren }),
+	"pm.start_servers":     intSetting(func(site *database.Site) *int { return &site.PMStartServers }),
+	"pm.min_spare_servers": intSetting(func(site *database.Site) *int { return &site.PMMinSpareServers }),
+	"pm.max_spare_servers": intSetting(func(site *database.Site) *int { return &site.PMMaxSpareServers }),
+	"pm.max_requests":      intSetting(func(site *database.Site) *int { return &site.PMMaxRequests }),
+	"pm.process_idle_timeout": func(site *database.Site, value string) error {
+		if !idleTimeoutPattern.MatchString(value) {
+			return fmt.Errorf("invalid pm.process_idle_timeout %q (use e.g. 10s or 5m)", value)
+		}
+		site.PMProcessIdleTimeout = value
+		return nil
+	},
+}
+
+// intSetting returns the setter of a numeric pool setting
+func intSetting(field func(site *database.Site) *int) func(site *database.Site, value string) error {
+	return func(site *database.Site, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		*field(site) = n
+		return nil
+	}
+}
+
+// PoolSettingNames returns the names accepted by pool set in order
+func PoolSettingNames() []string {
+	var names []string
+	for name := range poolSettings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validatePoolSettings checks the process manager settings of a site the way
+// PHP-FPM does when it loads the pool
+func validatePoolSettings(site *database.Site) error {
+	if site.PMMaxChildren < 1 {
+		return fmt.Errorf("pm.max_children must be at least 1")
+	}
+
+	if site.PM == PMDynamic {
+		if site.PMMinSpareServers < 1 {
+			return fmt.Errorf("pm.min_spare_servers must be at least 1")
+		}
+		if site.PMMinSpareServers > site.PMStartServers || site.PMStartServers > site.PMMaxSpareServers {
+			return fmt.Errorf("pm.start_servers (%d) must be between pm.min_spare_servers (%d) and pm.max_spare_servers (%d)",
+				site.PMStartServers, site.PMMinSpareServers, site.PMMaxSpareServers)
+		}
+		if site.PMMaxSpareServers > site.PMMaxChildren {
+			return fmt.Errorf("pm.max_spare_servers (%d) must not be greater than pm.max_children (%d)",
+				site.PMMaxSpareServers, site.PMMaxChildren)
+		}
+	}
+
+	return nil
+}
+
+// SetPoolSettings changes process manager settings of a site, given as
+// name=value pairs, re-renders its PHP-FPM pool and reloads PHP-FPM
+func (sm *SQLiteSiteManager) SetPoolSettings(domain string, settings []string) error {
+	if sm.Config.Verbose {
+		fmt.Fprintf(sm.Out, "Updating PHP-FPM pool settings of %s\n", domain)
+	}
+
+	// Get site from database
+	site, err := sm.DB.GetSite(domain)
+	if err != nil {
+		return err
+	}
+
+	if site.PoolName == "" {
+		return fmt.Errorf("%s sites have no PHP-FPM pool", DisplayName(site.Type))
+	}
+
+	previous := *site
+	for _, setting := range settings {
+		name, value, found := strings.Cut(setting, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		set, ok := poolSettings[name]
+		if !found || !ok {
+			return fmt.Errorf("invalid pool setting %q (use name=value with name one of %s)", setting, strings.Join(PoolSettingNames(), ", "))
+		}
+		if err := set(site, value); err != nil {
+			return err
+		}
+	}
+
+	if err := validatePoolSettings(site); err != nil {
+		return err
+	}
+
+	if sm.Config.DryRun {
+		if sm.Config.Verbose {
+			fmt.Fprintf(sm.Out, "Would update PHP-FPM pool %s: %s\n", site.PoolName, strings.Join(settings, ", "))
+		}
+		return nil
+	}
+
+	if err := sm.DB.UpdateSite(site); err != nil {
+		return fmt.Errorf("failed to update site in database: %v", err)
+	}
+
+	return sm.updatePool(site, func() error {
+		return sm.DB.UpdateSite(&previous)
+	})
+}
+
+// poolTemplateData is the data of the PHP-FPM pool templates
+type poolTemplateData struct {
+	*database.Site
+	PoolUser    string
+	PoolGroup   string
+	PHPSettings []PHPSetting
+}
+
+// poolTemplateData collects a site, the user its pool runs as and its
+// effective PHP settings for the pool templates
+func (sm *SQLiteSiteManager) poolTemplateData(site *database.Site) (*poolTemplateData, error) {
+	overrides, err := sm.DB.GetPHPSettings(site.ID)
+	if err != nil {
+		return nil, err
+	}
+	data := &poolTemplateData{Site: site, PHPSettings: effectivePHPSettings(site, overrides)}
+	data.PoolUser, data.PoolGroup = poolUser(site)
+	return data, nil
+}
+
+// updatePool re-renders the PHP-FPM pool of a site after its settings changed
+// in the database and reloads PHP-FPM. A reload reports success even when the
+// master then fails on an invalid pool, so the configuration is tested first.
+// If the test or the reload fails, the previous pool is restored and revert
+// puts the previous settings back.
+func (sm *SQLiteSiteManager) updatePool(site *database.Site, revert func() error) error {
+	restorePool, err := snapshotFile(sm.poolConfigFile(site))
+	if err != nil {
+		return fmt.Errorf("failed to inspect PHP-FPM pool: %v", err)
+	}
+
+	poolTemplate, err := poolTemplateName(site)
+	if err != nil {
+		return err
+	}
+	if err := sm.createPHPFPMPool(site, poolTemplate); err != nil {
+		if revertErr := revert(); revertErr != nil {
+			return fmt.Errorf("failed to update PHP-FPM pool: %v (failed to restore previous settings: %v)", err, revertErr)
+		}
+		return fmt.Errorf("failed to update PHP-FPM pool: %v", err)
+	}
+
+	// rollback puts the previous pool and settings back
+	rollback := func(err error) error {
+		if restoreErr := restorePool(); restoreErr != nil {
+			return fmt.Errorf("%v (failed to restore previous pool: %v)", err, restoreErr)
+		}
+		if revertErr := revert(); revertErr != nil {
+			return fmt.Errorf("%v (failed to restore previous settings: %v)", err, revertErr)
+		}
+		return fmt.Errorf("%v (previous pool restored)", err)
+	}
+
+	if err := sm.testPHPFPMConfig(site.PHPVersion); err != nil {
+		return rollback(err)
+	}
+
+	if err := sm.reloadPHPFPM(site.PHPVersion); err != nil {
+		err = rollback(err)
+		sm.reloadPHPFPM(site.PHPVersion)
+		return err
+	}
+
+	return nil
+}
+
+// testPHPFPMConfig checks the configuration of PHP-FPM including all pools
+// with php-fpm -t, so an invalid pool is found before PHP-FPM is reloaded
+func (sm *SQLiteSiteManager) testPHPFPMConfig(phpVersion string) error {
+	if sm.Config.Verbose {
+		fmt.Fprintf(sm.Out, "Testing PHP-FPM %s configuration...\n", phpVersion)
+	}
+
+	if _, err := sm.Runner.Output("php-fpm"+phpVersion, "-t"); err != nil {
+		return fmt.Errorf("PHP-FPM %s configuration test failed: %v", phpVersion, commandError(err))
+	}
+	return nil
+}
+
+// reloadPHPFPM gracefully reloads PHP-FPM so changed pools take effect
+func (sm *SQLiteSiteManager) reloadPHPFPM(phpVersion string) error {
+	if sm.Config.DryRun {
+		if sm.Config.Verbose {
+			fmt.Fprintf(sm.Out, "Would reload PHP-FPM %s\n", phpVersion)
+		}
+		return nil
+	}
+
+	if sm.Config.Verbose {
+		fmt.Fprintf(sm.Out, "Reloading PHP-FPM %s...\n", phpVersion)
+	}
+
+	serviceName := fmt.Sprintf("php%s-fpm", phpVersion)
+	if _, err := sm.Runner.Output("systemctl", "reload", serviceName); err != nil {
+		return fmt.Errorf("failed to reload PHP-FPM: %v", commandError(err))
+	}
+
+	if sm.Config.Verbose {
+		fmt.Fprintln(sm.Out, "PHP-FPM reloaded successfully.")
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package site
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSetPoolSettingsRestoresPoolWhenTestFails(t *testing.T) {
+	sm, runner := newTestManager(t)
+	if _, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com"}); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	site, err := sm.DB.GetSite("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := os.ReadFile(sm.poolConfigFile(site))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner.Reset()
+	runner.Errors["php-fpm8.3 -t"] = errors.New("exit status 78")
+	err = sm.SetPoolSettings("example.com", []string{"pm.max_children=40"})
+	if err == nil || !strings.Contains(err.Error(), "previous pool restored") {
+		t.Fatalf("SetPoolSettings error = %v", err)
+	}
+
+	got := runner.CommandLines()
+	if len(got) == 0 || got[len(got)-1] != "php-fpm8.3 -t" {
+		t.Errorf("commands = %q, want the configuration test and no reload", got)
+	}
+	if restored, _ := os.ReadFile(sm.poolConfigFile(site)); string(restored) != string(pool) {
+		t.Errorf("pool was not restored:\n%s", restored)
+	}
+	if reverted, _ := sm.DB.GetSite("example.com"); reverted.PMMaxChildren != site.PMMaxChildren {
+		t.Errorf("pm.max_children = %d, want %d", reverted.PMMaxChildren, site.PMMaxChildren)
+	}
+}
+
+func TestSetPoolSettingsTestsBeforeReload(t *testing.T) {
+	sm, runner := newTestManager(t)
+	if _, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com"}); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+
+	runner.Reset()
+	if err := sm.SetPoolSettings("example.com", []string{"pm.max_children=40"}); err != nil {
+		t.Fatalf("SetPoolSettings: %v", err)
+	}
+	want := []string{
+		"chown www-data:www-data " + sm.poolLogDir(),
+		"php-fpm8.3 -t",
+		"systemctl reload php8.3-fpm",
+	}
+	if got := runner.CommandLines(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,159 @@
+package site
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// CommandRunner executes external commands on behalf of the site manager.
+// Every side effect that shells out (systemctl, caddy, chown, find)
+// goes through this interface so it can be replaced in tests.
+type CommandRunner interface {
+	// Run executes the command and returns an error if it fails
+	Run(name string, args ...string) error
+	// Output executes the command and returns its standard output
+	Output(name string, args ...string) ([]byte, error)
+}
+
+// ExecRunner runs commands on the local host using os/exec
+type ExecRunner struct{}
+
+// Run executes the command on the host
+func (ExecRunner) Run(name string, args ...string) error {
+	return exec.Command(name, args...).Run()
+}
+
+// Output executes the command on the host and returns its standard output
+func (ExecRunner) Output(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).Output()
+}
+
+// commandError adds what a failed command printed to standard error to its
+// error, which otherwise only holds the exit status
+func commandError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if stderr := strings.TrimSpace(string(exitErr.Stderr)); stderr != "" {
+			return fmt.Errorf("%v: %s", err, stderr)
+		}
+	}
+	return err
+}
+
+// RecordedCommand is a single command captured by RecordingRunner
+type RecordedCommand struct {
+	Name string
+	Args []string
+}
+
+// String returns the command as it would be typed in a shell
+func (c RecordedCommand) String() string {
+	return strings.TrimSpace(c.Name + " " + strings.Join(c.Args, " "))
+}
+
+// RecordingRunner is a fake CommandRunner that records every command instead
+// of executing it. Outputs and Errors are keyed by the full command line
+// (see RecordedCommand.String) and let tests script command results.
+type RecordingRunner struct {
+	Outputs map[string][]byte
+	Errors  map[string]error
+
+	mu       sync.Mutex
+	commands []RecordedCommand
+}
+
+// NewRecordingRunner creates an empty recording runner
+func NewRecordingRunner() *RecordingRunner {
+	return &RecordingRunner{
+		Outputs: make(map[string][]byte),
+		Errors:  make(map[string]error),
+	}
+}
+
+// Run records the command and returns the scripted error, if any
+func (r *RecordingRunner) Run(name string, args ...string) error {
+	_, err := r.Output(name, args...)
+	return err
+}
+
+// Output records the command and returns the scripted output and error
+func (r *RecordingRunner) Output(name string, args ...string) ([]byte, error) {
+	cmd := RecordedCommand{Name: name, Args: append([]string(nil), args...)}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = append(r.commands, cmd)
+
+	line := cmd.String()
+	return r.Outputs[line], r.Errors[line]
+}
+
+// Commands returns a copy of the commands recorded so far
+func (r *RecordingRunner) Commands() []RecordedCommand {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedCommand(nil), r.commands...)
+}
+
+// CommandLines returns the recorded commands formatted as shell lines
+func (r *RecordingRunner) CommandLines() []string {
+	var lines []string
+	for _, cmd := range r.Commands() {
+		lines = append(lines, cmd.String())
+	}
+	return lines
+}
+
+// Reset clears the recorded commands
+func (r *RecordingRunner) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = nil
+}
+
+// SandboxRunner is used when all paths are staged below a root prefix. It only
+// executes commands that neither change host services nor ownership (hashing
+// passwords, adjusting modes of staged files) and skips everything else.
+type SandboxRunner struct {
+	Exec    CommandRunner
+	Out     io.Writer
+	Verbose bool
+}
+
+// NewSandboxRunner creates a sandbox runner that delegates safe commands to
+// exec and reports skipped commands to out
+func NewSandboxRunner(exec CommandRunner, out io.Writer, verbose bool) *SandboxRunner {
+	return &SandboxRunner{Exec: exec, Out: out, Verbose: verbose}
+}
+
+// Run executes safe commands and skips all others
+func (r *SandboxRunner) Run(name string, args ...string) error {
+	_, err := r.Output(name, args...)
+	return err
+}
+
+// Output executes safe commands and skips all others, returning no output
+func (r *SandboxRunner) Output(name string, args ...string) ([]byte, error) {
+	if sandboxSafe(name, args) {
+		return r.Exec.Output(name, args...)
+	}
+	if r.Verbose {
+		fmt.Fprintf(r.Out, "Sandbox: skipping %s\n", RecordedCommand{Name: name, Args: args})
+	}
+	return nil, nil
+}
+
+// sandboxSafe reports whether a command is safe to run against a staged root
+func sandboxSafe(name string, args []string) bool {
+	switch name {
+	case "htpasswd", "find":
+		return true
+	case "caddy":
+		return len(args) > 0 && args[0] == "hash-password"
+	}
+	return false
+}
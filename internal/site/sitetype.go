@@ -0,0 +1,191 @@
+package site
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+// Names of the built-in site types
+const (
+	TypePHP       = "php"
+	TypeWordPress = "wordpress"
+	TypeProxy     = "proxy"
+	TypeStatic    = "static"
+	TypeLaravel   = "laravel"
+	TypeSymfony   = "symfony"
+)
+
+// DefaultSiteType is used when no site type is given
+const DefaultSiteType = TypePHP
+
+// SiteType defines how one kind of site is provisioned, configured and torn
+// down. The site manager handles everything that is common to all sites
+// (config file, symlink, database record, reloads) and delegates the rest.
+type SiteType interface {
+	// Name is the identifier stored in the site_type column
+	Name() string
+	// DisplayName is the human readable name of the site type
+	DisplayName() string
+	// Description explains the site type in help output
+	Description() string
+	// UsesDatabase reports whether sites of this type get a MySQL database
+	UsesDatabase() bool
+	// CaddyTemplate is the name of the Caddy config template
+	CaddyTemplate() string
+	// PoolTemplate is the name of the PHP-FPM pool template, or empty if
+	// sites of this type have no PHP-FPM pool
+	PoolTemplate() string
+	// Configure validates the type specific create options and applies them
+	// to the new site record. Clearing DocumentRoot means the site has none.
+	Configure(site *database.Site, opts *SiteCreateOptions) error
+	// Provision creates the document root and content of a new site. Every
+	// step must be recorded in the journal so it can be rolled back.
+	Provision(sm *SQLiteSiteManager, site *database.Site, j *journal) error
+	// Teardown removes what Provision created outside the document root
+	Teardown(sm *SQLiteSiteManager, site *database.Site) error
+	// NextSteps returns instructions shown after a site was created
+	NextSteps(site *database.Site) []string
+}
+
+// siteTypes is the registry of known site types by name
+var siteTypes = make(map[string]SiteType)
+
+// RegisterSiteType makes a site type available to create. It panics if a
+// site type with the same name is already registered.
+func RegisterSiteType(t SiteType) {
+	if _, exists := siteTypes[t.Name()]; exists {
+		panic(fmt.Sprintf("site type %q registered twice", t.Name()))
+	}
+	siteTypes[t.Name()] = t
+}
+
+// LookupSiteType returns the registered site type with the given name
+func LookupSiteType(name string) (SiteType, error) {
+	t, ok := siteTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown site type %q (available: %s)", name, strings.Join(SiteTypeNames(), ", "))
+	}
+	return t, nil
+}
+
+// SiteTypeNames returns the names of all registered site types in order
+func SiteTypeNames() []string {
+	names := make([]string, 0, len(siteTypes))
+	for name := range siteTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DisplayName returns the human readable name of a stored site type,
+// falling back to the stored name for types this binary does not know
+func DisplayName(typeName string) string {
+	if t, err := LookupSiteType(typeName); err == nil {
+		return t.DisplayName()
+	}
+	return typeName
+}
+
+func init() {
+	RegisterSiteType(phpSiteType{})
+	RegisterSiteType(wordpressSiteType{})
+	RegisterSiteType(proxySiteType{})
+	RegisterSiteType(staticSiteType{})
+	RegisterSiteType(laravelSiteType)
+	RegisterSiteType(symfonySiteType)
+}
+
+// provisionDocumentRoot creates the site directory, fills it with content and
+// sets permissions. It is shared by the site types that serve files.
+func (sm *SQLiteSiteManager) provisionDocumentRoot(site *database.Site, j *journal, content func() error) error {
+	// Create site directory
+	j.record("site directory "+site.DocumentRoot, func() error {
+		return sm.removeDirectory(sm.siteDirectory(site))
+	})
+	if err := sm.createSiteDirectory(site); err != nil {
+		return fmt.Errorf("failed to create site directory: %v", err)
+	}
+
+	// Create site content
+	if err := content(); err != nil {
+		return err
+	}
+
+	// Set permissions
+	if err := sm.setPermissions(site); err != nil {
+		return fmt.Errorf("failed to set permissions: %v", err)
+	}
+
+	return nil
+}
+
+// phpSiteType is a plain PHP site served by its own PHP-FPM pool
+type phpSiteType struct{}
+
+func (phpSiteType) Name() string          { return TypePHP }
+func (phpSiteType) DisplayName() string   { return "PHP" }
+func (phpSiteType) Description() string   { return "PHP site with its own PHP-FPM pool" }
+func (phpSiteType) UsesDatabase() bool    { return false }
+func (phpSiteType) CaddyTemplate() string { return "caddy/php" }
+func (phpSiteType) PoolTemplate() string  { return "php-fpm/pool" }
+
+func (phpSiteType) Configure(site *database.Site, opts *SiteCreateOptions) error {
+	return nil
+}
+
+func (phpSiteType) Provision(sm *SQLiteSiteManager, site *database.Site, j *journal) error {
+	return sm.provisionDocumentRoot(site, j, func() error {
+		if err := sm.createBasicPHPSite(site); err != nil {
+			return fmt.Errorf("failed to create basic PHP site: %v", err)
+		}
+		return nil
+	})
+}
+
+func (phpSiteType) Teardown(sm *SQLiteSiteManager, site *database.Site) error {
+	return nil
+}
+
+func (phpSiteType) NextSteps(site *database.Site) []string {
+	return []string{fmt.Sprintf("Visit https://%s to view your PHP site", site.Domain)}
+}
+
+// wordpressSiteType is a WordPress installation with its own MySQL database
+type wordpressSiteType struct{}
+
+func (wordpressSiteType) Name() string        { return TypeWordPress }
+func (wordpressSiteType) DisplayName() string { return "WordPress" }
+func (wordpressSiteType) Description() string {
+	return "WordPress with its own PHP-FPM pool and MySQL database"
+}
+func (wordpressSiteType) UsesDatabase() bool    { return true }
+func (wordpressSiteType) CaddyTemplate() string { return "caddy/wordpress" }
+func (wordpressSiteType) PoolTemplate() string  { return "php-fpm/pool" }
+
+func (wordpressSiteType) Configure(site *database.Site, opts *SiteCreateOptions) error {
+	return nil
+}
+
+func (wordpressSiteType) Provision(sm *SQLiteSiteManager, site *database.Site, j *journal) error {
+	return sm.provisionDocumentRoot(site, j, func() error {
+		if err := sm.createWordPressSite(site, j); err != nil {
+			return fmt.Errorf("failed to create WordPress site: %v", err)
+		}
+		return nil
+	})
+}
+
+func (wordpressSiteType) Teardown(sm *SQLiteSiteManager, site *database.Site) error {
+	if err := sm.deleteDatabase(site); err != nil {
+		return fmt.Errorf("failed to delete database: %v", err)
+	}
+	return nil
+}
+
+func (wordpressSiteType) NextSteps(site *database.Site) []string {
+	return []string{fmt.Sprintf("Visit https://%s to complete WordPress installation", site.Domain)}
+}
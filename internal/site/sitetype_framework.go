@@ -0,0 +1,204 @@
+package site
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+// frameworkSiteType is a PHP framework application with a front controller in
+// public/. The document root holds the whole project, Caddy only serves its
+// public/ directory. The application itself is deployed by the user; the site
+// type prepares the directory layout, the database and the environment file.
+type frameworkSiteType struct {
+	name        string
+	displayName string
+	// envFile is the environment file the credentials are written to
+	envFile string
+	// env renders the contents of envFile
+	env func(site *database.Site) (string, error)
+	// writableDirs must be writable by the PHP-FPM pool
+	writableDirs []string
+}
+
+func (t frameworkSiteType) Name() string        { return t.name }
+func (t frameworkSiteType) DisplayName() string { return t.displayName }
+func (t frameworkSiteType) Description() string {
+	return t.displayName + " application served from public/, with its own PHP-FPM pool and MySQL database"
+}
+func (frameworkSiteType) UsesDatabase() bool    { return true }
+func (frameworkSiteType) CaddyTemplate() string { return "caddy/framework" }
+func (frameworkSiteType) PoolTemplate() string  { return "php-fpm/pool" }
+
+func (frameworkSiteType) Configure(site *database.Site, opts *SiteCreateOptions) error {
+	return nil
+}
+
+func (t frameworkSiteType) Provision(sm *SQLiteSiteManager, site *database.Site, j *journal) error {
+	err := sm.provisionDocumentRoot(site, j, func() error {
+		if err := sm.createFrameworkSite(site, t, j); err != nil {
+			return fmt.Errorf("failed to create %s site: %v", t.displayName, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return sm.setWritableDirectories(site, t.writableDirs)
+}
+
+func (frameworkSiteType) Teardown(sm *SQLiteSiteManager, site *database.Site) error {
+	if err := sm.deleteDatabase(site); err != nil {
+		return fmt.Errorf("failed to delete database: %v", err)
+	}
+	return nil
+}
+
+func (t frameworkSiteType) NextSteps(site *database.Site) []string {
+	return []string{
+		fmt.Sprintf("Deploy your %s application to %s (Caddy serves %s)", t.displayName, site.DocumentRoot, filepath.Join(site.DocumentRoot, "public")),
+		fmt.Sprintf("Database credentials are in %s", filepath.Join(site.DocumentRoot, t.envFile)),
+	}
+}
+
+// createFrameworkSite creates the directory layout, a placeholder front
+// controller and the environment file of a framework site
+func (sm *SQLiteSiteManager) createFrameworkSite(site *database.Site, t frameworkSiteType, j *journal) error {
+	if sm.Config.DryRun {
+		if sm.Config.Verbose {
+			fmt.Fprintf(sm.Out, "Would create %s site in: %s\n", t.displayName, site.DocumentRoot)
+		}
+		return nil
+	}
+
+	if sm.Config.Verbose {
+		fmt.Fprintf(sm.Out, "Creating %s site structure...\n", t.displayName)
+	}
+
+	siteDir := sm.siteDirectory(site)
+	for _, dir := range append([]string{"public"}, t.writableDirs...) {
+		if err := os.MkdirAll(filepath.Join(siteDir, dir), 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %v", dir, err)
+		}
+	}
+
+	indexContent := fmt.Sprintf(`<?php
+echo "<h1>Welcome to %s</h1>";
+echo "<p>Deploy your %s application to replace this page.</p>";
+`, site.Domain, t.displayName)
+
+	indexFile := filepath.Join(siteDir, "public", "index.php")
+	if err := os.WriteFile(indexFile, []byte(indexContent), 0644); err != nil {
+		return fmt.Errorf("failed to create public/index.php: %v", err)
+	}
+
+	// Create database and user
+	if err := sm.provisionDatabase(site, j); err != nil {
+		return err
+	}
+
+	env, err := t.env(site)
+	if err != nil {
+		return fmt.Errorf("failed to generate %s: %v", t.envFile, err)
+	}
+	if err := os.WriteFile(filepath.Join(siteDir, t.envFile), []byte(env), 0640); err != nil {
+		return fmt.Errorf("failed to create %s: %v", t.envFile, err)
+	}
+
+	if sm.Config.Verbose {
+		fmt.Fprintf(sm.Out, "%s site files created\n", t.displayName)
+	}
+
+	return nil
+}
+
+// randomBytes returns n bytes from the system's secure random source
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// dotenvQuote quotes a value for a .env file. Both phpdotenv and Symfony's
+// Dotenv unescape backslashes, quotes and dollar signs in double quotes, and
+// expand variables from unescaped dollar signs.
+func dotenvQuote(value string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`, "\r", `\r`)
+	return `"` + r.Replace(value) + `"`
+}
+
+// laravelEnv renders a production .env for Laravel. The database is reached
+// as localhost, the host the site's MySQL account is created for.
+func laravelEnv(site *database.Site) (string, error) {
+	key, err := randomBytes(32)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(`APP_NAME=%s
+APP_ENV=production
+APP_KEY=base64:%s
+APP_DEBUG=false
+APP_URL=https://%s
+
+LOG_CHANNEL=stack
+
+DB_CONNECTION=mysql
+DB_HOST=%s
+DB_PORT=3306
+DB_DATABASE=%s
+DB_USERNAME=%s
+DB_PASSWORD=%s
+`, dotenvQuote(site.Domain), base64.StdEncoding.EncodeToString(key), site.Domain, databaseUserHost,
+		dotenvQuote(site.DBName), dotenvQuote(site.DBUser), dotenvQuote(site.DBPassword)), nil
+}
+
+// symfonyEnv renders a production .env.local for Symfony, which overrides the
+// .env that is committed with the application
+func symfonyEnv(site *database.Site) (string, error) {
+	secret, err := randomBytes(16)
+	if err != nil {
+		return "", err
+	}
+
+	databaseURL := url.URL{
+		Scheme:   "mysql",
+		User:     url.UserPassword(site.DBUser, site.DBPassword),
+		Host:     databaseUserHost + ":3306",
+		Path:     "/" + site.DBName,
+		RawQuery: "charset=utf8mb4",
+	}
+
+	return fmt.Sprintf(`APP_ENV=prod
+APP_SECRET=%s
+DATABASE_URL=%s
+`, hex.EncodeToString(secret), dotenvQuote(databaseURL.String())), nil
+}
+
+// laravelSiteType keeps storage/ and bootstrap/cache writable for the pool
+var laravelSiteType = frameworkSiteType{
+	name:         TypeLaravel,
+	displayName:  "Laravel",
+	envFile:      ".env",
+	env:          laravelEnv,
+	writableDirs: []string{"storage", "bootstrap/cache"},
+}
+
+// symfonySiteType keeps var/ writable for the pool
+var symfonySiteType = frameworkSiteType{
+	name:         TypeSymfony,
+	displayName:  "Symfony",
+	envFile:      ".env.local",
+	env:          symfonyEnv,
+	writableDirs: []string{"var"},
+}
@@ -0,0 +1,85 @@
+package site
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+// envValue returns the raw value of a variable in a rendered .env file
+func envValue(t *testing.T, env, name string) string {
+	t.Helper()
+	for _, line := range strings.Split(env, "\n") {
+		if value, found := strings.CutPrefix(line, name+"="); found {
+			return value
+		}
+	}
+	t.Fatalf("%s is not set in:\n%s", name, env)
+	return ""
+}
+
+func TestDotenvQuote(t *testing.T) {
+	tests := map[string]string{
+		"s3cr3t":             `"s3cr3t"`,
+		`p#ss word`:          `"p#ss word"`,
+		`say "hi"`:           `"say \"hi\""`,
+		`C:\path\`:           `"C:\\path\\"`,
+		`$HOME and ${USER}`:  `"\$HOME and \${USER}"`,
+		"two\nlines\r":       `"two\nlines\r"`,
+		"user@host:3306/db?": `"user@host:3306/db?"`,
+	}
+	for value, want := range tests {
+		if got := dotenvQuote(value); got != want {
+			t.Errorf("dotenvQuote(%q) = %s, want %s", value, got, want)
+		}
+	}
+}
+
+const awkwardPassword = `p#ss w"rd@host:1/x$y\`
+
+func TestLaravelEnv(t *testing.T) {
+	site := &database.Site{Domain: "example.com", DBName: "example_com", DBUser: "example_com", DBPassword: awkwardPassword}
+	env, err := laravelEnv(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"APP_NAME":    `"example.com"`,
+		"DB_HOST":     "localhost",
+		"DB_DATABASE": `"example_com"`,
+		"DB_USERNAME": `"example_com"`,
+		"DB_PASSWORD": `"p#ss w\"rd@host:1/x\$y\\"`,
+	} {
+		if got := envValue(t, env, name); got != want {
+			t.Errorf("%s=%s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestSymfonyEnv(t *testing.T) {
+	site := &database.Site{Domain: "example.com", DBName: "example_com", DBUser: "example_com", DBPassword: awkwardPassword}
+	env, err := symfonyEnv(site)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := envValue(t, env, "DATABASE_URL")
+	if !strings.HasPrefix(value, `"`) || !strings.HasSuffix(value, `"`) {
+		t.Fatalf("DATABASE_URL=%s is not quoted", value)
+	}
+	// Undo the dotenv escaping the way Symfony's Dotenv does
+	raw := strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\$`, `$`).Replace(strings.Trim(value, `"`))
+
+	dsn, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("DATABASE_URL %s does not parse: %v", raw, err)
+	}
+	password, _ := dsn.User.Password()
+	if dsn.Scheme != "mysql" || dsn.User.Username() != "example_com" || password != awkwardPassword ||
+		dsn.Host != "localhost:3306" || dsn.Path != "/example_com" || dsn.RawQuery != "charset=utf8mb4" {
+		t.Errorf("DATABASE_URL = %s, parsed as user %s password %q host %s path %s", raw, dsn.User.Username(), password, dsn.Host, dsn.Path)
+	}
+}
@@ -0,0 +1,63 @@
+package site
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+// lbPolicies are the Caddy load balancing policies that take no arguments
+var lbPolicies = []string{
+	"random", "random_choose", "round_robin", "least_conn", "first",
+	"ip_hash", "client_ip_hash", "uri_hash",
+}
+
+// proxySiteType forwards all requests to one or more backends, e.g. Node or
+// Go services. It has neither a document root nor a PHP-FPM pool.
+type proxySiteType struct{}
+
+func (proxySiteType) Name() string          { return TypeProxy }
+func (proxySiteType) DisplayName() string   { return "Reverse proxy" }
+func (proxySiteType) Description() string   { return "Reverse proxy to one or more backend services" }
+func (proxySiteType) UsesDatabase() bool    { return false }
+func (proxySiteType) CaddyTemplate() string { return "caddy/proxy" }
+func (proxySiteType) PoolTemplate() string  { return "" }
+
+func (proxySiteType) Configure(site *database.Site, opts *SiteCreateOptions) error {
+	if len(opts.Upstreams) == 0 {
+		return fmt.Errorf("a proxy site needs at least one upstream")
+	}
+	for _, upstream := range opts.Upstreams {
+		if upstream == "" || strings.ContainsAny(upstream, " \t{}") {
+			return fmt.Errorf("invalid upstream: %q", upstream)
+		}
+	}
+
+	if opts.LBPolicy != "" && !slices.Contains(lbPolicies, opts.LBPolicy) {
+		return fmt.Errorf("invalid load balancing policy %q (use %s)", opts.LBPolicy, strings.Join(lbPolicies, ", "))
+	}
+	if opts.HealthURI != "" && !strings.HasPrefix(opts.HealthURI, "/") {
+		return fmt.Errorf("health check path must start with /: %s", opts.HealthURI)
+	}
+
+	site.DocumentRoot = ""
+	site.PHPVersion = ""
+	site.Upstreams = opts.Upstreams
+	site.LBPolicy = opts.LBPolicy
+	site.HealthURI = opts.HealthURI
+	return nil
+}
+
+func (proxySiteType) Provision(sm *SQLiteSiteManager, site *database.Site, j *journal) error {
+	return nil
+}
+
+func (proxySiteType) Teardown(sm *SQLiteSiteManager, site *database.Site) error {
+	return nil
+}
+
+func (proxySiteType) NextSteps(site *database.Site) []string {
+	return []string{fmt.Sprintf("Requests to https://%s are forwarded to %s", site.Domain, strings.Join(site.Upstreams, ", "))}
+}
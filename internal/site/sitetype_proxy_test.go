@@ -0,0 +1,101 @@
+package site
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+func TestProxyConfigure(t *testing.T) {
+	tests := []struct {
+		name string
+		opts SiteCreateOptions
+		err  string
+	}{
+		{name: "one upstream", opts: SiteCreateOptions{Upstreams: []string{"127.0.0.1:3000"}}},
+		{name: "policy and health check", opts: SiteCreateOptions{Upstreams: []string{"a:80", "b:80"}, LBPolicy: "least_conn", HealthURI: "/health"}},
+		{name: "no upstream", err: "at least one upstream"},
+		{name: "upstream with a brace", opts: SiteCreateOptions{Upstreams: []string{"a:80 {"}}, err: "invalid upstream"},
+		{name: "unknown policy", opts: SiteCreateOptions{Upstreams: []string{"a:80"}, LBPolicy: "fastest"}, err: "invalid load balancing policy"},
+		{name: "relative health check", opts: SiteCreateOptions{Upstreams: []string{"a:80"}, HealthURI: "health"}, err: "must start with /"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site := &database.Site{DocumentRoot: "/var/www/sites/app.example.com", PHPVersion: "8.3"}
+			err := proxySiteType{}.Configure(site, &tt.opts)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Configure error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Configure: %v", err)
+			}
+			if site.DocumentRoot != "" || site.PHPVersion != "" || !reflect.DeepEqual(site.Upstreams, tt.opts.Upstreams) ||
+				site.LBPolicy != tt.opts.LBPolicy || site.HealthURI != tt.opts.HealthURI {
+				t.Errorf("site = %+v", site)
+			}
+		})
+	}
+}
+
+func TestCreateProxySite(t *testing.T) {
+	sm, runner := newTestManager(t)
+	result, err := sm.CreateSite(&SiteCreateOptions{
+		Domain:    "app.example.com",
+		Type:      TypeProxy,
+		MaxUpload: "10M",
+		Upstreams: []string{"127.0.0.1:3000", "127.0.0.1:3001"},
+		LBPolicy:  "round_robin",
+		HealthURI: "/healthz",
+	})
+	if err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+
+	// Only Caddy is involved: no document root, pool or PHP-FPM restart
+	want := []string{"caddy validate --config <staged Caddyfile> --adapter caddyfile", "systemctl reload caddy"}
+	if got := commandLines(runner); !reflect.DeepEqual(got, want) {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+	if result.PoolConfigFile != "" || result.Site.PoolName != "" || result.Site.DocumentRoot != "" {
+		t.Errorf("proxy site has pool %q (%s) and document root %q", result.Site.PoolName, result.PoolConfigFile, result.Site.DocumentRoot)
+	}
+	if _, err := os.Stat(sm.Config.Path("/var/www/sites/app.example.com")); !os.IsNotExist(err) {
+		t.Error("a document root was created for a proxy site")
+	}
+
+	stored, err := sm.DB.GetSite("app.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stored.Upstreams, result.Site.Upstreams) || stored.LBPolicy != "round_robin" || stored.HealthURI != "/healthz" {
+		t.Errorf("stored proxy settings = %q %s %s", stored.Upstreams, stored.LBPolicy, stored.HealthURI)
+	}
+
+	config, err := sm.renderCaddyConfig(stored, []database.BasicAuth{{Path: "/admin", Username: "admin", Password: "$2a$14$hash"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"reverse_proxy 127.0.0.1:3000 127.0.0.1:3001 {",
+		"lb_policy round_robin",
+		"health_uri /healthz",
+		"max_size 10M",
+		"admin $2a$14$hash",
+	} {
+		if !strings.Contains(config, line) {
+			t.Errorf("config does not contain %q:\n%s", line, config)
+		}
+	}
+	if strings.Contains(config, "php_fastcgi") || strings.Contains(config, "root *") {
+		t.Errorf("proxy config serves files or PHP:\n%s", config)
+	}
+	if strings.Index(config, "route /admin*") > strings.Index(config, "reverse_proxy") {
+		t.Errorf("basic auth is not applied before proxying:\n%s", config)
+	}
+}
@@ -0,0 +1,41 @@
+package site
+
+import (
+	"fmt"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+// staticSiteType serves plain files from the document root, optionally as a
+// single page application. It has no PHP-FPM pool.
+type staticSiteType struct{}
+
+func (staticSiteType) Name() string          { return TypeStatic }
+func (staticSiteType) DisplayName() string   { return "Static" }
+func (staticSiteType) Description() string   { return "Static files served by Caddy, without PHP" }
+func (staticSiteType) UsesDatabase() bool    { return false }
+func (staticSiteType) CaddyTemplate() string { return "caddy/static" }
+func (staticSiteType) PoolTemplate() string  { return "" }
+
+func (staticSiteType) Configure(site *database.Site, opts *SiteCreateOptions) error {
+	site.PHPVersion = ""
+	site.SPAFallback = opts.SPAFallback
+	return nil
+}
+
+func (staticSiteType) Provision(sm *SQLiteSiteManager, site *database.Site, j *journal) error {
+	return sm.provisionDocumentRoot(site, j, func() error {
+		if err := sm.createStaticSite(site); err != nil {
+			return fmt.Errorf("failed to create static site: %v", err)
+		}
+		return nil
+	})
+}
+
+func (staticSiteType) Teardown(sm *SQLiteSiteManager, site *database.Site) error {
+	return nil
+}
+
+func (staticSiteType) NextSteps(site *database.Site) []string {
+	return []string{fmt.Sprintf("Upload your files to %s and visit https://%s", site.DocumentRoot, site.Domain)}
+}
@@ -0,0 +1,91 @@
+package site
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCreateStaticSite(t *testing.T) {
+	for _, spa := range []bool{false, true} {
+		name := "files"
+		if spa {
+			name = "single page application"
+		}
+		t.Run(name, func(t *testing.T) {
+			sm, runner := newTestManager(t)
+			result, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com", Type: TypeStatic, SPAFallback: spa})
+			if err != nil {
+				t.Fatalf("CreateSite: %v", err)
+			}
+
+			for _, line := range commandLines(runner) {
+				if strings.Contains(line, "php") {
+					t.Errorf("static site ran %q", line)
+				}
+			}
+			if result.Site.PoolName != "" || result.Site.PHPVersion != "" || result.PoolConfigFile != "" {
+				t.Errorf("static site has pool %q and PHP %q", result.Site.PoolName, result.Site.PHPVersion)
+			}
+			if _, err := os.Stat(filepath.Join(sm.siteDirectory(&result.Site), "index.html")); err != nil {
+				t.Errorf("index.html was not created: %v", err)
+			}
+
+			config, err := os.ReadFile(result.ConfigFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, line := range []string{"file_server", `header @assets Cache-Control "public, max-age=2592000"`, `header @html Cache-Control "no-cache"`} {
+				if !strings.Contains(string(config), line) {
+					t.Errorf("config does not contain %q:\n%s", line, config)
+				}
+			}
+			if strings.Contains(string(config), "php_fastcgi") {
+				t.Errorf("static config passes requests to PHP:\n%s", config)
+			}
+			if got := strings.Contains(string(config), "try_files {path} /index.html"); got != spa {
+				t.Errorf("SPA fallback in config = %v, want %v", got, spa)
+			}
+		})
+	}
+}
+
+func TestStaticSiteRejectsPoolSettings(t *testing.T) {
+	sm, _ := newTestManager(t)
+	_, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com", Type: TypeStatic, PM: PMOndemand})
+	if err == nil || !strings.Contains(err.Error(), "Static sites have no PHP-FPM pool") {
+		t.Errorf("CreateSite error = %v", err)
+	}
+}
+
+func TestStaticSiteWithoutPool(t *testing.T) {
+	sm, runner := newTestManager(t)
+	if _, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com", Type: TypeStatic}); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+
+	runner.Reset()
+	if err := sm.ModifyMaxUpload("example.com", "64M"); err != nil {
+		t.Fatalf("ModifyMaxUpload: %v", err)
+	}
+	want := []string{"caddy validate --config <staged Caddyfile> --adapter caddyfile", "systemctl reload caddy"}
+	if got := commandLines(runner); !reflect.DeepEqual(got, want) {
+		t.Errorf("ModifyMaxUpload commands = %q, want %q", got, want)
+	}
+	if config, _ := os.ReadFile(sm.siteConfigFile("example.com")); !strings.Contains(string(config), "max_size 64M") {
+		t.Errorf("config was not updated:\n%s", config)
+	}
+
+	runner.Reset()
+	if err := sm.DeleteSite(&SiteDeleteOptions{Domain: "example.com", Hard: true, Force: true}); err != nil {
+		t.Fatalf("DeleteSite: %v", err)
+	}
+	if got := commandLines(runner); !reflect.DeepEqual(got, want) {
+		t.Errorf("DeleteSite commands = %q, want %q", got, want)
+	}
+	if _, err := os.Stat(sm.Config.Path("/var/www/sites/example.com")); !os.IsNotExist(err) {
+		t.Error("the document root was not removed")
+	}
+}
@@ -0,0 +1,96 @@
+package site
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+// recordingSiteType is a PHP site type that records the hooks it was called for
+type recordingSiteType struct {
+	phpSiteType
+	calls *[]string
+}
+
+func (recordingSiteType) Name() string        { return "recording" }
+func (recordingSiteType) DisplayName() string { return "Recording" }
+
+func (t recordingSiteType) Configure(site *database.Site, opts *SiteCreateOptions) error {
+	*t.calls = append(*t.calls, "configure")
+	site.MaxUpload = "1M"
+	return nil
+}
+
+func (t recordingSiteType) Provision(sm *SQLiteSiteManager, site *database.Site, j *journal) error {
+	*t.calls = append(*t.calls, "provision")
+	return t.phpSiteType.Provision(sm, site, j)
+}
+
+func (t recordingSiteType) Teardown(sm *SQLiteSiteManager, site *database.Site) error {
+	*t.calls = append(*t.calls, "teardown")
+	return nil
+}
+
+// registerTestSiteType registers a site type for the duration of a test
+func registerTestSiteType(t *testing.T, siteType SiteType) {
+	t.Helper()
+	RegisterSiteType(siteType)
+	t.Cleanup(func() { delete(siteTypes, siteType.Name()) })
+}
+
+func TestLookupSiteType(t *testing.T) {
+	for _, name := range []string{TypePHP, TypeWordPress, TypeProxy, TypeStatic, TypeLaravel, TypeSymfony} {
+		siteType, err := LookupSiteType(name)
+		if err != nil || siteType.Name() != name {
+			t.Errorf("LookupSiteType(%s) = %v, %v", name, siteType, err)
+		}
+	}
+
+	_, err := LookupSiteType("joomla")
+	if err == nil || !strings.Contains(err.Error(), "available: laravel, php, proxy, static, symfony, wordpress") {
+		t.Errorf("LookupSiteType(joomla) error = %v", err)
+	}
+
+	if got := DisplayName(TypeWordPress); got != "WordPress" {
+		t.Errorf("DisplayName(wordpress) = %s", got)
+	}
+	if got := DisplayName("joomla"); got != "joomla" {
+		t.Errorf("DisplayName of an unknown type = %s, want the stored name", got)
+	}
+}
+
+func TestRegisterSiteTypeTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a site type twice did not panic")
+		}
+	}()
+	RegisterSiteType(phpSiteType{})
+}
+
+func TestRegisteredSiteTypeHooks(t *testing.T) {
+	var calls []string
+	registerTestSiteType(t, recordingSiteType{calls: &calls})
+
+	sm, _ := newTestManager(t)
+	result, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com", Type: "recording"})
+	if err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	if result.Site.Type != "recording" || result.Site.MaxUpload != "1M" {
+		t.Errorf("site type = %s, max upload = %s, want the configured recording site", result.Site.Type, result.Site.MaxUpload)
+	}
+	if _, err := os.Stat(sm.poolConfigFile(&result.Site)); err != nil {
+		t.Errorf("pool of the site type's pool template was not created: %v", err)
+	}
+
+	if err := sm.DeleteSite(&SiteDeleteOptions{Domain: "example.com", Hard: true, Force: true}); err != nil {
+		t.Fatalf("DeleteSite: %v", err)
+	}
+	if want := []string{"configure", "provision", "teardown"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("hooks called = %q, want %q", calls, want)
+	}
+}
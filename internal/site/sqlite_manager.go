@@ -2,56 +2,117 @@ package site
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
-	"text/template"
 
 	"github.com/tankadesign/caddy-site-manager/internal/config"
 	"github.com/tankadesign/caddy-site-manager/internal/database"
 )
 
-// SQLiteSiteManager handles site operations using SQLite database
+// SQLiteSiteManager handles site operations using SQLite database. Progress
+// messages are written to Out and confirmations are read from In.
 type SQLiteSiteManager struct {
-	Config      *config.CaddyConfig
-	DB          *database.DB
-	caddyTmpl   *template.Template
-	wpTmpl      *template.Template
-	phpPoolTmpl *template.Template
+	Config    *config.CaddyConfig
+	DB        *database.DB
+	Runner    CommandRunner
+	Admin     *CaddyAdmin
+	Databases DatabaseProvisioner
+	Out       io.Writer
+	In        io.Reader
+	templates *TemplateStore
 }
 
 // NewSQLiteSiteManager creates a new SQLite-based site manager
 func NewSQLiteSiteManager(cfg *config.CaddyConfig, db *database.DB) (*SQLiteSiteManager, error) {
 	sm := &SQLiteSiteManager{
-		Config: cfg,
-		DB:     db,
+		Config:    cfg,
+		DB:        db,
+		Runner:    ExecRunner{},
+		Admin:     NewCaddyAdmin(cfg.AdminAddress),
+		Databases: NewMySQLProvisioner(cfg),
+		Out:       os.Stdout,
+		In:        os.Stdin,
+		// Templates are loaded on first use, so a broken user template only
+		// affects the sites that use it
+		templates: NewTemplateStore(cfg.Path(cfg.TemplateDir)),
 	}
 
-	// Initialize templates
-	if err := sm.initTemplates(); err != nil {
-		return nil, fmt.Errorf("failed to initialize templates: %v", err)
+	// Services on the host do not read a staged root, so leave them alone
+	if cfg.Root != "" {
+		sm.Runner = NewSandboxRunner(ExecRunner{}, progressWriter{sm}, cfg.Verbose)
+		sm.Databases = sandboxProvisioner{sm}
 	}
 
 	return sm, nil
 }
 
+// progressWriter forwards to the Out writer of a manager, so helpers created
+// by the constructor follow later changes of Out
+type progressWriter struct {
+	sm *SQLiteSiteManager
+}
+
+func (w progressWriter) Write(p []byte) (int, error) {
+	return w.sm.Out.Write(p)
+}
+
 // CreateSite creates a new site using SQLite database
-func (sm *SQLiteSiteManager) CreateSite(opts *SiteCreateOptions) error {
-	// Validate domain
+func (sm *SQLiteSiteManager) CreateSite(opts *SiteCreateOptions) (*CreateResult, error) {
+	// Validate domain. It names files and directories, so it must not be
+	// able to escape them.
+	opts.Domain = strings.ToLower(strings.TrimSpace(opts.Domain))
 	if opts.Domain == "" {
-		return fmt.Errorf("domain is required")
+		return nil, fmt.Errorf("domain is required")
+	}
+	if !hostnamePattern.MatchString(opts.Domain) {
+		return nil, fmt.Errorf("invalid domain: %s", opts.Domain)
 	}
 
 	// Check if site already exists
 	exists, err := sm.DB.SiteExists(opts.Domain)
 	if err != nil {
-		return fmt.Errorf("failed to check site existence: %v", err)
+		return nil, fmt.Errorf("failed to check site existence: %v", err)
 	}
 	if exists {
-		return fmt.Errorf("site '%s' already exists", opts.Domain)
+		return nil, fmt.Errorf("site '%s' already exists", opts.Domain)
+	}
+
+	if opts.Canonical == "" {
+		opts.Canonical = defaultCanonical(opts.Domain)
+	}
+	if err := validateCanonical(opts.Canonical); err != nil {
+		return nil, err
+	}
+
+	if opts.HeaderProfile == "" {
+		opts.HeaderProfile = DefaultHeaderProfile
+	}
+	if err := sm.validateHeaderProfile(opts.HeaderProfile); err != nil {
+		return nil, err
+	}
+
+	// The domain and its www. host must not be served by another site
+	if err := sm.checkHostnameAvailable(opts.Domain); err != nil {
+		return nil, err
+	}
+	if opts.Canonical != database.CanonicalNone {
+		if owner, err := sm.DB.HostnameOwner("www." + opts.Domain); err != nil {
+			return nil, err
+		} else if owner != "" {
+			return nil, fmt.Errorf("hostname www.%s already belongs to %s", opts.Domain, owner)
+		}
 	}
 
 	// Set defaults
+	if opts.Type == "" {
+		opts.Type = DefaultSiteType
+	}
+	siteType, err := LookupSiteType(opts.Type)
+	if err != nil {
+		return nil, err
+	}
 	if opts.PHPVersion == "" {
 		opts.PHPVersion = sm.Config.PHPVersion
 	}
@@ -60,11 +121,14 @@ func (sm *SQLiteSiteManager) CreateSite(opts *SiteCreateOptions) error {
 	}
 
 	// Auto-generate pool name
-	poolName := generatePoolName(opts.Domain)
-	
-	// Auto-generate database credentials if WordPress is enabled
+	var poolName string
+	if siteType.PoolTemplate() != "" {
+		poolName = generatePoolName(opts.Domain)
+	}
+
+	// Auto-generate database credentials if the site type uses a database
 	var dbName, dbUser, dbPassword string
-	if opts.WordPress {
+	if siteType.UsesDatabase() {
 		if opts.DBName == "" {
 			dbName = generateDBName(opts.Domain)
 		} else {
@@ -74,7 +138,7 @@ func (sm *SQLiteSiteManager) CreateSite(opts *SiteCreateOptions) error {
 			var err error
 			dbPassword, err = generateRandomPassword()
 			if err != nil {
-				return fmt.Errorf("failed to generate database password: %v", err)
+				return nil, fmt.Errorf("failed to generate database password: %v", err)
 			}
 		} else {
 			dbPassword = opts.DBPassword
@@ -84,90 +148,194 @@ func (sm *SQLiteSiteManager) CreateSite(opts *SiteCreateOptions) error {
 
 	// Create site record
 	site := &database.Site{
-		Domain:       opts.Domain,
-		DocumentRoot: filepath.Join("/var/www/sites", opts.Domain),
-		PHPVersion:   opts.PHPVersion,
-		IsWordPress:  opts.WordPress,
-		IsEnabled:    false, // Will be enabled after successful creation
-		MaxUpload:    opts.MaxUpload,
-		DBName:       dbName,
-		DBUser:       dbUser,
-		DBPassword:   dbPassword,
-		PoolName:     poolName,
+		Domain:        opts.Domain,
+		DocumentRoot:  filepath.Join(sm.Config.WebRoot, "sites", opts.Domain),
+		PHPVersion:    opts.PHPVersion,
+		Type:          siteType.Name(),
+		IsEnabled:     false, // Will be enabled after successful creation
+		MaxUpload:     opts.MaxUpload,
+		DBName:        dbName,
+		DBUser:        dbUser,
+		DBPassword:    dbPassword,
+		PoolName:      poolName,
+		Canonical:     opts.Canonical,
+		HeaderProfile: opts.HeaderProfile,
+	}
+
+	// Tune the PHP-FPM process manager
+	setDefaultPoolSettings(site)
+	if opts.PM != "" || opts.MaxChildren != 0 {
+		if site.PoolName == "" {
+			return nil, fmt.Errorf("%s sites have no PHP-FPM pool", siteType.DisplayName())
+		}
+		if opts.PM != "" {
+			if err := poolSettings["pm"](site, opts.PM); err != nil {
+				return nil, err
+			}
+		}
+		if opts.MaxChildren != 0 {
+			site.PMMaxChildren = opts.MaxChildren
+		}
+	}
+	if err := validatePoolSettings(site); err != nil {
+		return nil, err
+	}
+
+	// Run the pool and own the files as a dedicated user
+	if opts.Isolate {
+		if site.PoolName == "" {
+			return nil, fmt.Errorf("%s sites have no PHP-FPM pool to isolate", siteType.DisplayName())
+		}
+		site.SystemUser = systemUserName(site.Domain)
+		if err := sm.checkSystemUser(site.SystemUser); err != nil {
+			return nil, err
+		}
+	}
+
+	// Apply the settings specific to the site type
+	if err := siteType.Configure(site, opts); err != nil {
+		return nil, err
+	}
+
+	// Use the selected templates instead of the defaults of the site type
+	if opts.PoolTemplate != "" && site.PoolName == "" {
+		return nil, fmt.Errorf("%s sites have no PHP-FPM pool", siteType.DisplayName())
+	}
+	site.CaddyTemplate = opts.CaddyTemplate
+	site.PoolTemplate = opts.PoolTemplate
+
+	// Load the templates before anything is created, so a broken user
+	// template does not cause a rollback
+	if _, err := sm.caddyTemplate(site); err != nil {
+		return nil, err
+	}
+	if poolTemplate, err := poolTemplateName(site); err != nil {
+		return nil, err
+	} else if poolTemplate != "" {
+		if _, err := sm.templates.LoadKind(poolTemplate, TemplateKindPool); err != nil {
+			return nil, err
+		}
+	}
+
+	// Only set up pools for a PHP-FPM that is installed
+	if site.PoolName != "" {
+		if err := sm.checkPHPFPMInstalled(site.PHPVersion); err != nil {
+			return nil, err
+		}
+		sm.warnPHPEndOfLife(site.PHPVersion)
 	}
 
 	if sm.Config.Verbose {
-		fmt.Printf("Setting up %s site for domain: %s\n", 
-			map[bool]string{true: "WordPress", false: "PHP"}[opts.WordPress], 
-			opts.Domain)
-		if opts.WordPress {
-			fmt.Printf("Database name: %s\n", dbName)
-			fmt.Printf("Database user: %s\n", dbUser)
+		fmt.Fprintf(sm.Out, "Setting up %s site for domain: %s\n", siteType.DisplayName(), opts.Domain)
+		if siteType.UsesDatabase() {
+			fmt.Fprintf(sm.Out, "Database name: %s\n", dbName)
+			fmt.Fprintf(sm.Out, "Database user: %s\n", dbUser)
+		}
+		if poolName != "" {
+			fmt.Fprintf(sm.Out, "PHP-FPM Pool: %s\n", poolName)
 		}
-		fmt.Printf("PHP-FPM Pool: %s\n", poolName)
-		fmt.Printf("Max upload size: %s\n", opts.MaxUpload)
+		fmt.Fprintf(sm.Out, "Max upload size: %s\n", opts.MaxUpload)
 	}
 
 	// Check for conflicts (directories, files)
 	if err := sm.checkPhysicalConflicts(site); err != nil {
-		return err
+		return nil, err
 	}
 
-	// Create custom PHP-FPM pool
-	if err := sm.createPHPFPMPool(site); err != nil {
-		return fmt.Errorf("failed to create PHP-FPM pool: %v", err)
+	// Every step from here on is journaled so that a failure rolls back
+	// everything that was already done
+	j := sm.newJournal()
+	if err := sm.provisionSite(site, siteType, j); err != nil {
+		if rbErr := j.rollback(); rbErr != nil {
+			return nil, fmt.Errorf("%v (%v)", err, rbErr)
+		}
+		return nil, err
 	}
 
-	// Restart PHP-FPM
-	if err := sm.restartPHPFPM(site.PHPVersion); err != nil {
-		return fmt.Errorf("failed to restart PHP-FPM: %v", err)
+	result := &CreateResult{
+		Site:       *site,
+		ConfigFile: sm.siteConfigFile(site.Domain),
+		Symlink:    sm.siteSymlink(site.Domain),
+		NextSteps:  siteType.NextSteps(site),
+	}
+	if site.PoolName != "" {
+		result.PoolConfigFile = sm.poolConfigFile(site)
+		result.PoolSocket = poolSocket(site)
+		result.PHPSettings = defaultPHPSettings(site)
 	}
+	return result, nil
+}
 
-	// Create site directory
-	if err := sm.createSiteDirectory(site); err != nil {
-		return fmt.Errorf("failed to create site directory: %v", err)
+// provisionSite performs the site creation steps. The undo action of each
+// step is recorded before the step runs, so it must also cope with a step
+// that only partially completed.
+func (sm *SQLiteSiteManager) provisionSite(site *database.Site, siteType SiteType, j *journal) error {
+	poolTemplate, err := poolTemplateName(site)
+	if err != nil {
+		return err
+	}
+
+	// Create the system user of an isolated site before its pool
+	if site.SystemUser != "" {
+		if err := sm.createSystemUser(site); err != nil {
+			return err
+		}
+		j.record("system user "+site.SystemUser, func() error {
+			return sm.removeSystemUser(site)
+		})
 	}
 
-	// Create site content
-	if site.IsWordPress {
-		if err := sm.createWordPressSite(site); err != nil {
-			return fmt.Errorf("failed to create WordPress site: %v", err)
+	// Create custom PHP-FPM pool
+	if poolTemplate != "" {
+		restorePool, err := snapshotFile(sm.poolConfigFile(site))
+		if err != nil {
+			return fmt.Errorf("failed to inspect PHP-FPM pool: %v", err)
+		}
+		j.record("PHP-FPM pool "+site.PoolName, func() error {
+			if err := restorePool(); err != nil {
+				return err
+			}
+			return sm.restartPHPFPM(site.PHPVersion)
+		})
+		if err := sm.createPHPFPMPool(site, poolTemplate); err != nil {
+			return fmt.Errorf("failed to create PHP-FPM pool: %v", err)
 		}
-	} else {
-		if err := sm.createBasicPHPSite(site); err != nil {
-			return fmt.Errorf("failed to create basic PHP site: %v", err)
+
+		// Restart PHP-FPM
+		if err := sm.restartPHPFPM(site.PHPVersion); err != nil {
+			return fmt.Errorf("failed to restart PHP-FPM: %v", err)
 		}
 	}
 
-	// Set permissions
-	if err := sm.setPermissions(site); err != nil {
-		return fmt.Errorf("failed to set permissions: %v", err)
+	// Create the document root and content
+	if err := siteType.Provision(sm, site, j); err != nil {
+		return err
 	}
 
-	// Generate Caddy configuration
-	configFile := filepath.Join(sm.Config.AvailableSites, opts.Domain)
-	if err := sm.generateCaddyConfig(site, configFile); err != nil {
+	// Generate Caddy configuration and enable the site
+	j.record("Caddy config "+site.Domain, func() error {
+		if err := sm.removeSymlink(sm.siteSymlink(site.Domain)); err != nil {
+			return err
+		}
+		return sm.removeFile(sm.siteConfigFile(site.Domain), "config file")
+	})
+	if err := sm.generateCaddyConfig(site); err != nil {
 		return fmt.Errorf("failed to generate Caddy config: %v", err)
 	}
 
 	// Store site in database
+	j.record("database record "+site.Domain, func() error {
+		return sm.DB.DeleteSite(site.Domain)
+	})
 	if err := sm.DB.CreateSite(site); err != nil {
 		return fmt.Errorf("failed to store site in database: %v", err)
 	}
 
-	// Enable the site
-	if err := sm.EnableSite(opts.Domain); err != nil {
-		return fmt.Errorf("failed to enable site: %v", err)
-	}
-
-	// Validate and reload Caddy
-	if err := sm.validateAndReloadCaddy(); err != nil {
+	// Reload Caddy
+	if err := sm.reloadCaddy(); err != nil {
 		return fmt.Errorf("failed to reload Caddy: %v", err)
 	}
 
-	// Print success message
-	sm.printSuccessMessage(site)
-
 	return nil
 }
 
@@ -192,7 +360,7 @@ func (sm *SQLiteSiteManager) DeleteSite(opts *SiteDeleteOptions) error {
 // EnableSite enables a site by creating a symlink and updating database
 func (sm *SQLiteSiteManager) EnableSite(domain string) error {
 	if sm.Config.Verbose {
-		fmt.Printf("Enabling site: %s\n", domain)
+		fmt.Fprintf(sm.Out, "Enabling site: %s\n", domain)
 	}
 
 	// Get site from database
@@ -203,18 +371,19 @@ func (sm *SQLiteSiteManager) EnableSite(domain string) error {
 
 	if site.IsEnabled && !sm.Config.DryRun {
 		if sm.Config.Verbose {
-			fmt.Printf("Site %s is already enabled\n", domain)
+			fmt.Fprintf(sm.Out, "Site %s is already enabled\n", domain)
 		}
 		return nil
 	}
 
-	configFile := filepath.Join(sm.Config.AvailableSites, domain)
-	symlinkPath := filepath.Join(sm.Config.EnabledSites, domain)
+	linkTarget := sm.siteLinkTarget(domain)
+	configFile := sm.siteConfigFile(domain)
+	symlinkPath := sm.siteSymlink(domain)
 
 	if sm.Config.DryRun {
 		if sm.Config.Verbose {
-			fmt.Printf("Would create symlink: %s -> %s\n", symlinkPath, configFile)
-			fmt.Printf("Would update database to set site as enabled\n")
+			fmt.Fprintf(sm.Out, "Would create symlink: %s -> %s\n", symlinkPath, linkTarget)
+			fmt.Fprintf(sm.Out, "Would update database to set site as enabled\n")
 		}
 		return nil
 	}
@@ -224,8 +393,12 @@ func (sm *SQLiteSiteManager) EnableSite(domain string) error {
 		return fmt.Errorf("site configuration not found: %s", domain)
 	}
 
-	// Create symlink
-	if err := os.Symlink(configFile, symlinkPath); err != nil {
+	// Create symlink once Caddy accepted the config with the site
+	change := linkConfigFile(symlinkPath, linkTarget)
+	if err := sm.validateConfigChanges(change); err != nil {
+		return fmt.Errorf("failed to create symlink: %v", err)
+	}
+	if _, err := sm.applyConfigChanges(change); err != nil {
 		return fmt.Errorf("failed to create symlink: %v", err)
 	}
 
@@ -236,7 +409,7 @@ func (sm *SQLiteSiteManager) EnableSite(domain string) error {
 	}
 
 	if sm.Config.Verbose {
-		fmt.Printf("Site %s enabled successfully\n", domain)
+		fmt.Fprintf(sm.Out, "Site %s enabled successfully\n", domain)
 	}
 
 	return nil
@@ -245,7 +418,7 @@ func (sm *SQLiteSiteManager) EnableSite(domain string) error {
 // DisableSite disables a site by removing the symlink and updating database
 func (sm *SQLiteSiteManager) DisableSite(domain string) error {
 	if sm.Config.Verbose {
-		fmt.Printf("Disabling site: %s\n", domain)
+		fmt.Fprintf(sm.Out, "Disabling site: %s\n", domain)
 	}
 
 	// Get site from database
@@ -258,18 +431,22 @@ func (sm *SQLiteSiteManager) DisableSite(domain string) error {
 		return fmt.Errorf("site %s is not enabled", domain)
 	}
 
-	symlinkPath := filepath.Join(sm.Config.EnabledSites, domain)
+	symlinkPath := sm.siteSymlink(domain)
 
 	if sm.Config.DryRun {
 		if sm.Config.Verbose {
-			fmt.Printf("Would remove symlink: %s\n", symlinkPath)
-			fmt.Printf("Would update database to set site as disabled\n")
+			fmt.Fprintf(sm.Out, "Would remove symlink: %s\n", symlinkPath)
+			fmt.Fprintf(sm.Out, "Would update database to set site as disabled\n")
 		}
 		return nil
 	}
 
-	// Remove symlink
-	if err := os.Remove(symlinkPath); err != nil && !os.IsNotExist(err) {
+	// Remove symlink once Caddy accepted the config without the site
+	change := removeConfigFile(symlinkPath)
+	if err := sm.validateConfigChanges(change); err != nil {
+		return fmt.Errorf("failed to remove symlink: %v", err)
+	}
+	if _, err := sm.applyConfigChanges(change); err != nil {
 		return fmt.Errorf("failed to remove symlink: %v", err)
 	}
 
@@ -280,54 +457,31 @@ func (sm *SQLiteSiteManager) DisableSite(domain string) error {
 	}
 
 	if sm.Config.Verbose {
-		fmt.Printf("Site %s disabled successfully\n", domain)
+		fmt.Fprintf(sm.Out, "Site %s disabled successfully\n", domain)
 	}
 
 	return nil
 }
 
-// ListSites lists all sites from the database
-func (sm *SQLiteSiteManager) ListSites() error {
-	allSites, err := sm.DB.ListSites(nil)
+// ListSites returns all sites from the database
+func (sm *SQLiteSiteManager) ListSites() ([]database.Site, error) {
+	sites, err := sm.DB.ListSites(nil)
 	if err != nil {
-		return fmt.Errorf("failed to list sites: %v", err)
-	}
-
-	enabledTrue := true
-	enabledSites, err := sm.DB.ListSites(&enabledTrue)
-	if err != nil {
-		return fmt.Errorf("failed to list enabled sites: %v", err)
-	}
-
-	fmt.Println("Available sites:")
-	for _, site := range allSites {
-		status := "disabled"
-		if site.IsEnabled {
-			status = "enabled"
-		}
-		siteType := "PHP"
-		if site.IsWordPress {
-			siteType = "WordPress"
-		}
-		fmt.Printf("  %s (%s, %s)\n", site.Domain, siteType, status)
-	}
-
-	fmt.Println("\nEnabled sites:")
-	for _, site := range enabledSites {
-		siteType := "PHP"
-		if site.IsWordPress {
-			siteType = "WordPress"
-		}
-		fmt.Printf("  %s (%s)\n", site.Domain, siteType)
+		return nil, fmt.Errorf("failed to list sites: %v", err)
 	}
+	return sites, nil
+}
 
-	return nil
+// ShowSite returns everything known about a site, including whether its
+// files on the host exist and match the database
+func (sm *SQLiteSiteManager) ShowSite(domain string) (*SiteDetail, error) {
+	return sm.inspectSite(domain)
 }
 
 // AddBasicAuth adds basic authentication using SQLite database
 func (sm *SQLiteSiteManager) AddBasicAuth(domain, path, username, password string) error {
 	if sm.Config.Verbose {
-		fmt.Printf("Adding basic auth for %s to path %s\n", domain, path)
+		fmt.Fprintf(sm.Out, "Adding basic auth for %s to path %s\n", domain, path)
 	}
 
 	// Validate inputs
@@ -348,11 +502,11 @@ func (sm *SQLiteSiteManager) AddBasicAuth(domain, path, username, password strin
 
 	if sm.Config.DryRun {
 		if sm.Config.Verbose {
-			fmt.Printf("Would add basic auth:\n")
-			fmt.Printf("  Domain: %s\n", domain)
-			fmt.Printf("  Path: %s\n", path)
-			fmt.Printf("  Username: %s\n", username)
-			fmt.Printf("  Password: %s\n", password)
+			fmt.Fprintf(sm.Out, "Would add basic auth:\n")
+			fmt.Fprintf(sm.Out, "  Domain: %s\n", domain)
+			fmt.Fprintf(sm.Out, "  Path: %s\n", path)
+			fmt.Fprintf(sm.Out, "  Username: %s\n", username)
+			fmt.Fprintf(sm.Out, "  Password: %s\n", password)
 		}
 		return nil
 	}
@@ -375,25 +529,16 @@ func (sm *SQLiteSiteManager) AddBasicAuth(domain, path, username, password strin
 		return fmt.Errorf("failed to store basic auth in database: %v", err)
 	}
 
-	// Regenerate Caddy configuration
-	configFile := filepath.Join(sm.Config.AvailableSites, domain)
-	if err := sm.regenerateCaddyConfig(site.ID, configFile); err != nil {
-		return fmt.Errorf("failed to regenerate Caddy config: %v", err)
-	}
-
-	// Reload Caddy
-	if err := sm.reloadCaddy(); err != nil {
-		return fmt.Errorf("failed to reload Caddy: %v", err)
-	}
-
-	fmt.Printf("Basic auth added for %s at path %s\n", domain, path)
-	return nil
+	// Regenerate Caddy configuration and reload Caddy
+	return sm.updateSiteConfig(site, func() error {
+		return sm.DB.DeleteBasicAuth(site.ID, path, username)
+	})
 }
 
 // RemoveBasicAuth removes basic authentication using SQLite database
 func (sm *SQLiteSiteManager) RemoveBasicAuth(domain, path string) error {
 	if sm.Config.Verbose {
-		fmt.Printf("Removing basic auth for %s from path %s\n", domain, path)
+		fmt.Fprintf(sm.Out, "Removing basic auth for %s from path %s\n", domain, path)
 	}
 
 	// Ensure path starts with /
@@ -409,66 +554,48 @@ func (sm *SQLiteSiteManager) RemoveBasicAuth(domain, path string) error {
 
 	if sm.Config.DryRun {
 		if sm.Config.Verbose {
-			fmt.Printf("Would remove basic auth from path: %s\n", path)
+			fmt.Fprintf(sm.Out, "Would remove basic auth from path: %s\n", path)
 		}
 		return nil
 	}
 
+	auths, err := sm.DB.GetBasicAuths(site.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get basic auths: %v", err)
+	}
+
 	// Remove basic auth records for this path
 	if err := sm.DB.DeleteBasicAuthsForPath(site.ID, path); err != nil {
 		return fmt.Errorf("failed to remove basic auth from database: %v", err)
 	}
 
-	// Regenerate Caddy configuration
-	configFile := filepath.Join(sm.Config.AvailableSites, domain)
-	if err := sm.regenerateCaddyConfig(site.ID, configFile); err != nil {
-		return fmt.Errorf("failed to regenerate Caddy config: %v", err)
-	}
-
-	// Reload Caddy
-	if err := sm.reloadCaddy(); err != nil {
-		return fmt.Errorf("failed to reload Caddy: %v", err)
-	}
-
-	fmt.Printf("Basic auth removed for %s from path %s\n", domain, path)
-	return nil
+	// Regenerate Caddy configuration and reload Caddy
+	return sm.updateSiteConfig(site, func() error {
+		for _, auth := range auths {
+			if auth.Path != path {
+				continue
+			}
+			if err := sm.DB.CreateBasicAuth(&auth); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-// ListBasicAuth lists all basic authentication configurations for a site
-func (sm *SQLiteSiteManager) ListBasicAuth(domain string) error {
-	// Get site with auth from database
+// ListBasicAuth returns a site together with its basic authentication entries
+func (sm *SQLiteSiteManager) ListBasicAuth(domain string) (*database.SiteWithAuth, error) {
 	siteWithAuth, err := sm.DB.GetSiteWithAuth(domain)
 	if err != nil {
-		return fmt.Errorf("site not found: %v", err)
-	}
-
-	if len(siteWithAuth.BasicAuths) == 0 {
-		fmt.Printf("No basic authentication configured for %s\n", domain)
-		return nil
-	}
-
-	fmt.Printf("Basic authentication for %s:\n", domain)
-	
-	// Group auths by path for cleaner output
-	pathAuths := make(map[string][]string)
-	for _, auth := range siteWithAuth.BasicAuths {
-		pathAuths[auth.Path] = append(pathAuths[auth.Path], auth.Username)
-	}
-
-	// Display each path and its users
-	for path, usernames := range pathAuths {
-		for _, username := range usernames {
-			fmt.Printf("%s - %s\n", path, username)
-		}
+		return nil, fmt.Errorf("site not found: %v", err)
 	}
-
-	return nil
+	return siteWithAuth, nil
 }
 
 // ModifyMaxUpload changes the maximum upload size using SQLite database
 func (sm *SQLiteSiteManager) ModifyMaxUpload(domain, newSize string) error {
 	if sm.Config.Verbose {
-		fmt.Printf("Modifying max upload size for %s to %s\n", domain, newSize)
+		fmt.Fprintf(sm.Out, "Modifying max upload size for %s to %s\n", domain, newSize)
 	}
 
 	// Validate size format
@@ -484,43 +611,44 @@ func (sm *SQLiteSiteManager) ModifyMaxUpload(domain, newSize string) error {
 
 	if sm.Config.DryRun {
 		if sm.Config.Verbose {
-			fmt.Printf("Would modify max upload size:\n")
-			fmt.Printf("  Domain: %s\n", domain)
-			fmt.Printf("  New size: %s\n", newSize)
-			fmt.Printf("  PHP-FPM pool: %s\n", site.PoolName)
+			fmt.Fprintf(sm.Out, "Would modify max upload size:\n")
+			fmt.Fprintf(sm.Out, "  Domain: %s\n", domain)
+			fmt.Fprintf(sm.Out, "  New size: %s\n", newSize)
+			if site.PoolName != "" {
+				fmt.Fprintf(sm.Out, "  PHP-FPM pool: %s\n", site.PoolName)
+			}
 		}
 		return nil
 	}
 
 	// Update site in database
+	previous := *site
 	site.MaxUpload = newSize
 	if err := sm.DB.UpdateSite(site); err != nil {
 		return fmt.Errorf("failed to update site in database: %v", err)
 	}
-
-	// Update PHP-FPM pool configuration
-	if err := sm.updatePHPPoolUploadSize(site, newSize); err != nil {
-		return fmt.Errorf("failed to update PHP pool: %v", err)
-	}
-
-	// Regenerate Caddy configuration
-	configFile := filepath.Join(sm.Config.AvailableSites, domain)
-	if err := sm.regenerateCaddyConfig(site.ID, configFile); err != nil {
-		return fmt.Errorf("failed to regenerate Caddy config: %v", err)
-	}
-
-	// Restart PHP-FPM
-	if err := sm.restartPHPFPM(site.PHPVersion); err != nil {
-		return fmt.Errorf("failed to restart PHP-FPM: %v", err)
+	revert := func() error {
+		return sm.DB.UpdateSite(&previous)
 	}
 
-	// Reload Caddy
-	if err := sm.reloadCaddy(); err != nil {
-		return fmt.Errorf("failed to reload Caddy: %v", err)
+	// Re-render the PHP-FPM pool, whose upload limits follow the site
+	if site.PoolName != "" {
+		if err := sm.updatePool(site, revert); err != nil {
+			return err
+		}
 	}
 
-	fmt.Printf("Max upload size updated to %s for %s\n", newSize, domain)
-	return nil
+	// Regenerate Caddy configuration and reload Caddy. If Caddy rejects
+	// it, the pool goes back to the previous limits as well.
+	return sm.updateSiteConfig(site, func() error {
+		if err := revert(); err != nil {
+			return err
+		}
+		if previous.PoolName == "" {
+			return nil
+		}
+		return sm.updatePool(&previous, func() error { return nil })
+	})
 }
 
 // Helper methods (implementing the rest of the functionality from the original manager)
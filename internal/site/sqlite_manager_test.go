@@ -0,0 +1,362 @@
+package site
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tankadesign/caddy-site-manager/internal/config"
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+// newTestManager creates a manager that stages every path below a temporary
+// root and records commands instead of running them
+func newTestManager(t *testing.T) (*SQLiteSiteManager, *RecordingRunner) {
+	t.Helper()
+
+	cfg := config.NewCaddyConfig("/etc/caddy")
+	cfg.Root = t.TempDir()
+	cfg.PHPVersion = "8.3"
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	caddyfile := []byte("{\n\temail admin@example.com\n}\n\nimport enabled-sites/*\n")
+	if err := os.WriteFile(cfg.Path(cfg.CaddyFile), caddyfile, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	db, err := OpenDatabase(cfg, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	sm, err := NewSQLiteSiteManager(cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := NewRecordingRunner()
+	sm.Runner = runner
+	sm.Out = out
+	return sm, runner
+}
+
+// commandLines returns the recorded commands with the path of the staged
+// Caddyfile, which changes on every run, replaced by a placeholder
+func commandLines(runner *RecordingRunner) []string {
+	var lines []string
+	for _, cmd := range runner.Commands() {
+		if cmd.Name == "caddy" && len(cmd.Args) > 2 && cmd.Args[0] == "validate" {
+			cmd.Args = append([]string{"validate", "--config", "<staged Caddyfile>"}, cmd.Args[3:]...)
+		}
+		lines = append(lines, cmd.String())
+	}
+	return lines
+}
+
+func TestCreateAndDeleteSiteCommands(t *testing.T) {
+	sm, runner := newTestManager(t)
+	root := sm.Config.Root
+
+	if _, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com"}); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+
+	siteDir := filepath.Join(root, "/var/www/sites/example.com")
+	want := []string{
+		"chown www-data:www-data " + filepath.Join(root, "/var/log/php"),
+		"systemctl restart php8.3-fpm",
+		"chown -R ubuntu:www-data " + siteDir,
+		"find " + siteDir + " -type d -exec chmod 755 {} +",
+		"find " + siteDir + " -type f -exec chmod 644 {} +",
+		"caddy validate --config <staged Caddyfile> --adapter caddyfile",
+		"systemctl reload caddy",
+	}
+	if got := commandLines(runner); !reflect.DeepEqual(got, want) {
+		t.Fatalf("create commands:\n got %q\nwant %q", got, want)
+	}
+
+	for _, path := range []string{
+		filepath.Join(root, "/etc/caddy/available-sites/example.com"),
+		filepath.Join(root, "/etc/caddy/enabled-sites/example.com"),
+		filepath.Join(root, "/etc/php/8.3/fpm/pool.d/example_com.conf"),
+		filepath.Join(siteDir, "index.php"),
+	} {
+		if _, err := os.Lstat(path); err != nil {
+			t.Errorf("CreateSite did not create %s: %v", path, err)
+		}
+	}
+
+	runner.Reset()
+	if err := sm.DeleteSite(&SiteDeleteOptions{Domain: "example.com", Hard: true, Force: true}); err != nil {
+		t.Fatalf("DeleteSite: %v", err)
+	}
+
+	want = []string{
+		"caddy validate --config <staged Caddyfile> --adapter caddyfile",
+		"systemctl restart php8.3-fpm",
+		"systemctl reload caddy",
+	}
+	if got := commandLines(runner); !reflect.DeepEqual(got, want) {
+		t.Fatalf("delete commands:\n got %q\nwant %q", got, want)
+	}
+	if _, err := os.Stat(siteDir); !os.IsNotExist(err) {
+		t.Errorf("DeleteSite left %s behind", siteDir)
+	}
+}
+
+func TestCreateSiteRollback(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(sm *SQLiteSiteManager, runner *RecordingRunner, databases *fakeProvisioner)
+		want  string
+	}{
+		{
+			name: "PHP-FPM fails to load the pool",
+			setup: func(sm *SQLiteSiteManager, runner *RecordingRunner, databases *fakeProvisioner) {
+				pool := sm.poolConfigFile(&database.Site{PHPVersion: "8.3", PoolName: "example_com"})
+				sm.Runner = brokenConfigRunner{RecordingRunner: runner, command: "systemctl restart php8.3-fpm", broken: func() bool {
+					_, err := os.Stat(pool)
+					return err == nil
+				}}
+			},
+			want: "failed to restart PHP-FPM",
+		},
+		{
+			name: "database cannot be created",
+			setup: func(sm *SQLiteSiteManager, runner *RecordingRunner, databases *fakeProvisioner) {
+				databases.createErr = errors.New("access denied")
+			},
+			want: "access denied",
+		},
+		{
+			name: "Caddy config is rejected",
+			setup: func(sm *SQLiteSiteManager, runner *RecordingRunner, databases *fakeProvisioner) {
+				if err := os.WriteFile(sm.Config.Path(sm.Config.CaddyFile), []byte("import sites/*\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: "failed to generate Caddy config",
+		},
+		{
+			name: "Caddy fails to reload",
+			setup: func(sm *SQLiteSiteManager, runner *RecordingRunner, databases *fakeProvisioner) {
+				symlink := sm.siteSymlink("example.com")
+				sm.Runner = brokenConfigRunner{RecordingRunner: runner, command: "systemctl reload caddy", broken: func() bool {
+					_, err := os.Lstat(symlink)
+					return err == nil
+				}}
+			},
+			want: "failed to reload Caddy",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm, runner := newTestManager(t)
+			databases := newFakeProvisioner()
+			sm.Databases = databases
+			tt.setup(sm, runner, databases)
+
+			_, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com", Type: "laravel"})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("CreateSite error = %v, want %q", err, tt.want)
+			}
+			if strings.Contains(err.Error(), "rollback") {
+				t.Errorf("rollback failed: %v", err)
+			}
+
+			root := sm.Config.Root
+			for _, path := range []string{
+				filepath.Join(root, "/etc/caddy/available-sites/example.com"),
+				filepath.Join(root, "/etc/caddy/enabled-sites/example.com"),
+				filepath.Join(root, "/etc/php/8.3/fpm/pool.d/example_com.conf"),
+				filepath.Join(root, "/var/www/sites/example.com"),
+			} {
+				if _, err := os.Lstat(path); !os.IsNotExist(err) {
+					t.Errorf("rollback left %s behind", path)
+				}
+			}
+			if exists, err := sm.DB.SiteExists("example.com"); err != nil || exists {
+				t.Errorf("rollback left the database record behind (%v)", err)
+			}
+			if databases.databases["example_com"] || databases.users["example_com"] {
+				t.Errorf("rollback left MySQL database %v, user %v", databases.databases["example_com"], databases.users["example_com"])
+			}
+		})
+	}
+}
+
+func TestCreateSiteRejectsInvalidDomain(t *testing.T) {
+	for _, domain := range []string{"../x", "example.com/../../etc", "exa mple.com", "-example.com", "example..com", ".example.com"} {
+		t.Run(domain, func(t *testing.T) {
+			sm, runner := newTestManager(t)
+			_, err := sm.CreateSite(&SiteCreateOptions{Domain: domain})
+			if err == nil || !strings.Contains(err.Error(), "invalid domain") {
+				t.Fatalf("CreateSite(%q) error = %v", domain, err)
+			}
+			if lines := runner.CommandLines(); len(lines) != 0 {
+				t.Errorf("CreateSite(%q) ran %q", domain, lines)
+			}
+			if entries, _ := os.ReadDir(sm.Config.Path(sm.Config.AvailableSites)); len(entries) != 0 {
+				t.Errorf("CreateSite(%q) wrote a site config", domain)
+			}
+		})
+	}
+
+	// Domains are matched case-insensitively, so they are stored lowercase
+	sm, _ := newTestManager(t)
+	result, err := sm.CreateSite(&SiteCreateOptions{Domain: " Example.COM "})
+	if err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	if result.Site.Domain != "example.com" {
+		t.Errorf("Domain = %q, want example.com", result.Site.Domain)
+	}
+}
+
+func TestCreateSiteBelowRootReferencesHostPaths(t *testing.T) {
+	sm, _ := newTestManager(t)
+	root := sm.Config.Root
+	if _, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com"}); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+
+	// The files are staged below the root ...
+	target, err := os.Readlink(filepath.Join(root, "/etc/caddy/enabled-sites/example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := os.ReadFile(filepath.Join(root, "/etc/php/8.3/fpm/pool.d/example_com.conf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := os.ReadFile(filepath.Join(root, "/etc/caddy/available-sites/example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ... but refer to each other by their paths on the host
+	if target != "/etc/caddy/available-sites/example.com" {
+		t.Errorf("symlink points to %s, want the host path", target)
+	}
+	for name, content := range map[string][]byte{"pool": pool, "Caddy config": config} {
+		if bytes.Contains(content, []byte(root)) {
+			t.Errorf("%s contains the root prefix:\n%s", name, content)
+		}
+		if !bytes.Contains(content, []byte("/run/php/php8.3-fpm-example_com.sock")) {
+			t.Errorf("%s does not use the host socket path:\n%s", name, content)
+		}
+	}
+
+	site, err := sm.DB.GetSite("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if site.DocumentRoot != "/var/www/sites/example.com" {
+		t.Errorf("DocumentRoot = %s, want the host path", site.DocumentRoot)
+	}
+}
+
+// captureStdout returns what f writes to os.Stdout
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	f()
+	w.Close()
+	captured, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(captured)
+}
+
+func TestCreateSiteReturnsResult(t *testing.T) {
+	sm, runner := newTestManager(t)
+	sm.Databases = newFakeProvisioner()
+	sm.Config.Verbose = true
+	out := &bytes.Buffer{}
+	sm.Out = out
+	sm.Runner = NewSandboxRunner(runner, progressWriter{sm}, true)
+
+	var result *CreateResult
+	var err error
+	stdout := captureStdout(t, func() {
+		result, err = sm.CreateSite(&SiteCreateOptions{Domain: "example.com", Type: "laravel"})
+	})
+	if err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+
+	if stdout != "" {
+		t.Errorf("CreateSite wrote to stdout:\n%s", stdout)
+	}
+	for _, progress := range []string{"Setting up Laravel site for domain: example.com", "Sandbox: skipping systemctl reload caddy"} {
+		if !strings.Contains(out.String(), progress) {
+			t.Errorf("progress output does not contain %q:\n%s", progress, out.String())
+		}
+	}
+
+	stored, err := sm.DB.GetSite("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Site.DBPassword == "" || result.Site.DBPassword != stored.DBPassword || result.Site.DBUser != "example_com" {
+		t.Errorf("result credentials = %s/%s, want the stored ones", result.Site.DBUser, result.Site.DBPassword)
+	}
+	if result.ConfigFile != sm.siteConfigFile("example.com") || result.Symlink != sm.siteSymlink("example.com") ||
+		result.PoolConfigFile != sm.poolConfigFile(stored) || result.PoolSocket != poolSocket(stored) {
+		t.Errorf("result paths = %+v", result)
+	}
+	if len(result.PHPSettings) == 0 || len(result.NextSteps) == 0 {
+		t.Errorf("result has %d PHP settings and %d next steps", len(result.PHPSettings), len(result.NextSteps))
+	}
+
+	sites, err := sm.ListSites()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sites) != 1 || sites[0].Domain != "example.com" || !sites[0].IsEnabled {
+		t.Errorf("ListSites() = %+v, want the enabled site", sites)
+	}
+}
+
+func TestCreateSiteAsksThroughInAndOut(t *testing.T) {
+	for answer, wantErr := range map[string]bool{"n\n": true, "yes\n": false} {
+		t.Run(strings.TrimSpace(answer), func(t *testing.T) {
+			sm, _ := newTestManager(t)
+			siteDir := sm.Config.Path("/var/www/sites/example.com")
+			if err := os.MkdirAll(siteDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(siteDir, "old.html"), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			out := &bytes.Buffer{}
+			sm.Out, sm.In = out, strings.NewReader(answer)
+
+			_, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com"})
+			if (err != nil) != wantErr {
+				t.Fatalf("CreateSite error = %v, want error %v", err, wantErr)
+			}
+			if !strings.Contains(out.String(), "Do you want to overwrite? (y/n)") {
+				t.Errorf("the confirmation was not written to Out:\n%s", out.String())
+			}
+			if _, err := os.Stat(filepath.Join(siteDir, "old.html")); os.IsNotExist(err) == wantErr {
+				t.Errorf("old.html exists = %v after answering %q", err == nil, answer)
+			}
+		})
+	}
+}
@@ -5,16 +5,21 @@ import (
 	"encoding/base64"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strings"
-	"text/template"
 
+	"github.com/tankadesign/caddy-site-manager/internal/config"
 	"github.com/tankadesign/caddy-site-manager/internal/database"
 	"github.com/tankadesign/caddy-site-manager/internal/wordpress"
 )
 
+// Host locations managed by PHP-FPM
+const (
+	phpConfigDir = "/etc/php"
+	phpLogDir    = "/var/log/php"
+)
+
 // Utility functions
 
 // generatePoolName generates a PHP-FPM pool name from domain
@@ -47,187 +52,76 @@ func generateRandomPassword() (string, error) {
 }
 
 // confirmDeletion prompts the user for confirmation
-func confirmDeletion() bool {
-	fmt.Print("Are you sure you want to proceed? (y/N): ")
+func (sm *SQLiteSiteManager) confirmDeletion() bool {
+	fmt.Fprint(sm.Out, "Are you sure you want to proceed? (y/N): ")
 	var response string
-	fmt.Scanln(&response)
+	fmt.Fscanln(sm.In, &response)
 	response = strings.ToLower(strings.TrimSpace(response))
 	return response == "y" || response == "yes"
 }
 
-// SQLite operations for the SQLiteSiteManager
+// Path helpers. These return the paths used for file operations, i.e. with
+// the configured root prefix applied.
 
-// initTemplates initializes the configuration templates
-func (sm *SQLiteSiteManager) initTemplates() error {
-	// PHP-FPM pool template
-	phpPoolTemplate := `[{{.PoolName}}]
-user = www-data
-group = www-data
-listen = /run/php/php{{.PHPVersion}}-fpm-{{.PoolName}}.sock
-listen.owner = www-data
-listen.group = www-data
-listen.mode = 0660
-
-; Process manager settings optimized for PHP
-pm = dynamic
-pm.max_children = 10
-pm.start_servers = 3
-pm.min_spare_servers = 2
-pm.max_spare_servers = 5
-pm.max_requests = 1000
-
-; PHP settings with configurable upload size
-php_admin_value[upload_max_filesize] = {{.MaxUpload}}
-php_admin_value[post_max_size] = {{.MaxUpload}}
-php_admin_value[max_execution_time] = 300
-php_admin_value[max_input_time] = 300
-php_admin_value[memory_limit] = 512M
-php_admin_value[max_file_uploads] = 50
-
-; General PHP optimizations
-php_admin_value[max_input_vars] = 5000
-php_admin_value[max_input_nesting_level] = 64
-
-; Security settings
-php_admin_flag[allow_url_fopen] = on
-php_admin_flag[allow_url_include] = off
-php_admin_flag[expose_php] = off
-
-; Error handling
-php_admin_flag[display_errors] = off
-php_admin_flag[log_errors] = on
-php_admin_value[error_log] = /var/log/php/{{.PoolName}}-error.log
-
-; Session settings
-php_admin_value[session.save_path] = /var/lib/php/sessions
-php_admin_flag[session.cookie_httponly] = on
-
-; OPcache settings for better performance
-php_admin_flag[opcache.enable] = on
-php_admin_value[opcache.memory_consumption] = 128
-php_admin_value[opcache.interned_strings_buffer] = 8
-php_admin_value[opcache.max_accelerated_files] = 4000
-php_admin_flag[opcache.validate_timestamps] = on
-php_admin_value[opcache.revalidate_freq] = 60
-`
-
-	// Caddy configuration template for basic PHP sites
-	caddyTemplate := `# PHP site: {{.Domain}} (Custom PHP-FPM Pool: {{.PoolName}})
-{{.Domain}} {
-	root * {{.DocumentRoot}}
-	encode gzip
-
-	# Set request body limit to match PHP settings
-	request_body {
-		max_size {{.MaxUpload}}
-	}
-
-	# Enable clean URLs for PHP files (removes .php extension requirement)
-	try_files {path} {path}.php
-
-	# PHP processing using custom PHP pool
-	php_fastcgi unix//run/php/php{{.PHPVersion}}-fpm-{{.PoolName}}.sock {
-		index index.php
-	}
-
-	# Security headers
-	header {
-		# Remove server info
-		-Server
-		
-		# Security headers
-		X-Content-Type-Options nosniff
-		X-XSS-Protection "1; mode=block"
-		Referrer-Policy strict-origin-when-cross-origin
-	}
-
-	# File server for static files
-	file_server
+// siteConfigFile returns the path of a site's config in available-sites
+func (sm *SQLiteSiteManager) siteConfigFile(domain string) string {
+	return sm.Config.Path(filepath.Join(sm.Config.AvailableSites, domain))
 }
 
-www.{{.Domain}} {
-	redir https://{{.Domain}}{uri}
+// siteSymlink returns the path of a site's symlink in enabled-sites
+func (sm *SQLiteSiteManager) siteSymlink(domain string) string {
+	return sm.Config.Path(filepath.Join(sm.Config.EnabledSites, domain))
 }
-`
-
-	// WordPress specific template
-	wpTemplate := `# WordPress site: {{.Domain}} (Custom PHP-FPM Pool: {{.PoolName}})
-{{.Domain}} {
-	root * {{.DocumentRoot}}
-	encode gzip
-
-	# Set request body limit to match PHP settings
-	request_body {
-		max_size {{.MaxUpload}}
-	}
-
-	# PHP processing using custom PHP pool
-	php_fastcgi unix//run/php/php{{.PHPVersion}}-fpm-{{.PoolName}}.sock {
-		index index.php
-	}
-
-	# WordPress pretty permalinks
-	try_files {path} {path}/ /index.php?{query}
-
-	# Security headers
-	header {
-		# Remove server info
-		-Server
-		-X-Powered-By
-		
-		# Security headers
-		X-Content-Type-Options nosniff
-		X-XSS-Protection "1; mode=block"
-		Referrer-Policy strict-origin-when-cross-origin
-	}
 
-	# File server for other static files
-	file_server
+// siteLinkTarget returns the target of a site's symlink in enabled-sites. It
+// is the host path so the link stays valid when a staged root is deployed.
+func (sm *SQLiteSiteManager) siteLinkTarget(domain string) string {
+	return filepath.Join(sm.Config.AvailableSites, domain)
 }
 
-www.{{.Domain}} {
-	redir https://{{.Domain}}{uri}
+// siteDirectory returns the path of a site's document root
+func (sm *SQLiteSiteManager) siteDirectory(site *database.Site) string {
+	return sm.Config.Path(site.DocumentRoot)
 }
-`
 
-	var err error
-	sm.phpPoolTmpl, err = template.New("phppool").Parse(phpPoolTemplate)
-	if err != nil {
-		return err
-	}
-
-	sm.caddyTmpl, err = template.New("caddy").Parse(caddyTemplate)
-	if err != nil {
-		return err
-	}
+// poolConfigFile returns the path of a site's PHP-FPM pool configuration
+func (sm *SQLiteSiteManager) poolConfigFile(site *database.Site) string {
+	return sm.Config.Path(filepath.Join(phpConfigDir, site.PHPVersion, "fpm", "pool.d", site.PoolName+".conf"))
+}
 
-	sm.wpTmpl, err = template.New("wordpress").Parse(wpTemplate)
-	if err != nil {
-		return err
-	}
+// poolLogDir returns the path of the PHP-FPM pool log directory
+func (sm *SQLiteSiteManager) poolLogDir() string {
+	return sm.Config.Path(phpLogDir)
+}
 
-	return nil
+// poolLogFile returns the path of a site's PHP-FPM pool error log
+func (sm *SQLiteSiteManager) poolLogFile(site *database.Site) string {
+	return filepath.Join(sm.poolLogDir(), site.PoolName+"-error.log")
 }
 
+// SQLite operations for the SQLiteSiteManager
+
 // checkPhysicalConflicts checks for existing file system conflicts
 func (sm *SQLiteSiteManager) checkPhysicalConflicts(site *database.Site) error {
+	siteDir := sm.siteDirectory(site)
+
 	// Check if site directory already exists
-	if _, err := os.Stat(site.DocumentRoot); err == nil {
+	if _, err := os.Stat(siteDir); err == nil && site.DocumentRoot != "" {
 		if !sm.Config.DryRun {
-			if !sm.confirmOverwrite(fmt.Sprintf("Site directory '%s' already exists", site.DocumentRoot)) {
+			if !sm.confirmOverwrite(fmt.Sprintf("Site directory '%s' already exists", siteDir)) {
 				return fmt.Errorf("aborting site setup")
 			}
 			if sm.Config.Verbose {
-				fmt.Println("Removing existing site directory...")
+				fmt.Fprintln(sm.Out, "Removing existing site directory...")
 			}
-			if err := os.RemoveAll(site.DocumentRoot); err != nil {
+			if err := os.RemoveAll(siteDir); err != nil {
 				return fmt.Errorf("failed to remove existing directory: %v", err)
 			}
 		}
 	}
 
-	configFile := filepath.Join(sm.Config.AvailableSites, site.Domain)
-	
+	configFile := sm.siteConfigFile(site.Domain)
+
 	// Check if config file already exists
 	if _, err := os.Stat(configFile); err == nil {
 		if !sm.Config.DryRun {
@@ -235,16 +129,16 @@ func (sm *SQLiteSiteManager) checkPhysicalConflicts(site *database.Site) error {
 				return fmt.Errorf("aborting site setup")
 			}
 			if sm.Config.Verbose {
-				fmt.Println("Removing existing configuration...")
+				fmt.Fprintln(sm.Out, "Removing existing configuration...")
 			}
 			// Remove both config and symlink
 			os.Remove(configFile)
-			os.Remove(filepath.Join(sm.Config.EnabledSites, site.Domain))
+			os.Remove(sm.siteSymlink(site.Domain))
 		}
 	}
 
-	// For WordPress sites, check database conflicts
-	if site.IsWordPress {
+	// For sites with a database, check database conflicts
+	if site.DBName != "" {
 		if err := sm.checkDatabaseConflicts(site); err != nil {
 			return err
 		}
@@ -260,7 +154,7 @@ func (sm *SQLiteSiteManager) checkDatabaseConflicts(site *database.Site) error {
 	}
 
 	// Check if database exists
-	dbExists, err := sm.databaseExists(site.DBName)
+	dbExists, err := sm.Databases.DatabaseExists(site.DBName)
 	if err != nil {
 		return fmt.Errorf("failed to check database existence: %v", err)
 	}
@@ -270,27 +164,27 @@ func (sm *SQLiteSiteManager) checkDatabaseConflicts(site *database.Site) error {
 			return fmt.Errorf("aborting site setup")
 		}
 		if sm.Config.Verbose {
-			fmt.Println("Dropping existing database...")
+			fmt.Fprintln(sm.Out, "Dropping existing database...")
 		}
-		if err := sm.dropDatabase(site.DBName); err != nil {
+		if err := sm.Databases.DropDatabase(site.DBName); err != nil {
 			return fmt.Errorf("failed to drop existing database: %v", err)
 		}
 	}
 
 	// Check if database user exists
-	userExists, err := sm.databaseUserExists(site.DBUser)
+	userExists, err := sm.Databases.UserExists(site.DBUser)
 	if err != nil {
 		return fmt.Errorf("failed to check database user existence: %v", err)
 	}
 
 	if userExists {
 		if !sm.confirmOverwrite(fmt.Sprintf("Database user '%s' already exists", site.DBUser)) {
-			fmt.Println("Note: Continuing with existing user. Make sure the password is correct.")
+			fmt.Fprintln(sm.Out, "Note: Continuing with existing user. Make sure the password is correct.")
 		} else {
 			if sm.Config.Verbose {
-				fmt.Println("Dropping existing database user...")
+				fmt.Fprintln(sm.Out, "Dropping existing database user...")
 			}
-			if err := sm.dropDatabaseUser(site.DBUser); err != nil {
+			if err := sm.Databases.DropUser(site.DBUser); err != nil {
 				return fmt.Errorf("failed to drop existing database user: %v", err)
 			}
 		}
@@ -300,61 +194,93 @@ func (sm *SQLiteSiteManager) checkDatabaseConflicts(site *database.Site) error {
 }
 
 // createPHPFPMPool creates a custom PHP-FPM pool for the site
-func (sm *SQLiteSiteManager) createPHPFPMPool(site *database.Site) error {
+func (sm *SQLiteSiteManager) createPHPFPMPool(site *database.Site, templateName string) error {
+	tmpl, err := sm.templates.LoadKind(templateName, TemplateKindPool)
+	if err != nil {
+		return err
+	}
+
 	if sm.Config.DryRun {
 		if sm.Config.Verbose {
-			fmt.Printf("Would create PHP-FPM pool: %s\n", site.PoolName)
+			fmt.Fprintf(sm.Out, "Would create PHP-FPM pool: %s\n", site.PoolName)
 		}
 		return nil
 	}
 
-	poolConfigFile := fmt.Sprintf("/etc/php/%s/fpm/pool.d/%s.conf", site.PHPVersion, site.PoolName)
-	
+	poolConfigFile := sm.poolConfigFile(site)
+
 	if sm.Config.Verbose {
-		fmt.Printf("Creating PHP-FPM pool configuration for %s...\n", site.Domain)
+		fmt.Fprintf(sm.Out, "Creating PHP-FPM pool configuration for %s...\n", site.Domain)
 	}
 
 	// Create log directory if it doesn't exist
-	if err := os.MkdirAll("/var/log/php", 0755); err != nil {
+	logDir := sm.poolLogDir()
+	if err := os.MkdirAll(logDir, 0755); err != nil {
 		return fmt.Errorf("failed to create log directory: %v", err)
 	}
 
 	// Execute chown command to set ownership
-	if err := exec.Command("chown", "www-data:www-data", "/var/log/php").Run(); err != nil {
+	if err := sm.Runner.Run("chown", "www-data:www-data", logDir); err != nil {
 		return fmt.Errorf("failed to set log directory ownership: %v", err)
 	}
 
-	// Generate PHP-FPM pool configuration
-	file, err := os.Create(poolConfigFile)
+	// Workers of isolated sites cannot write to the log directory, so
+	// their log file is created for them
+	if site.SystemUser != "" {
+		logFile := sm.poolLogFile(site)
+		f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY, 0640)
+		if err != nil {
+			return fmt.Errorf("failed to create log file: %v", err)
+		}
+		f.Close()
+		if err := sm.Runner.Run("chown", site.SystemUser+":"+site.SystemUser, logFile); err != nil {
+			return fmt.Errorf("failed to set log file ownership: %v", err)
+		}
+	}
+
+	if sm.Config.Root != "" {
+		if err := os.MkdirAll(filepath.Dir(poolConfigFile), 0755); err != nil {
+			return fmt.Errorf("failed to create pool directory: %v", err)
+		}
+	}
+
+	data, err := sm.poolTemplateData(site)
 	if err != nil {
-		return fmt.Errorf("failed to create pool config file: %v", err)
+		return err
 	}
-	defer file.Close()
 
-	return sm.phpPoolTmpl.Execute(file, site)
+	// Generate PHP-FPM pool configuration
+	var pool strings.Builder
+	if err := tmpl.Execute(&pool, data); err != nil {
+		return fmt.Errorf("failed to execute template: %v", err)
+	}
+
+	if err := os.WriteFile(poolConfigFile, []byte(pool.String()), 0644); err != nil {
+		return fmt.Errorf("failed to create pool config file: %v", err)
+	}
+	return nil
 }
 
 // restartPHPFPM restarts PHP-FPM to load the new pool
 func (sm *SQLiteSiteManager) restartPHPFPM(phpVersion string) error {
 	if sm.Config.DryRun {
 		if sm.Config.Verbose {
-			fmt.Printf("Would restart PHP-FPM %s\n", phpVersion)
+			fmt.Fprintf(sm.Out, "Would restart PHP-FPM %s\n", phpVersion)
 		}
 		return nil
 	}
 
 	if sm.Config.Verbose {
-		fmt.Printf("Restarting PHP-FPM to load the new pool...\n")
+		fmt.Fprintf(sm.Out, "Restarting PHP-FPM to load the new pool...\n")
 	}
 
 	serviceName := fmt.Sprintf("php%s-fpm", phpVersion)
-	cmd := exec.Command("systemctl", "restart", serviceName)
-	if err := cmd.Run(); err != nil {
+	if err := sm.Runner.Run("systemctl", "restart", serviceName); err != nil {
 		return fmt.Errorf("failed to restart PHP-FPM: %v", err)
 	}
 
 	if sm.Config.Verbose {
-		fmt.Println("PHP-FPM restarted successfully.")
+		fmt.Fprintln(sm.Out, "PHP-FPM restarted successfully.")
 	}
 
 	return nil
@@ -364,16 +290,16 @@ func (sm *SQLiteSiteManager) restartPHPFPM(phpVersion string) error {
 func (sm *SQLiteSiteManager) createSiteDirectory(site *database.Site) error {
 	if sm.Config.DryRun {
 		if sm.Config.Verbose {
-			fmt.Printf("Would create site directory: %s\n", site.DocumentRoot)
+			fmt.Fprintf(sm.Out, "Would create site directory: %s\n", site.DocumentRoot)
 		}
 		return nil
 	}
 
 	if sm.Config.Verbose {
-		fmt.Println("Creating site directory...")
+		fmt.Fprintln(sm.Out, "Creating site directory...")
 	}
 
-	if err := os.MkdirAll(site.DocumentRoot, 0775); err != nil {
+	if err := os.MkdirAll(sm.siteDirectory(site), 0775); err != nil {
 		return fmt.Errorf("failed to create site directory: %v", err)
 	}
 
@@ -384,13 +310,13 @@ func (sm *SQLiteSiteManager) createSiteDirectory(site *database.Site) error {
 func (sm *SQLiteSiteManager) createBasicPHPSite(site *database.Site) error {
 	if sm.Config.DryRun {
 		if sm.Config.Verbose {
-			fmt.Printf("Would create basic PHP site files in: %s\n", site.DocumentRoot)
+			fmt.Fprintf(sm.Out, "Would create basic PHP site files in: %s\n", site.DocumentRoot)
 		}
 		return nil
 	}
 
 	if sm.Config.Verbose {
-		fmt.Println("Creating basic PHP site structure...")
+		fmt.Fprintln(sm.Out, "Creating basic PHP site structure...")
 	}
 
 	indexContent := fmt.Sprintf(`<?php
@@ -400,64 +326,96 @@ echo "<p>PHP Version: " . phpversion() . "</p>";
 echo "<p>Server Time: " . date('Y-m-d H:i:s') . "</p>";
 ?>`, site.Domain)
 
-	indexFile := filepath.Join(site.DocumentRoot, "index.php")
+	indexFile := filepath.Join(sm.siteDirectory(site), "index.php")
 	if err := os.WriteFile(indexFile, []byte(indexContent), 0644); err != nil {
 		return fmt.Errorf("failed to create index.php: %v", err)
 	}
 
 	if sm.Config.Verbose {
-		fmt.Println("Basic PHP site files created")
+		fmt.Fprintln(sm.Out, "Basic PHP site files created")
+	}
+
+	return nil
+}
+
+// createStaticSite creates a placeholder index.html for a static site
+func (sm *SQLiteSiteManager) createStaticSite(site *database.Site) error {
+	if sm.Config.DryRun {
+		if sm.Config.Verbose {
+			fmt.Fprintf(sm.Out, "Would create static site files in: %s\n", site.DocumentRoot)
+		}
+		return nil
+	}
+
+	if sm.Config.Verbose {
+		fmt.Fprintln(sm.Out, "Creating static site structure...")
+	}
+
+	indexContent := fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%[1]s</title>
+</head>
+<body>
+<h1>Welcome to %[1]s</h1>
+<p>This is a static site.</p>
+</body>
+</html>
+`, site.Domain)
+
+	indexFile := filepath.Join(sm.siteDirectory(site), "index.html")
+	if err := os.WriteFile(indexFile, []byte(indexContent), 0644); err != nil {
+		return fmt.Errorf("failed to create index.html: %v", err)
+	}
+
+	if sm.Config.Verbose {
+		fmt.Fprintln(sm.Out, "Static site files created")
 	}
 
 	return nil
 }
 
 // createWordPressSite creates a WordPress site
-func (sm *SQLiteSiteManager) createWordPressSite(site *database.Site) error {
+func (sm *SQLiteSiteManager) createWordPressSite(site *database.Site, j *journal) error {
 	if sm.Config.DryRun {
 		if sm.Config.Verbose {
-			fmt.Printf("Would create WordPress site in: %s\n", site.DocumentRoot)
+			fmt.Fprintf(sm.Out, "Would create WordPress site in: %s\n", site.DocumentRoot)
 		}
 		return nil
 	}
 
 	if sm.Config.Verbose {
-		fmt.Println("Creating WordPress site...")
+		fmt.Fprintln(sm.Out, "Creating WordPress site...")
 	}
 
 	// Initialize WordPress manager
 	wpManager := wordpress.NewWordPressManager(sm.Config.Verbose, sm.Config.DryRun)
+	wpManager.Out = sm.Out
+	siteDir := sm.siteDirectory(site)
 
 	// Download and extract latest WordPress
-	if err := wpManager.DownloadAndExtract(site.DocumentRoot); err != nil {
-		// Cleanup on error
-		wpManager.CleanupOnError(site.DocumentRoot)
+	if err := wpManager.DownloadAndExtract(siteDir); err != nil {
 		return fmt.Errorf("failed to download and extract WordPress: %v", err)
 	}
 
 	// Create database and user
-	if err := sm.setupWordPressDatabase(site); err != nil {
-		// Cleanup on error
-		wpManager.CleanupOnError(site.DocumentRoot)
+	if err := sm.provisionDatabase(site, j); err != nil {
 		return err
 	}
 
 	// Generate secure wp-config.php with latest best practices
-	if err := wpManager.GenerateSecureConfig(site.DocumentRoot, site.DBName, site.DBUser, site.DBPassword); err != nil {
-		// Cleanup on error
-		wpManager.CleanupOnError(site.DocumentRoot)
+	if err := wpManager.GenerateSecureConfig(siteDir, site.DBName, site.DBUser, site.DBPassword); err != nil {
 		return fmt.Errorf("failed to generate WordPress configuration: %v", err)
 	}
 
 	// Validate WordPress installation
-	if err := wpManager.ValidateWordPressInstallation(site.DocumentRoot); err != nil {
-		// Cleanup on error
-		wpManager.CleanupOnError(site.DocumentRoot)
+	if err := wpManager.ValidateWordPressInstallation(siteDir); err != nil {
 		return fmt.Errorf("WordPress installation validation failed: %v", err)
 	}
 
 	if sm.Config.Verbose {
-		fmt.Println("WordPress installation completed successfully")
+		fmt.Fprintln(sm.Out, "WordPress installation completed successfully")
 	}
 
 	return nil
@@ -467,71 +425,137 @@ func (sm *SQLiteSiteManager) createWordPressSite(site *database.Site) error {
 func (sm *SQLiteSiteManager) setPermissions(site *database.Site) error {
 	if sm.Config.DryRun {
 		if sm.Config.Verbose {
-			fmt.Printf("Would set permissions for: %s\n", site.DocumentRoot)
+			fmt.Fprintf(sm.Out, "Would set permissions for: %s\n", site.DocumentRoot)
 		}
 		return nil
 	}
 
 	if sm.Config.Verbose {
-		fmt.Println("Setting file permissions...")
+		fmt.Fprintln(sm.Out, "Setting file permissions...")
 	}
 
+	siteDir := sm.siteDirectory(site)
+
 	// Set ownership
-	if err := exec.Command("chown", "-R", "ubuntu:www-data", site.DocumentRoot).Run(); err != nil {
+	owner, group := sm.siteOwnership(site)
+	if err := sm.Runner.Run("chown", "-R", owner+":"+group, siteDir); err != nil {
 		return fmt.Errorf("failed to set ownership: %v", err)
 	}
 
+	// Files of isolated sites are not readable by other users
+	dirMode, fileMode := "755", "644"
+	if site.SystemUser != "" {
+		dirMode, fileMode = "750", "640"
+	}
+
 	// Set directory permissions
-	if err := exec.Command("find", site.DocumentRoot, "-type", "d", "-exec", "chmod", "755", "{}", "+").Run(); err != nil {
+	if err := sm.Runner.Run("find", siteDir, "-type", "d", "-exec", "chmod", dirMode, "{}", "+"); err != nil {
 		return fmt.Errorf("failed to set directory permissions: %v", err)
 	}
 
 	// Set file permissions
-	if err := exec.Command("find", site.DocumentRoot, "-type", "f", "-exec", "chmod", "644", "{}", "+").Run(); err != nil {
+	if err := sm.Runner.Run("find", siteDir, "-type", "f", "-exec", "chmod", fileMode, "{}", "+"); err != nil {
 		return fmt.Errorf("failed to set file permissions: %v", err)
 	}
 
 	// Set special permissions for wp-config.php if it exists
-	wpConfigFile := filepath.Join(site.DocumentRoot, "wp-config.php")
+	wpConfigFile := filepath.Join(siteDir, "wp-config.php")
 	if _, err := os.Stat(wpConfigFile); err == nil {
 		if err := os.Chmod(wpConfigFile, 0600); err != nil {
 			return fmt.Errorf("failed to set wp-config.php permissions: %v", err)
 		}
 	}
 
+	// Framework environment files hold credentials but must stay readable
+	// by the PHP-FPM pool through the group
+	for _, name := range []string{".env", ".env.local"} {
+		envFile := filepath.Join(siteDir, name)
+		if _, err := os.Stat(envFile); err == nil {
+			if err := os.Chmod(envFile, 0640); err != nil {
+				return fmt.Errorf("failed to set %s permissions: %v", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// setWritableDirectories makes directories below the site directory writable
+// for the PHP-FPM pool, which runs as the group of the site files. The pools
+// of isolated sites own the files and need no extra permissions.
+func (sm *SQLiteSiteManager) setWritableDirectories(site *database.Site, dirs []string) error {
+	if site.SystemUser != "" {
+		return nil
+	}
+
+	if sm.Config.DryRun {
+		if sm.Config.Verbose {
+			fmt.Fprintf(sm.Out, "Would make writable: %s\n", strings.Join(dirs, ", "))
+		}
+		return nil
+	}
+
+	if sm.Config.Verbose {
+		fmt.Fprintf(sm.Out, "Making writable: %s\n", strings.Join(dirs, ", "))
+	}
+
+	for _, dir := range dirs {
+		path := filepath.Join(sm.siteDirectory(site), dir)
+		if err := sm.Runner.Run("find", path, "-type", "d", "-exec", "chmod", "775", "{}", "+"); err != nil {
+			return fmt.Errorf("failed to set directory permissions for %s: %v", dir, err)
+		}
+		if err := sm.Runner.Run("find", path, "-type", "f", "-exec", "chmod", "664", "{}", "+"); err != nil {
+			return fmt.Errorf("failed to set file permissions for %s: %v", dir, err)
+		}
+	}
+
 	return nil
 }
 
-// generateCaddyConfig generates the Caddy configuration for the site
-func (sm *SQLiteSiteManager) generateCaddyConfig(site *database.Site, configFile string) error {
+// generateCaddyConfig generates the Caddy configuration for a new site and
+// enables it, once Caddy accepted both in a staging copy
+func (sm *SQLiteSiteManager) generateCaddyConfig(site *database.Site) error {
+	configFile := sm.siteConfigFile(site.Domain)
+	symlinkPath := sm.siteSymlink(site.Domain)
+
 	if sm.Config.DryRun {
 		if sm.Config.Verbose {
-			fmt.Printf("Would create Caddy config: %s\n", configFile)
+			fmt.Fprintf(sm.Out, "Would create Caddy config: %s\n", configFile)
+			fmt.Fprintf(sm.Out, "Would create symlink: %s -> %s\n", symlinkPath, sm.siteLinkTarget(site.Domain))
 		}
 		return nil
 	}
 
 	if sm.Config.Verbose {
-		fmt.Printf("Creating Caddy configuration for %s...\n", site.Domain)
+		fmt.Fprintf(sm.Out, "Creating Caddy configuration for %s...\n", site.Domain)
 	}
 
-	file, err := os.Create(configFile)
+	config, err := sm.renderCaddyConfig(site, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create config file: %v", err)
+		return err
 	}
-	defer file.Close()
 
-	var tmpl *template.Template
-	if site.IsWordPress {
-		tmpl = sm.wpTmpl
-	} else {
-		tmpl = sm.caddyTmpl
+	// Caddy is reloaded once the site is stored, and the journal removes
+	// the files again if that fails
+	changes := []configChange{
+		writeConfigFile(configFile, config),
+		linkConfigFile(symlinkPath, sm.siteLinkTarget(site.Domain)),
+	}
+	if err := sm.validateConfigChanges(changes...); err != nil {
+		return err
+	}
+	if _, err := sm.applyConfigChanges(changes...); err != nil {
+		return err
 	}
 
-	return tmpl.Execute(file, site)
+	// The hash and state are stored with the new site record
+	site.ConfigHash = configHash(config)
+	site.IsEnabled = true
+	return nil
 }
 
-// regenerateCaddyConfig regenerates the complete Caddy configuration including basic auth
+// regenerateCaddyConfig regenerates the complete Caddy configuration including
+// basic auth and reloads Caddy
 func (sm *SQLiteSiteManager) regenerateCaddyConfig(siteID int, configFile string) error {
 	// First, get the site from database by finding it with the ID
 	// Since we need the domain, we'll get all sites and find the matching one
@@ -560,41 +584,52 @@ func (sm *SQLiteSiteManager) regenerateCaddyConfig(siteID int, configFile string
 
 	if sm.Config.DryRun {
 		if sm.Config.Verbose {
-			fmt.Printf("Would regenerate Caddy config: %s\n", configFile)
+			fmt.Fprintf(sm.Out, "Would regenerate Caddy config: %s\n", configFile)
 		}
 		return nil
 	}
 
 	if sm.Config.Verbose {
-		fmt.Printf("Regenerating Caddy configuration for %s...\n", siteWithAuth.Domain)
+		fmt.Fprintf(sm.Out, "Regenerating Caddy configuration for %s...\n", siteWithAuth.Domain)
 	}
 
-	// Start with base template
-	var baseConfig strings.Builder
-	var tmpl *template.Template
-	if siteWithAuth.IsWordPress {
-		tmpl = sm.wpTmpl
-	} else {
-		tmpl = sm.caddyTmpl
+	config, err := sm.renderCaddyConfig(&siteWithAuth.Site, siteWithAuth.BasicAuths)
+	if err != nil {
+		return err
 	}
 
-	if err := tmpl.Execute(&baseConfig, &siteWithAuth.Site); err != nil {
-		return fmt.Errorf("failed to execute base template: %v", err)
+	// Nothing is written unless Caddy accepts the new config
+	change := writeConfigFile(configFile, config)
+	if err := sm.validateConfigChanges(change); err != nil {
+		return err
 	}
 
-	config := baseConfig.String()
-
-	// Add basic auth blocks if any exist
-	if len(siteWithAuth.BasicAuths) > 0 {
-		config = sm.addBasicAuthToConfig(config, siteWithAuth.BasicAuths)
+	// Manual edits are lost on every render, so keep a copy and point to
+	// the extra directives instead
+	modified, err := sm.configModified(&siteWithAuth.Site)
+	if err != nil {
+		return err
+	}
+	if modified {
+		backupFile := configFile + ".modified"
+		content, err := os.ReadFile(configFile)
+		if err == nil {
+			err = os.WriteFile(backupFile, content, 0644)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to back up modified config file: %v", err)
+		}
+		fmt.Fprintf(sm.Out, "Warning: %s was edited by hand since it was last generated.\n", configFile)
+		fmt.Fprintf(sm.Out, "The edits were saved to %s and are overwritten now.\n", backupFile)
+		fmt.Fprintf(sm.Out, "Use 'caddy-site-manager directives edit %s' to keep custom directives.\n", siteWithAuth.Domain)
 	}
 
-	// Write the complete config
-	if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
-		return fmt.Errorf("failed to write config file: %v", err)
+	// Write the complete config and load it
+	if err := sm.reloadConfigChanges(change); err != nil {
+		return err
 	}
 
-	return nil
+	return sm.DB.SetConfigHash(siteWithAuth.Domain, configHash(config))
 }
 
 // addBasicAuthToConfig adds basic auth blocks to the Caddy configuration using route syntax
@@ -605,11 +640,14 @@ func (sm *SQLiteSiteManager) addBasicAuthToConfig(config string, auths []databas
 		authsByPath[auth.Path] = append(authsByPath[auth.Path], auth)
 	}
 
-	// Find the insertion point (before try_files or PHP processing)
+	// Find the insertion point (before try_files, PHP processing or proxying)
 	insertIndex := strings.Index(config, "try_files")
 	if insertIndex == -1 {
 		insertIndex = strings.Index(config, "php_fastcgi")
 	}
+	if insertIndex == -1 {
+		insertIndex = strings.Index(config, "reverse_proxy")
+	}
 	if insertIndex == -1 {
 		// Fallback: insert before file_server
 		insertIndex = strings.Index(config, "file_server")
@@ -628,7 +666,7 @@ func (sm *SQLiteSiteManager) addBasicAuthToConfig(config string, auths []databas
 		if !strings.HasSuffix(pathPattern, "*") {
 			pathPattern += "*"
 		}
-		
+
 		authBlocks.WriteString(fmt.Sprintf(`
 	route %s {
 		basic_auth {`, pathPattern))
@@ -648,153 +686,103 @@ func (sm *SQLiteSiteManager) addBasicAuthToConfig(config string, auths []databas
 	return config[:insertIndex] + authBlocks.String() + "\n\t" + config[insertIndex:]
 }
 
-// validateAndReloadCaddy validates and reloads the Caddy configuration
-func (sm *SQLiteSiteManager) validateAndReloadCaddy() error {
-	if sm.Config.DryRun {
-		if sm.Config.Verbose {
-			fmt.Println("Would validate and reload Caddy configuration")
-		}
-		return nil
-	}
-
-	if sm.Config.Verbose {
-		fmt.Println("Testing Caddy configuration...")
-	}
-
-	// Validate Caddy configuration
-	cmd := exec.Command("caddy", "validate", "--config", "/etc/caddy/Caddyfile")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("caddy configuration validation failed: %v", err)
-	}
-
-	if sm.Config.Verbose {
-		fmt.Println("Caddy configuration is valid.")
-	}
-
-	// Reload Caddy
-	return sm.reloadCaddy()
-}
-
-// reloadCaddy reloads the Caddy service
+// reloadCaddy reloads the Caddy service, or loads the Caddyfile through the
+// admin API if that reload method is configured
 func (sm *SQLiteSiteManager) reloadCaddy() error {
 	if sm.Config.DryRun {
 		if sm.Config.Verbose {
-			fmt.Println("Would reload Caddy")
+			fmt.Fprintln(sm.Out, "Would reload Caddy")
 		}
 		return nil
 	}
 
 	if sm.Config.Verbose {
-		fmt.Println("Reloading Caddy...")
+		fmt.Fprintln(sm.Out, "Reloading Caddy...")
 	}
 
-	cmd := exec.Command("systemctl", "reload", "caddy")
-	if err := cmd.Run(); err != nil {
+	var err error
+	if sm.Config.ReloadMethod == config.ReloadAdminAPI {
+		err = sm.loadCaddyfile()
+	} else {
+		err = sm.Runner.Run("systemctl", "reload", "caddy")
+	}
+	if err != nil {
 		return fmt.Errorf("failed to reload Caddy: %v", err)
 	}
 
 	if sm.Config.Verbose {
-		fmt.Println("Caddy reloaded successfully.")
+		fmt.Fprintln(sm.Out, "Caddy reloaded successfully.")
 	}
 
 	return nil
 }
 
-// printSuccessMessage prints the success message after site creation
-func (sm *SQLiteSiteManager) printSuccessMessage(site *database.Site) {
-	siteType := "PHP"
-	if site.IsWordPress {
-		siteType = "WordPress"
-	}
-
-	fmt.Println("")
-	fmt.Println("============================================")
-	fmt.Printf("%s site setup complete!\n", siteType)
-	fmt.Println("============================================")
-	fmt.Printf("Domain: %s\n", site.Domain)
-	fmt.Printf("Site directory: %s\n", site.DocumentRoot)
-	fmt.Printf("PHP-FPM Pool: %s\n", site.PoolName)
-	fmt.Printf("PHP-FPM Socket: /run/php/php%s-fpm-%s.sock\n", site.PHPVersion, site.PoolName)
-	configFile := filepath.Join(sm.Config.AvailableSites, site.Domain)
-	fmt.Printf("Configuration: %s\n", configFile)
-	fmt.Printf("Enabled via: %s\n", filepath.Join(sm.Config.EnabledSites, site.Domain))
-
-	if site.IsWordPress {
-		fmt.Printf("Database: %s\n", site.DBName)
-		fmt.Printf("Database user: %s\n", site.DBUser)
-		fmt.Printf("Database password: %s\n", site.DBPassword)
-	}
-
-	fmt.Println("")
-	fmt.Println("PHP settings:")
-	fmt.Printf("  upload_max_filesize: %s\n", site.MaxUpload)
-	fmt.Printf("  post_max_size: %s\n", site.MaxUpload)
-	fmt.Println("  memory_limit: 512M")
-	fmt.Println("  max_execution_time: 300s")
-	fmt.Println("  max_input_vars: 5000")
-	fmt.Println("")
-	fmt.Println("Caddy has been configured and reloaded.")
-
-	if site.IsWordPress {
-		fmt.Printf("Visit https://%s to complete WordPress installation\n", site.Domain)
-		fmt.Println("")
-		fmt.Println("Database credentials for WordPress installation:")
-		fmt.Printf("  Database Name: %s\n", site.DBName)
-		fmt.Printf("  Username: %s\n", site.DBUser)
-		fmt.Printf("  Password: %s\n", site.DBPassword)
-		fmt.Println("  Database Host: localhost")
-	} else {
-		fmt.Printf("Visit https://%s to view your PHP site\n", site.Domain)
-	}
-}
-
 // hardDelete performs complete removal
 func (sm *SQLiteSiteManager) hardDelete(site *database.Site, opts *SiteDeleteOptions) error {
+	siteType, err := LookupSiteType(site.Type)
+	if err != nil {
+		return err
+	}
+
 	// Show warning and confirm
 	if !opts.Force && !sm.Config.DryRun {
-		fmt.Printf("WARNING: This will permanently delete:\n")
-		fmt.Printf("  - Domain: %s%s\n", opts.Domain, 
-			map[bool]string{true: " (WordPress)", false: ""}[site.IsWordPress])
-		fmt.Printf("  - Directory: %s\n", site.DocumentRoot)
-		if site.IsWordPress {
-			fmt.Printf("  - Associated database and user\n")
+		fmt.Fprintf(sm.Out, "WARNING: This will permanently delete:\n")
+		fmt.Fprintf(sm.Out, "  - Domain: %s (%s)\n", opts.Domain, siteType.DisplayName())
+		if site.DocumentRoot != "" {
+			fmt.Fprintf(sm.Out, "  - Directory: %s\n", sm.siteDirectory(site))
+		}
+		if siteType.UsesDatabase() {
+			fmt.Fprintf(sm.Out, "  - Associated database and user\n")
 		}
-		fmt.Printf("  - Config file from available-sites\n")
-		fmt.Printf("  - Symlink from enabled-sites\n")
-		fmt.Printf("  - Custom PHP-FPM pool: %s (if exists)\n", site.PoolName)
-		fmt.Printf("\n")
-
-		if !confirmDeletion() {
-			fmt.Println("Deletion cancelled.")
-			return nil
+		fmt.Fprintf(sm.Out, "  - Config file from available-sites\n")
+		fmt.Fprintf(sm.Out, "  - Symlink from enabled-sites\n")
+		if site.PoolName != "" {
+			fmt.Fprintf(sm.Out, "  - Custom PHP-FPM pool: %s (if exists)\n", site.PoolName)
+		}
+		if site.SystemUser != "" {
+			fmt.Fprintf(sm.Out, "  - System user and group: %s\n", site.SystemUser)
+		}
+		fmt.Fprintf(sm.Out, "\n")
+
+		if !sm.confirmDeletion() {
+			return ErrDeletionCancelled
 		}
 	}
 
 	if sm.Config.Verbose {
-		fmt.Printf("Starting complete deletion process for %s...\n", opts.Domain)
+		fmt.Fprintf(sm.Out, "Starting complete deletion process for %s...\n", opts.Domain)
 	}
 
-	// Delete database first (if WordPress)
-	if site.IsWordPress {
-		if err := sm.deleteDatabase(site); err != nil {
-			return fmt.Errorf("failed to delete database: %v", err)
+	// Check that Caddy accepts the config without the site before anything
+	// is removed
+	if !sm.Config.DryRun {
+		if err := sm.validateConfigChanges(
+			removeConfigFile(sm.siteSymlink(opts.Domain)),
+			removeConfigFile(sm.siteConfigFile(opts.Domain)),
+		); err != nil {
+			return err
 		}
 	}
 
+	// Remove what the site type created first (e.g. the database)
+	if err := siteType.Teardown(sm, site); err != nil {
+		return err
+	}
+
 	// Remove PHP-FPM pool
-	if err := sm.removePHPFPMPool(site); err != nil {
-		return fmt.Errorf("failed to remove PHP-FPM pool: %v", err)
+	if site.PoolName != "" {
+		if err := sm.removePHPFPMPool(site); err != nil {
+			return fmt.Errorf("failed to remove PHP-FPM pool: %v", err)
+		}
 	}
 
 	// Remove symlink
-	symlinkPath := filepath.Join(sm.Config.EnabledSites, opts.Domain)
-	if err := sm.removeSymlink(symlinkPath); err != nil {
+	if err := sm.removeSymlink(sm.siteSymlink(opts.Domain)); err != nil {
 		return err
 	}
 
 	// Delete config file
-	configFile := filepath.Join(sm.Config.AvailableSites, opts.Domain)
-	if err := sm.removeFile(configFile, "config file"); err != nil {
+	if err := sm.removeFile(sm.siteConfigFile(opts.Domain), "config file"); err != nil {
 		return err
 	}
 
@@ -809,18 +797,26 @@ func (sm *SQLiteSiteManager) hardDelete(site *database.Site, opts *SiteDeleteOpt
 	}
 
 	// Delete web directory last
-	if err := sm.removeDirectory(site.DocumentRoot); err != nil {
-		return err
+	if site.DocumentRoot != "" {
+		if err := sm.removeDirectory(sm.siteDirectory(site)); err != nil {
+			return err
+		}
+	}
+
+	// The pool is gone, so no process runs as the site's user any more
+	if site.SystemUser != "" {
+		if err := sm.removeSystemUser(site); err != nil {
+			return err
+		}
 	}
 
-	fmt.Printf("Site '%s' has been completely deleted.\n", opts.Domain)
 	return nil
 }
 
 // softDelete removes only the symlink (disables the site)
 func (sm *SQLiteSiteManager) softDelete(site *database.Site, opts *SiteDeleteOptions) error {
 	if sm.Config.Verbose {
-		fmt.Printf("Performing soft delete for %s (removing symlink only)...\n", opts.Domain)
+		fmt.Fprintf(sm.Out, "Performing soft delete for %s (removing symlink only)...\n", opts.Domain)
 	}
 
 	// Update database to mark as disabled
@@ -829,132 +825,96 @@ func (sm *SQLiteSiteManager) softDelete(site *database.Site, opts *SiteDeleteOpt
 		return fmt.Errorf("failed to update site status in database: %v", err)
 	}
 
-	symlinkPath := filepath.Join(sm.Config.EnabledSites, opts.Domain)
-	
-	if err := sm.removeSymlink(symlinkPath); err != nil {
-		return err
-	}
-
-	if err := sm.reloadCaddy(); err != nil {
-		return err
+	// Remove the symlink once Caddy accepted the config without the site
+	if err := sm.activateConfig(removeConfigFile(sm.siteSymlink(opts.Domain))); err != nil {
+		site.IsEnabled = true
+		if revertErr := sm.DB.UpdateSite(site); revertErr != nil {
+			return fmt.Errorf("failed to remove symlink: %v (failed to restore site status: %v)", err, revertErr)
+		}
+		return fmt.Errorf("failed to remove symlink: %v", err)
 	}
 
-	fmt.Printf("Site '%s' has been disabled (symlink removed).\n", opts.Domain)
-	fmt.Printf("To completely delete the site, run with --hard flag\n")
-	
 	return nil
 }
 
 // Helper functions for database operations and other utilities
 
-// Database helper methods
-func (sm *SQLiteSiteManager) databaseExists(dbName string) (bool, error) {
-	cmd := exec.Command("mysql", "-u", "root", "-e", fmt.Sprintf("SELECT SCHEMA_NAME FROM INFORMATION_SCHEMA.SCHEMATA WHERE SCHEMA_NAME = '%s'", dbName))
-	output, err := cmd.Output()
-	if err != nil {
-		return false, err
-	}
-	return strings.Contains(string(output), dbName), nil
-}
-
-func (sm *SQLiteSiteManager) databaseUserExists(dbUser string) (bool, error) {
-	cmd := exec.Command("mysql", "-u", "root", "-e", fmt.Sprintf("SELECT User FROM mysql.user WHERE User = '%s'", dbUser))
-	output, err := cmd.Output()
-	if err != nil {
-		return false, err
-	}
-	return strings.Contains(string(output), dbUser), nil
-}
-
-func (sm *SQLiteSiteManager) dropDatabase(dbName string) error {
-	cmd := exec.Command("mysql", "-u", "root", "-e", fmt.Sprintf("DROP DATABASE IF EXISTS `%s`", dbName))
-	return cmd.Run()
-}
-
-func (sm *SQLiteSiteManager) dropDatabaseUser(dbUser string) error {
-	cmd := exec.Command("mysql", "-u", "root", "-e", fmt.Sprintf("DROP USER IF EXISTS '%s'@'localhost'", dbUser))
-	return cmd.Run()
-}
-
 func (sm *SQLiteSiteManager) deleteDatabase(site *database.Site) error {
 	if sm.Config.DryRun {
 		if sm.Config.Verbose {
-			fmt.Printf("Would delete database and user: %s\n", site.DBName)
+			fmt.Fprintf(sm.Out, "Would delete database and user: %s\n", site.DBName)
 		}
 		return nil
 	}
 
 	if sm.Config.Verbose {
-		fmt.Printf("Deleting database '%s' and user '%s'...\n", site.DBName, site.DBUser)
+		fmt.Fprintf(sm.Out, "Deleting database '%s' and user '%s'...\n", site.DBName, site.DBUser)
 	}
 
-	queries := []string{
-		fmt.Sprintf("DROP DATABASE IF EXISTS `%s`", site.DBName),
-		fmt.Sprintf("DROP USER IF EXISTS '%s'@'localhost'", site.DBUser),
-		"FLUSH PRIVILEGES",
+	if err := sm.Databases.DropDatabase(site.DBName); err != nil {
+		return err
 	}
-
-	for _, query := range queries {
-		cmd := exec.Command("mysql", "-u", "root", "-e", query)
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to execute database query: %v", err)
-		}
+	if err := sm.Databases.DropUser(site.DBUser); err != nil {
+		return err
 	}
 
 	if sm.Config.Verbose {
-		fmt.Println("Database and user deleted successfully")
+		fmt.Fprintln(sm.Out, "Database and user deleted successfully")
 	}
 
 	return nil
 }
 
-func (sm *SQLiteSiteManager) setupWordPressDatabase(site *database.Site) error {
-	if sm.Config.Verbose {
-		fmt.Println("Setting up database and user...")
-	}
-
-	queries := []string{
-		fmt.Sprintf("CREATE DATABASE IF NOT EXISTS `%s`;", site.DBName),
-		fmt.Sprintf("CREATE USER IF NOT EXISTS '%s'@'localhost' IDENTIFIED BY '%s';", site.DBUser, site.DBPassword),
-		fmt.Sprintf("GRANT ALL PRIVILEGES ON `%s`.* TO '%s'@'localhost';", site.DBName, site.DBUser),
-		"FLUSH PRIVILEGES;",
+// provisionDatabase creates the database and user of a site and records them
+// in the journal. A user that existed before was kept on purpose during the
+// conflict check, so it is only dropped on rollback if we created it.
+func (sm *SQLiteSiteManager) provisionDatabase(site *database.Site, j *journal) error {
+	userExisted, err := sm.Databases.UserExists(site.DBUser)
+	if err != nil {
+		return fmt.Errorf("failed to check database user existence: %v", err)
 	}
-
-	for _, query := range queries {
-		cmd := exec.Command("mysql", "-u", "root", "-e", query)
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to execute database query: %v", err)
+	j.record("database "+site.DBName, func() error {
+		if userExisted {
+			return sm.Databases.DropDatabase(site.DBName)
 		}
+		return sm.deleteDatabase(site)
+	})
+	return sm.setupDatabase(site)
+}
+
+func (sm *SQLiteSiteManager) setupDatabase(site *database.Site) error {
+	if sm.Config.Verbose {
+		fmt.Fprintln(sm.Out, "Setting up database and user...")
 	}
 
-	return nil
+	return sm.Databases.CreateDatabase(site.DBName, site.DBUser, site.DBPassword)
 }
 
 func (sm *SQLiteSiteManager) confirmOverwrite(message string) bool {
-	fmt.Printf("Warning: %s.\n", message)
-	fmt.Print("Do you want to overwrite? (y/n): ")
+	fmt.Fprintf(sm.Out, "Warning: %s.\n", message)
+	fmt.Fprint(sm.Out, "Do you want to overwrite? (y/n): ")
 	var response string
-	fmt.Scanln(&response)
+	fmt.Fscanln(sm.In, &response)
 	return strings.ToLower(response) == "y" || strings.ToLower(response) == "yes"
 }
 
 func (sm *SQLiteSiteManager) removePHPFPMPool(site *database.Site) error {
-	poolConfigFile := fmt.Sprintf("/etc/php/%s/fpm/pool.d/%s.conf", site.PHPVersion, site.PoolName)
-	poolLogFile := fmt.Sprintf("/var/log/php/%s-error.log", site.PoolName)
-	
+	poolConfigFile := sm.poolConfigFile(site)
+	poolLogFile := sm.poolLogFile(site)
+
 	if sm.Config.Verbose {
-		fmt.Printf("Checking for custom PHP-FPM pool: %s\n", site.PoolName)
+		fmt.Fprintf(sm.Out, "Checking for custom PHP-FPM pool: %s\n", site.PoolName)
 	}
 
 	// Remove pool config if it exists
 	if _, err := os.Stat(poolConfigFile); err == nil {
 		if sm.Config.DryRun {
 			if sm.Config.Verbose {
-				fmt.Printf("Would remove PHP-FPM pool: %s\n", poolConfigFile)
+				fmt.Fprintf(sm.Out, "Would remove PHP-FPM pool: %s\n", poolConfigFile)
 			}
 		} else {
 			if sm.Config.Verbose {
-				fmt.Printf("Removing PHP-FPM pool configuration: %s\n", poolConfigFile)
+				fmt.Fprintf(sm.Out, "Removing PHP-FPM pool configuration: %s\n", poolConfigFile)
 			}
 			if err := os.Remove(poolConfigFile); err != nil {
 				return fmt.Errorf("failed to remove pool config: %v", err)
@@ -963,7 +923,7 @@ func (sm *SQLiteSiteManager) removePHPFPMPool(site *database.Site) error {
 			// Remove log file if it exists
 			if _, err := os.Stat(poolLogFile); err == nil {
 				if sm.Config.Verbose {
-					fmt.Printf("Removing PHP-FPM pool log file: %s\n", poolLogFile)
+					fmt.Fprintf(sm.Out, "Removing PHP-FPM pool log file: %s\n", poolLogFile)
 				}
 				os.Remove(poolLogFile) // Don't fail if log removal fails
 			}
@@ -975,7 +935,7 @@ func (sm *SQLiteSiteManager) removePHPFPMPool(site *database.Site) error {
 		}
 	} else {
 		if sm.Config.Verbose {
-			fmt.Printf("No custom PHP-FPM pool found for domain '%s'\n", site.Domain)
+			fmt.Fprintf(sm.Out, "No custom PHP-FPM pool found for domain '%s'\n", site.Domain)
 		}
 	}
 
@@ -985,20 +945,20 @@ func (sm *SQLiteSiteManager) removePHPFPMPool(site *database.Site) error {
 func (sm *SQLiteSiteManager) removeSymlink(symlinkPath string) error {
 	if _, err := os.Lstat(symlinkPath); os.IsNotExist(err) {
 		if sm.Config.Verbose {
-			fmt.Printf("Symlink not found: %s\n", symlinkPath)
+			fmt.Fprintf(sm.Out, "Symlink not found: %s\n", symlinkPath)
 		}
 		return nil
 	}
 
 	if sm.Config.DryRun {
 		if sm.Config.Verbose {
-			fmt.Printf("Would remove symlink: %s\n", symlinkPath)
+			fmt.Fprintf(sm.Out, "Would remove symlink: %s\n", symlinkPath)
 		}
 		return nil
 	}
 
 	if sm.Config.Verbose {
-		fmt.Printf("Removing symlink: %s\n", symlinkPath)
+		fmt.Fprintf(sm.Out, "Removing symlink: %s\n", symlinkPath)
 	}
 
 	if err := os.Remove(symlinkPath); err != nil {
@@ -1006,7 +966,7 @@ func (sm *SQLiteSiteManager) removeSymlink(symlinkPath string) error {
 	}
 
 	if sm.Config.Verbose {
-		fmt.Println("Symlink removed successfully")
+		fmt.Fprintln(sm.Out, "Symlink removed successfully")
 	}
 
 	return nil
@@ -1015,20 +975,20 @@ func (sm *SQLiteSiteManager) removeSymlink(symlinkPath string) error {
 func (sm *SQLiteSiteManager) removeFile(filePath, description string) error {
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		if sm.Config.Verbose {
-			fmt.Printf("%s not found: %s\n", description, filePath)
+			fmt.Fprintf(sm.Out, "%s not found: %s\n", description, filePath)
 		}
 		return nil
 	}
 
 	if sm.Config.DryRun {
 		if sm.Config.Verbose {
-			fmt.Printf("Would remove %s: %s\n", description, filePath)
+			fmt.Fprintf(sm.Out, "Would remove %s: %s\n", description, filePath)
 		}
 		return nil
 	}
 
 	if sm.Config.Verbose {
-		fmt.Printf("Deleting %s: %s\n", description, filePath)
+		fmt.Fprintf(sm.Out, "Deleting %s: %s\n", description, filePath)
 	}
 
 	if err := os.Remove(filePath); err != nil {
@@ -1036,7 +996,7 @@ func (sm *SQLiteSiteManager) removeFile(filePath, description string) error {
 	}
 
 	if sm.Config.Verbose {
-		fmt.Printf("%s deleted successfully\n", description)
+		fmt.Fprintf(sm.Out, "%s deleted successfully\n", description)
 	}
 
 	return nil
@@ -1045,20 +1005,20 @@ func (sm *SQLiteSiteManager) removeFile(filePath, description string) error {
 func (sm *SQLiteSiteManager) removeDirectory(dirPath string) error {
 	if _, err := os.Stat(dirPath); os.IsNotExist(err) {
 		if sm.Config.Verbose {
-			fmt.Printf("Directory not found: %s\n", dirPath)
+			fmt.Fprintf(sm.Out, "Directory not found: %s\n", dirPath)
 		}
 		return nil
 	}
 
 	if sm.Config.DryRun {
 		if sm.Config.Verbose {
-			fmt.Printf("Would remove directory: %s\n", dirPath)
+			fmt.Fprintf(sm.Out, "Would remove directory: %s\n", dirPath)
 		}
 		return nil
 	}
 
 	if sm.Config.Verbose {
-		fmt.Printf("Deleting web directory '%s'...\n", dirPath)
+		fmt.Fprintf(sm.Out, "Deleting web directory '%s'...\n", dirPath)
 	}
 
 	if err := os.RemoveAll(dirPath); err != nil {
@@ -1066,7 +1026,7 @@ func (sm *SQLiteSiteManager) removeDirectory(dirPath string) error {
 	}
 
 	if sm.Config.Verbose {
-		fmt.Println("Directory deleted successfully")
+		fmt.Fprintln(sm.Out, "Directory deleted successfully")
 	}
 
 	return nil
@@ -1076,12 +1036,10 @@ func (sm *SQLiteSiteManager) removeDirectory(dirPath string) error {
 
 func (sm *SQLiteSiteManager) generatePasswordHash(password string) (string, error) {
 	// Use Caddy's hash-password command if available
-	cmd := exec.Command("caddy", "hash-password", "--plaintext", password)
-	output, err := cmd.Output()
+	output, err := sm.Runner.Output("caddy", "hash-password", "--plaintext", password)
 	if err != nil {
 		// Fallback to basic htpasswd if caddy command fails
-		cmd = exec.Command("htpasswd", "-bnB", "temp", password)
-		output, err = cmd.Output()
+		output, err = sm.Runner.Output("htpasswd", "-bnB", "temp", password)
 		if err != nil {
 			return "", fmt.Errorf("failed to generate password hash (install caddy or apache2-utils): %v", err)
 		}
@@ -1109,37 +1067,3 @@ func (sm *SQLiteSiteManager) validateSizeFormat(size string) error {
 	}
 	return nil
 }
-
-func (sm *SQLiteSiteManager) updatePHPPoolUploadSize(site *database.Site, newSize string) error {
-	poolConfigFile := fmt.Sprintf("/etc/php/%s/fpm/pool.d/%s.conf", site.PHPVersion, site.PoolName)
-	
-	if _, err := os.Stat(poolConfigFile); os.IsNotExist(err) {
-		return fmt.Errorf("PHP pool config file not found: %s", poolConfigFile)
-	}
-
-	// Read current config
-	content, err := os.ReadFile(poolConfigFile)
-	if err != nil {
-		return fmt.Errorf("failed to read PHP pool config: %v", err)
-	}
-
-	configStr := string(content)
-	
-	// Update upload_max_filesize and post_max_size
-	uploadPattern := regexp.MustCompile(`php_admin_value\[upload_max_filesize\]\s*=\s*[^\n]+`)
-	postPattern := regexp.MustCompile(`php_admin_value\[post_max_size\]\s*=\s*[^\n]+`)
-	
-	configStr = uploadPattern.ReplaceAllString(configStr, fmt.Sprintf("php_admin_value[upload_max_filesize] = %s", newSize))
-	configStr = postPattern.ReplaceAllString(configStr, fmt.Sprintf("php_admin_value[post_max_size] = %s", newSize))
-
-	// Write updated config
-	if err := os.WriteFile(poolConfigFile, []byte(configStr), 0644); err != nil {
-		return fmt.Errorf("failed to write PHP pool config: %v", err)
-	}
-
-	if sm.Config.Verbose {
-		fmt.Printf("Updated PHP pool configuration: %s\n", poolConfigFile)
-	}
-
-	return nil
-}
@@ -0,0 +1,366 @@
+package site
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tankadesign/caddy-site-manager/internal/config"
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+// configChange is a change of a file in the Caddy config directory: new
+// content for a file, a symlink to create, or a file or symlink to remove.
+// Path is the path used for file operations, LinkTarget a host path.
+type configChange struct {
+	Path       string
+	Content    []byte
+	LinkTarget string
+	Remove     bool
+}
+
+// writeConfigFile returns the change that writes a file
+func writeConfigFile(path, content string) configChange {
+	return configChange{Path: path, Content: []byte(content)}
+}
+
+// linkConfigFile returns the change that creates a symlink
+func linkConfigFile(path, target string) configChange {
+	return configChange{Path: path, LinkTarget: target}
+}
+
+// removeConfigFile returns the change that removes a file or symlink
+func removeConfigFile(path string) configChange {
+	return configChange{Path: path, Remove: true}
+}
+
+// describe returns what a change does for progress messages
+func (c configChange) describe() string {
+	switch {
+	case c.Remove:
+		return "remove " + c.Path
+	case c.LinkTarget != "":
+		return fmt.Sprintf("link %s -> %s", c.Path, c.LinkTarget)
+	default:
+		return "write " + c.Path
+	}
+}
+
+// activateConfig validates changes of the Caddy config directory in a staging
+// copy, applies them only if Caddy accepts the result and reloads Caddy, so a
+// broken config never becomes live on disk
+func (sm *SQLiteSiteManager) activateConfig(changes ...configChange) error {
+	if sm.Config.DryRun {
+		if sm.Config.Verbose {
+			for _, change := range changes {
+				fmt.Fprintf(sm.Out, "Would %s\n", change.describe())
+			}
+			fmt.Fprintln(sm.Out, "Would reload Caddy")
+		}
+		return nil
+	}
+
+	if err := sm.validateConfigChanges(changes...); err != nil {
+		return err
+	}
+	return sm.reloadConfigChanges(changes...)
+}
+
+// reloadConfigChanges applies validated changes and reloads Caddy. Caddy keeps
+// running the previous config if the reload fails, so the previous files are
+// put back; otherwise the next unrelated change would activate the rejected
+// config.
+func (sm *SQLiteSiteManager) reloadConfigChanges(changes ...configChange) error {
+	restore, err := sm.applyConfigChanges(changes...)
+	if err != nil {
+		return err
+	}
+
+	if err := sm.reloadCaddy(); err != nil {
+		if restoreErr := restore(); restoreErr != nil {
+			return fmt.Errorf("%v (failed to restore previous config: %v)", err, restoreErr)
+		}
+		return fmt.Errorf("%v (previous config restored)", err)
+	}
+	return nil
+}
+
+// stagingPrefix starts the names of staging copies in the config directory
+const stagingPrefix = ".staging-"
+
+// validateConfigChanges renders the Caddy config directory with changes into a
+// staging copy and validates it without touching the live files. The copy is
+// kept inside the config directory, where the Caddy process can read it even
+// with a private /tmp or in another container.
+func (sm *SQLiteSiteManager) validateConfigChanges(changes ...configChange) error {
+	if sm.Config.Verbose {
+		fmt.Fprintln(sm.Out, "Testing Caddy configuration...")
+	}
+
+	stagingDir, err := os.MkdirTemp(sm.Config.Path(sm.Config.ConfigDir), stagingPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %v", err)
+	}
+	defer os.RemoveAll(stagingDir)
+	if err := os.Chmod(stagingDir, 0755); err != nil {
+		return fmt.Errorf("failed to create staging directory: %v", err)
+	}
+
+	caddyfile, err := sm.stageConfigDir(stagingDir, changes)
+	if err != nil {
+		return fmt.Errorf("failed to stage Caddy configuration: %v", err)
+	}
+
+	// Caddy only warns about imports that match nothing, so make sure the
+	// staged sites are part of what it validates
+	stagedEnabled := filepath.Join(stagingDir, "enabled-sites")
+	if err := checkSitesImported(caddyfile, stagedEnabled); err != nil {
+		return fmt.Errorf("caddy configuration validation failed: %v", err)
+	}
+
+	if sm.Config.ReloadMethod == config.ReloadAdminAPI {
+		_, err = sm.adaptCaddyfile(caddyfile, stagedEnabled)
+	} else {
+		_, err = sm.Runner.Output("caddy", "validate", "--config", caddyfile, "--adapter", "caddyfile")
+		err = commandError(err)
+	}
+	if err != nil {
+		return fmt.Errorf("caddy configuration validation failed: %v", err)
+	}
+
+	if sm.Config.Verbose {
+		fmt.Fprintln(sm.Out, "Caddy configuration is valid.")
+	}
+	return nil
+}
+
+// stageConfigDir builds a copy of the Caddy config directory with changes
+// applied and returns the path of its Caddyfile. Site configs that do not
+// change are linked rather than copied, and references to the config
+// directory in the Caddyfile are pointed at the copy. Relative imports resolve
+// against the copy since its Caddyfile is at the top of it.
+func (sm *SQLiteSiteManager) stageConfigDir(stagingDir string, changes []configChange) (string, error) {
+	configDir := sm.Config.Path(sm.Config.ConfigDir)
+	availableSites := sm.Config.Path(sm.Config.AvailableSites)
+	enabledSites := sm.Config.Path(sm.Config.EnabledSites)
+	stagedAvailable := filepath.Join(stagingDir, "available-sites")
+	stagedEnabled := filepath.Join(stagingDir, "enabled-sites")
+
+	// stagedPath maps a file below the config directories into the copy
+	stagedPath := func(path string) (string, bool) {
+		for dir, staged := range map[string]string{availableSites: stagedAvailable, enabledSites: stagedEnabled} {
+			if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+				return filepath.Join(staged, rel), true
+			}
+		}
+		return "", false
+	}
+
+	// stagedTarget maps a symlink target in available-sites into the copy
+	stagedTarget := func(target string) string {
+		if rel, err := filepath.Rel(sm.Config.AvailableSites, target); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.Join(stagedAvailable, rel)
+		}
+		return target
+	}
+
+	for _, dir := range []string{stagedAvailable, stagedEnabled} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+	}
+
+	// Link site configs and everything else the Caddyfile may import
+	entries, err := os.ReadDir(configDir)
+	if err != nil {
+		return "", err
+	}
+	caddyfile := sm.Config.Path(sm.Config.CaddyFile)
+	for _, entry := range entries {
+		path := filepath.Join(configDir, entry.Name())
+		if path == availableSites || path == enabledSites || path == caddyfile || strings.HasPrefix(entry.Name(), stagingPrefix) {
+			continue
+		}
+		if err := os.Symlink(path, filepath.Join(stagingDir, entry.Name())); err != nil {
+			return "", err
+		}
+	}
+
+	available, err := os.ReadDir(availableSites)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range available {
+		if err := os.Symlink(filepath.Join(availableSites, entry.Name()), filepath.Join(stagedAvailable, entry.Name())); err != nil {
+			return "", err
+		}
+	}
+
+	enabled, err := os.ReadDir(enabledSites)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range enabled {
+		path := filepath.Join(enabledSites, entry.Name())
+		target, err := os.Readlink(path)
+		if err != nil {
+			target = path
+		}
+		if err := os.Symlink(stagedTarget(target), filepath.Join(stagedEnabled, entry.Name())); err != nil {
+			return "", err
+		}
+	}
+
+	// Apply the changes to the copy
+	for _, change := range changes {
+		path, ok := stagedPath(change.Path)
+		if !ok {
+			return "", fmt.Errorf("%s is not in the Caddy config directory", change.Path)
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		switch {
+		case change.Remove:
+		case change.LinkTarget != "":
+			err = os.Symlink(stagedTarget(change.LinkTarget), path)
+		default:
+			err = os.WriteFile(path, change.Content, 0644)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Point the Caddyfile at the copy. A missing Caddyfile is left for the
+	// validation to report.
+	stagedCaddyfile := filepath.Join(stagingDir, "Caddyfile")
+	content, err := os.ReadFile(caddyfile)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if err == nil {
+		hostDir := filepath.Clean(sm.Config.ConfigDir) + string(filepath.Separator)
+		staged := strings.ReplaceAll(string(content), hostDir, stagingDir+string(filepath.Separator))
+		if err := os.WriteFile(stagedCaddyfile, []byte(staged), 0644); err != nil {
+			return "", err
+		}
+	}
+
+	return stagedCaddyfile, nil
+}
+
+// applyConfigChanges swaps changes into the live config directory and returns
+// the action that puts the previous files back. Every file is replaced
+// atomically by renaming a temporary file over it; if a change fails, the
+// changes applied before it are undone.
+func (sm *SQLiteSiteManager) applyConfigChanges(changes ...configChange) (func() error, error) {
+	var undo []func() error
+	restore := func() error {
+		var failures []string
+		for i := len(undo) - 1; i >= 0; i-- {
+			if err := undo[i](); err != nil {
+				failures = append(failures, err.Error())
+			}
+		}
+		if len(failures) > 0 {
+			return fmt.Errorf("%s", strings.Join(failures, "; "))
+		}
+		return nil
+	}
+
+	for _, change := range changes {
+		snapshot, err := snapshotConfigFile(change.Path)
+		if err != nil {
+			restore()
+			return nil, fmt.Errorf("failed to inspect %s: %v", change.Path, err)
+		}
+
+		if err := swapConfigFile(change); err != nil {
+			restore()
+			return nil, fmt.Errorf("failed to %s: %v", change.describe(), err)
+		}
+		undo = append(undo, snapshot)
+
+		if sm.Config.Verbose {
+			fmt.Fprintf(sm.Out, "Activated: %s\n", change.describe())
+		}
+	}
+	return restore, nil
+}
+
+// swapConfigFile applies a single change atomically
+func swapConfigFile(change configChange) error {
+	if change.Remove {
+		if err := os.Remove(change.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	dir, name := filepath.Split(change.Path)
+	tmp := filepath.Join(dir, "."+name+".staged")
+	os.Remove(tmp)
+
+	if change.LinkTarget != "" {
+		if err := os.Symlink(change.LinkTarget, tmp); err != nil {
+			return err
+		}
+	} else if err := os.WriteFile(tmp, change.Content, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, change.Path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// snapshotConfigFile captures a file or symlink and returns the action that
+// puts it back
+func snapshotConfigFile(path string) (func() error, error) {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return func() error {
+			return swapConfigFile(removeConfigFile(path))
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+		return func() error {
+			return swapConfigFile(linkConfigFile(path, target))
+		}, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		return swapConfigFile(configChange{Path: path, Content: content})
+	}, nil
+}
+
+// updateSiteConfig regenerates the Caddy config of a site after its settings
+// changed in the database and reloads Caddy. If Caddy rejects the new config
+// or fails to reload it, revert puts the previous settings back so the
+// database matches the live config.
+func (sm *SQLiteSiteManager) updateSiteConfig(site *database.Site, revert func() error) error {
+	if err := sm.regenerateCaddyConfig(site.ID, sm.siteConfigFile(site.Domain)); err != nil {
+		if revertErr := revert(); revertErr != nil {
+			return fmt.Errorf("failed to regenerate Caddy config: %v (failed to restore previous settings: %v)", err, revertErr)
+		}
+		return fmt.Errorf("failed to regenerate Caddy config: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package site
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+// enableTestSite returns the changes that add and enable a site config
+func enableTestSite(sm *SQLiteSiteManager, domain string) []configChange {
+	return []configChange{
+		writeConfigFile(sm.siteConfigFile(domain), domain+" {\n\trespond \"ok\"\n}\n"),
+		linkConfigFile(sm.siteSymlink(domain), sm.siteLinkTarget(domain)),
+	}
+}
+
+func TestValidateConfigChangesStagesInConfigDir(t *testing.T) {
+	for name, caddyfile := range map[string]string{
+		"relative import": "import enabled-sites/*\n",
+		"absolute import": "import /etc/caddy/enabled-sites/*\n",
+		"quoted import":   "import \"enabled-sites/*\"\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			sm, runner := newTestManager(t)
+			configDir := sm.Config.Path(sm.Config.ConfigDir)
+			if err := os.WriteFile(sm.Config.Path(sm.Config.CaddyFile), []byte(caddyfile), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			// The staging copy is removed afterwards, so find it through
+			// the recorded validation
+			var staged string
+			if err := sm.validateConfigChanges(enableTestSite(sm, "example.com")...); err != nil {
+				t.Fatalf("validateConfigChanges: %v", err)
+			}
+			for _, cmd := range runner.Commands() {
+				if cmd.Name == "caddy" && cmd.Args[0] == "validate" {
+					staged = cmd.Args[2]
+				}
+			}
+
+			stagingDir := filepath.Dir(staged)
+			if filepath.Dir(stagingDir) != configDir || !strings.HasPrefix(filepath.Base(stagingDir), stagingPrefix) {
+				t.Errorf("staged Caddyfile %s is not in a staging copy inside %s", staged, configDir)
+			}
+			if _, err := os.Stat(stagingDir); !os.IsNotExist(err) {
+				t.Errorf("staging copy %s was not removed", stagingDir)
+			}
+			if _, err := os.Lstat(sm.siteSymlink("example.com")); !os.IsNotExist(err) {
+				t.Error("validation changed the live config directory")
+			}
+		})
+	}
+}
+
+func TestValidateConfigChangesRequiresSiteImports(t *testing.T) {
+	sm, runner := newTestManager(t)
+	if err := os.WriteFile(sm.Config.Path(sm.Config.CaddyFile), []byte("import sites/*\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := sm.validateConfigChanges(enableTestSite(sm, "example.com")...)
+	if err == nil || !strings.Contains(err.Error(), "does not import 1 of 1 enabled sites (example.com)") {
+		t.Fatalf("validateConfigChanges error = %v", err)
+	}
+	if lines := runner.CommandLines(); len(lines) != 0 {
+		t.Errorf("Caddy was asked to validate a config without the sites: %q", lines)
+	}
+}
+
+func TestValidateConfigChangesThroughAdminAPI(t *testing.T) {
+	stub := &adminStub{adaptResponse: adaptedOneSite}
+	sm := newAPIManager(t, stub)
+
+	if err := sm.validateConfigChanges(enableTestSite(sm, "example.com")...); err != nil {
+		t.Fatalf("validateConfigChanges: %v", err)
+	}
+
+	// Caddy must find the staged sites through an absolute import
+	prefix := "import " + filepath.Join(sm.Config.ConfigDir, stagingPrefix)
+	if posted := string(stub.adapted); !strings.HasPrefix(posted, prefix) || !strings.HasSuffix(posted, "/enabled-sites/*\n") {
+		t.Errorf("posted Caddyfile = %q, want an import of the staged enabled-sites below %s", posted, sm.Config.ConfigDir)
+	}
+	if stub.loaded != nil {
+		t.Error("validation loaded the config")
+	}
+}
+
+func TestFailedReloadRestoresConfigAndSettings(t *testing.T) {
+	sm, runner := newTestManager(t)
+	if _, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com"}); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	before, err := sm.DB.GetSite("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := os.ReadFile(sm.siteConfigFile("example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner.Errors["systemctl reload caddy"] = errors.New("exit status 1")
+	err = sm.SetCanonical("example.com", database.CanonicalNone)
+	if err == nil || !strings.Contains(err.Error(), "previous config restored") {
+		t.Fatalf("SetCanonical error = %v", err)
+	}
+
+	if restored, _ := os.ReadFile(sm.siteConfigFile("example.com")); string(restored) != string(config) {
+		t.Errorf("config was not restored:\n%s", restored)
+	}
+	after, err := sm.DB.GetSite("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Canonical != before.Canonical || after.ConfigHash != before.ConfigHash {
+		t.Errorf("site = %s/%s, want %s/%s", after.Canonical, after.ConfigHash, before.Canonical, before.ConfigHash)
+	}
+	if modified, err := sm.configModified(after); err != nil || modified {
+		t.Errorf("configModified = %v, %v after the rollback", modified, err)
+	}
+}
@@ -0,0 +1,290 @@
+package site
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/tankadesign/caddy-site-manager/internal/database"
+)
+
+// builtinTemplates are the default templates shipped with the binary
+//
+//go:embed templates
+var builtinTemplates embed.FS
+
+// templateExt is the file extension of templates on disk
+const templateExt = ".tmpl"
+
+// Template kinds, which are the first element of a template name
+const (
+	TemplateKindCaddy = "caddy"
+	TemplateKindPool  = "php-fpm"
+)
+
+// Template sources
+const (
+	TemplateBuiltin  = "builtin"
+	TemplateOverride = "override"
+	TemplateCustom   = "custom"
+)
+
+// TemplateInfo describes an available template. Path is the file a template
+// is read from and empty for built-in templates.
+type TemplateInfo struct {
+	Name   string `json:"name" yaml:"name"`
+	Kind   string `json:"kind" yaml:"kind"`
+	Source string `json:"source" yaml:"source"`
+	Path   string `json:"path,omitempty" yaml:"path,omitempty"`
+}
+
+// TemplateStore loads templates from a directory of user templates and falls
+// back to the built-in templates. A user template named like a built-in one
+// overrides it; any other user template can be selected per site.
+type TemplateStore struct {
+	Dir    string
+	parsed map[string]*template.Template
+}
+
+// NewTemplateStore creates a template store for a user template directory
+func NewTemplateStore(dir string) *TemplateStore {
+	return &TemplateStore{
+		Dir:    dir,
+		parsed: make(map[string]*template.Template),
+	}
+}
+
+// templateNamePattern matches template names: a kind and a file name
+var templateNamePattern = regexp.MustCompile(`^(caddy|php-fpm)/[A-Za-z0-9_-]+$`)
+
+// templateKind returns the kind of a template name
+func templateKind(name string) (string, error) {
+	if !templateNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid template name %q (use %s/<name> or %s/<name>)", name, TemplateKindCaddy, TemplateKindPool)
+	}
+	kind, _, _ := strings.Cut(name, "/")
+	return kind, nil
+}
+
+// List returns all available templates sorted by name
+func (s *TemplateStore) List() ([]TemplateInfo, error) {
+	infos := make(map[string]TemplateInfo)
+
+	err := fs.WalkDir(builtinTemplates, "templates", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(path, "templates/"), templateExt)
+		kind, _ := templateKind(name)
+		infos[name] = TemplateInfo{Name: name, Kind: kind, Source: TemplateBuiltin}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, kind := range []string{TemplateKindCaddy, TemplateKindPool} {
+		dir := filepath.Join(s.Dir, kind)
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read template directory: %v", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), templateExt) {
+				continue
+			}
+			name := kind + "/" + strings.TrimSuffix(entry.Name(), templateExt)
+			if _, err := templateKind(name); err != nil {
+				continue
+			}
+			source := TemplateCustom
+			if _, builtin := infos[name]; builtin {
+				source = TemplateOverride
+			}
+			infos[name] = TemplateInfo{Name: name, Kind: kind, Source: source, Path: filepath.Join(dir, entry.Name())}
+		}
+	}
+
+	names := make([]string, 0, len(infos))
+	for name := range infos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := make([]TemplateInfo, 0, len(names))
+	for _, name := range names {
+		list = append(list, infos[name])
+	}
+	return list, nil
+}
+
+// Source returns where a template is read from and its text
+func (s *TemplateStore) Source(name string) (*TemplateInfo, string, error) {
+	kind, err := templateKind(name)
+	if err != nil {
+		return nil, "", err
+	}
+
+	builtin, builtinErr := builtinTemplates.ReadFile("templates/" + name + templateExt)
+
+	path := filepath.Join(s.Dir, filepath.FromSlash(name)+templateExt)
+	if text, err := os.ReadFile(path); err == nil {
+		source := TemplateCustom
+		if builtinErr == nil {
+			source = TemplateOverride
+		}
+		return &TemplateInfo{Name: name, Kind: kind, Source: source, Path: path}, string(text), nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, "", fmt.Errorf("failed to read template %s: %v", name, err)
+	}
+
+	if builtinErr != nil {
+		return nil, "", fmt.Errorf("template %s not found", name)
+	}
+	return &TemplateInfo{Name: name, Kind: kind, Source: TemplateBuiltin}, string(builtin), nil
+}
+
+// Load returns a parsed and validated template by name
+func (s *TemplateStore) Load(name string) (*template.Template, error) {
+	if tmpl, ok := s.parsed[name]; ok {
+		return tmpl, nil
+	}
+
+	info, text, err := s.Source(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("template %s%s: %v", name, info.location(), err)
+	}
+
+	// Render sample data so fields that do not exist are reported now and
+	// not halfway through creating a site
+	if err := tmpl.Execute(io.Discard, sampleTemplateData(info.Kind)); err != nil {
+		if m := unknownFieldPattern.FindStringSubmatch(err.Error()); m != nil {
+			return nil, fmt.Errorf("template %s%s references unknown field %s", name, info.location(), m[1])
+		}
+		return nil, fmt.Errorf("template %s%s: %v", name, info.location(), err)
+	}
+
+	s.parsed[name] = tmpl
+	return tmpl, nil
+}
+
+// LoadKind returns a template by name and checks that it is of a kind
+func (s *TemplateStore) LoadKind(name, kind string) (*template.Template, error) {
+	if k, err := templateKind(name); err != nil {
+		return nil, err
+	} else if k != kind {
+		return nil, fmt.Errorf("template %s is not a %s template", name, kind)
+	}
+	return s.Load(name)
+}
+
+// location describes the file a template is read from for error messages
+func (info *TemplateInfo) location() string {
+	if info.Path == "" {
+		return ""
+	}
+	return " (" + info.Path + ")"
+}
+
+// unknownFieldPattern matches the execution error of a missing struct field
+var unknownFieldPattern = regexp.MustCompile(`can't evaluate field (\w+)`)
+
+// sampleTemplateData returns data with every field set, so that all branches
+// of a template that depend on optional settings are rendered
+func sampleTemplateData(kind string) interface{} {
+	site := &database.Site{
+		ID:              1,
+		Domain:          "example.com",
+		DocumentRoot:    "/var/www/sites/example.com",
+		PHPVersion:      "8.3",
+		Type:            TypePHP,
+		IsEnabled:       true,
+		MaxUpload:       "256M",
+		DBName:          "example_com",
+		DBUser:          "example_com",
+		DBPassword:      "password",
+		PoolName:        "example_com",
+		Canonical:       database.CanonicalApex,
+		Upstreams:       []string{"127.0.0.1:3000", "127.0.0.1:3001"},
+		LBPolicy:        "round_robin",
+		HealthURI:       "/health",
+		SPAFallback:     true,
+		HeaderProfile:   DefaultHeaderProfile,
+		HeaderOverrides: []string{"X-Frame-Options: DENY"},
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+	}
+	setDefaultPoolSettings(site)
+
+	if kind == TemplateKindPool {
+		return &poolTemplateData{
+			Site:        site,
+			PoolUser:    "web_example_com",
+			PoolGroup:   "web_example_com",
+			PHPSettings: effectivePHPSettings(site, []database.PHPSetting{{Name: "memory_limit", Value: "1G", Directive: PHPAdminValue}}),
+		}
+	}
+	return &caddyTemplateData{
+		Site:              site,
+		PrimaryHost:       "example.com",
+		CanonicalRedirect: "www.example.com",
+		Aliases:           []string{"example.net"},
+		RedirectAliases:   []string{"example.org"},
+		Headers:           []Header{{Name: "X-Content-Type-Options", Value: "nosniff"}, {Name: "X-Powered-By", Remove: true}},
+	}
+}
+
+// caddyTemplateName returns the Caddy template of a site, which is the one
+// selected for the site or else the default of its type
+func caddyTemplateName(site *database.Site) (string, error) {
+	if site.CaddyTemplate != "" {
+		return site.CaddyTemplate, nil
+	}
+	siteType, err := LookupSiteType(site.Type)
+	if err != nil {
+		return "", err
+	}
+	return siteType.CaddyTemplate(), nil
+}
+
+// poolTemplateName returns the PHP-FPM pool template of a site, which is
+// empty for site types without a pool
+func poolTemplateName(site *database.Site) (string, error) {
+	siteType, err := LookupSiteType(site.Type)
+	if err != nil {
+		return "", err
+	}
+	if siteType.PoolTemplate() == "" {
+		return "", nil
+	}
+	if site.PoolTemplate != "" {
+		return site.PoolTemplate, nil
+	}
+	return siteType.PoolTemplate(), nil
+}
+
+// caddyTemplate returns the Caddy config template of a site
+func (sm *SQLiteSiteManager) caddyTemplate(site *database.Site) (*template.Template, error) {
+	name, err := caddyTemplateName(site)
+	if err != nil {
+		return nil, err
+	}
+	return sm.templates.LoadKind(name, TemplateKindCaddy)
+}
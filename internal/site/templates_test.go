@@ -0,0 +1,127 @@
+package site
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTemplate writes a user template below dir
+func writeTemplate(t *testing.T, dir, name, text string) string {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(name)+templateExt)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBuiltinTemplatesLoad(t *testing.T) {
+	store := NewTemplateStore(t.TempDir())
+	list, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) == 0 {
+		t.Fatal("no built-in templates")
+	}
+	for _, info := range list {
+		if info.Source != TemplateBuiltin {
+			t.Errorf("%s has source %s, want %s", info.Name, info.Source, TemplateBuiltin)
+		}
+		if _, err := store.Load(info.Name); err != nil {
+			t.Errorf("Load(%s): %v", info.Name, err)
+		}
+	}
+}
+
+func TestUserTemplates(t *testing.T) {
+	dir := t.TempDir()
+	override := writeTemplate(t, dir, "caddy/static", "{{.Domain}} {\n\tfile_server\n}\n")
+	custom := writeTemplate(t, dir, "caddy/maintenance", "{{.Domain}} {\n\trespond \"maintenance\" 503\n}\n")
+	writeTemplate(t, dir, "caddy/Not Valid", "ignored")
+	store := NewTemplateStore(dir)
+
+	list, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := make(map[string]TemplateInfo)
+	for _, info := range list {
+		sources[info.Name] = info
+	}
+	if info := sources["caddy/static"]; info.Source != TemplateOverride || info.Path != override {
+		t.Errorf("caddy/static = %+v, want the override", info)
+	}
+	if info := sources["caddy/maintenance"]; info.Source != TemplateCustom || info.Path != custom || info.Kind != TemplateKindCaddy {
+		t.Errorf("caddy/maintenance = %+v, want the custom template", info)
+	}
+	if info := sources["caddy/php"]; info.Source != TemplateBuiltin {
+		t.Errorf("caddy/php = %+v, want the built-in template", info)
+	}
+	if _, ok := sources["caddy/Not Valid"]; ok {
+		t.Error("a template with an invalid name was listed")
+	}
+
+	_, text, err := store.Source("caddy/static")
+	if err != nil || !strings.HasPrefix(text, "{{.Domain}} {") {
+		t.Errorf("Source(caddy/static) = %q, %v, want the override", text, err)
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	dir := t.TempDir()
+	unknown := writeTemplate(t, dir, "caddy/unknown", "{{.Domain}} {\n\troot * {{.Webroot}}\n}\n")
+	broken := writeTemplate(t, dir, "php-fpm/broken", "[{{.PoolName}]\n")
+	store := NewTemplateStore(dir)
+
+	tests := []struct {
+		name, kind, want string
+	}{
+		{"caddy/unknown", TemplateKindCaddy, "template caddy/unknown (" + unknown + ") references unknown field Webroot"},
+		{"php-fpm/broken", TemplateKindPool, "template php-fpm/broken (" + broken + "):"},
+		{"caddy/missing", TemplateKindCaddy, "template caddy/missing not found"},
+		{"../etc/passwd", TemplateKindCaddy, "invalid template name"},
+		{"caddy/php", TemplateKindPool, "template caddy/php is not a php-fpm template"},
+	}
+	for _, tt := range tests {
+		if _, err := store.LoadKind(tt.name, tt.kind); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("LoadKind(%s, %s) error = %v, want %q", tt.name, tt.kind, err, tt.want)
+		}
+	}
+}
+
+func TestCreateSiteWithTemplate(t *testing.T) {
+	sm, runner := newTestManager(t)
+	dir := sm.Config.Path(sm.Config.TemplateDir)
+	writeTemplate(t, dir, "caddy/maintenance", "{{.PrimaryHost}} {\n\trespond \"{{.Domain}} is down for maintenance\" 503\n}\n")
+	writeTemplate(t, dir, "caddy/unknown", "{{.Domain}} {\n\troot * {{.Webroot}}\n}\n")
+
+	// A broken template is reported before anything is created
+	_, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com", CaddyTemplate: "caddy/unknown"})
+	if err == nil || !strings.Contains(err.Error(), "references unknown field Webroot") {
+		t.Fatalf("CreateSite error = %v", err)
+	}
+	if lines := runner.CommandLines(); len(lines) != 0 {
+		t.Errorf("CreateSite with a broken template ran %q", lines)
+	}
+
+	result, err := sm.CreateSite(&SiteCreateOptions{Domain: "example.com", CaddyTemplate: "caddy/maintenance"})
+	if err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	stored, err := sm.DB.GetSite("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.CaddyTemplate != "caddy/maintenance" {
+		t.Errorf("stored Caddy template = %q", stored.CaddyTemplate)
+	}
+	if config, _ := os.ReadFile(result.ConfigFile); !strings.Contains(string(config), `respond "example.com is down for maintenance" 503`) {
+		t.Errorf("config was not rendered from the selected template:\n%s", config)
+	}
+}
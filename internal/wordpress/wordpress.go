@@ -10,20 +10,27 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 )
 
+// wpVersionPattern matches the version assignment in wp-includes/version.php
+var wpVersionPattern = regexp.MustCompile(`\$wp_version\s*=\s*['"]([^'"]+)['"]`)
+
 // WordPressManager handles WordPress-specific operations
 type WordPressManager struct {
 	Verbose bool
 	DryRun  bool
+	Out     io.Writer
 }
 
-// NewWordPressManager creates a new WordPress manager
+// NewWordPressManager creates a new WordPress manager that writes progress
+// messages to stdout
 func NewWordPressManager(verbose, dryRun bool) *WordPressManager {
 	return &WordPressManager{
 		Verbose: verbose,
 		DryRun:  dryRun,
+		Out:     os.Stdout,
 	}
 }
 
@@ -31,13 +38,13 @@ func NewWordPressManager(verbose, dryRun bool) *WordPressManager {
 func (wm *WordPressManager) DownloadAndExtract(targetDir string) error {
 	if wm.DryRun {
 		if wm.Verbose {
-			fmt.Printf("Would download and extract WordPress to: %s\n", targetDir)
+			fmt.Fprintf(wm.Out, "Would download and extract WordPress to: %s\n", targetDir)
 		}
 		return nil
 	}
 
 	if wm.Verbose {
-		fmt.Println("Downloading latest WordPress...")
+		fmt.Fprintln(wm.Out, "Downloading latest WordPress...")
 	}
 
 	// Download WordPress
@@ -62,7 +69,7 @@ func (wm *WordPressManager) DownloadAndExtract(targetDir string) error {
 	tarReader := tar.NewReader(gzipReader)
 
 	if wm.Verbose {
-		fmt.Printf("Extracting WordPress to: %s\n", targetDir)
+		fmt.Fprintf(wm.Out, "Extracting WordPress to: %s\n", targetDir)
 	}
 
 	// Extract files
@@ -108,7 +115,7 @@ func (wm *WordPressManager) DownloadAndExtract(targetDir string) error {
 	}
 
 	if wm.Verbose {
-		fmt.Println("WordPress extracted successfully")
+		fmt.Fprintln(wm.Out, "WordPress extracted successfully")
 	}
 
 	return nil
@@ -118,13 +125,13 @@ func (wm *WordPressManager) DownloadAndExtract(targetDir string) error {
 func (wm *WordPressManager) GenerateSecureConfig(targetDir, dbName, dbUser, dbPassword string) error {
 	if wm.DryRun {
 		if wm.Verbose {
-			fmt.Printf("Would generate wp-config.php in: %s\n", targetDir)
+			fmt.Fprintf(wm.Out, "Would generate wp-config.php in: %s\n", targetDir)
 		}
 		return nil
 	}
 
 	if wm.Verbose {
-		fmt.Println("Generating secure wp-config.php...")
+		fmt.Fprintln(wm.Out, "Generating secure wp-config.php...")
 	}
 
 	// Get WordPress salts
@@ -229,7 +236,7 @@ require_once ABSPATH . 'wp-settings.php';
 	}
 
 	if wm.Verbose {
-		fmt.Println("Secure WordPress configuration created")
+		fmt.Fprintln(wm.Out, "Secure WordPress configuration created")
 	}
 
 	return nil
@@ -366,7 +373,7 @@ func (wm *WordPressManager) CleanupOnError(targetDir string) error {
 	}
 
 	if wm.Verbose {
-		fmt.Printf("Cleaning up WordPress installation at: %s\n", targetDir)
+		fmt.Fprintf(wm.Out, "Cleaning up WordPress installation at: %s\n", targetDir)
 	}
 
 	return os.RemoveAll(targetDir)
@@ -391,8 +398,24 @@ func (wm *WordPressManager) ValidateWordPressInstallation(targetDir string) erro
 	}
 
 	if wm.Verbose {
-		fmt.Println("WordPress installation validation successful")
+		fmt.Fprintln(wm.Out, "WordPress installation validation successful")
 	}
 
 	return nil
 }
+
+// ReadVersion returns the WordPress version of an installation as declared in
+// wp-includes/version.php
+func ReadVersion(targetDir string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(targetDir, "wp-includes", "version.php"))
+	if err != nil {
+		return "", err
+	}
+
+	matches := wpVersionPattern.FindStringSubmatch(string(content))
+	if len(matches) < 2 {
+		return "", fmt.Errorf("WordPress version not found in wp-includes/version.php")
+	}
+
+	return matches[1], nil
+}
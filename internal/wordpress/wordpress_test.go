@@ -0,0 +1,34 @@
+package wordpress
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadVersion(t *testing.T) {
+	tests := []struct {
+		name, content, want string
+	}{
+		{"single quotes", "<?php\n/**\n * The WordPress version string.\n */\n$wp_version = '6.6.2';\n$wp_db_version = 57155;\n", "6.6.2"},
+		{"double quotes", "<?php\n$wp_version=\"6.7-beta1\";\n", "6.7-beta1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(dir, "wp-includes"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, "wp-includes", "version.php"), []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if version, err := ReadVersion(dir); err != nil || version != tt.want {
+				t.Errorf("ReadVersion() = %q, %v, want %s", version, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := ReadVersion(t.TempDir()); !os.IsNotExist(err) {
+		t.Errorf("ReadVersion() without WordPress error = %v, want not exist", err)
+	}
+}